@@ -7,6 +7,10 @@ package main
 import (
 	"bubble/def"
 	"bubble/master"
+	"bubble/store"
+	"flag"
+	"fmt"
+	"os"
 
 	"github.com/giant-tech/go-service/framework/app"
 	"github.com/giant-tech/go-service/framework/service"
@@ -15,10 +19,61 @@ import (
 const (
 	ServiceName       string = "Master"
 	ServiceConfigPath string = "./master.toml"
+	// SERVICEENV defines the OS env of the service configure file path.
+	SERVICEENV string = "BUBBLE_MASTER_SERVICE"
 )
 
+// Paths could be set by flags, which are taken before the service
+// framework parses the rest, like:
+//
+//	bubble-master -config /etc/bubble/master.yml -data /var/lib/bubble -service master.toml
 func main() {
-	service.RegService(def.MasterService, ServiceName, &master.Master{})
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:]))
+	}
 
-	app.Run(ServiceConfigPath)
+	flags, rest := def.TakeFlags(os.Args[1:], "config", "data", "service")
+	os.Args = append(os.Args[:1], rest...)
+
+	service.RegService(def.MasterService, ServiceName, &master.Master{ConfigFile: flags["config"], DataDir: flags["data"]})
+
+	app.Run(def.FirstOf(flags["service"], os.Getenv(SERVICEENV), ServiceConfigPath))
+}
+
+// migrate copies Job states between stores, like:
+//
+//	bubble-master migrate -from file -to bolt
+func migrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	data := fs.String("data", def.FirstOf(os.Getenv(master.DATAENV), def.ExeDir()), "data folder of Master")
+	from := fs.String("from", store.FILE, "source store type (file or bolt)")
+	fromPath := fs.String("from-path", "", "source folder or database file")
+	to := fs.String("to", store.BOLT, "target store type (file or bolt)")
+	toPath := fs.String("to-path", "", "target folder or database file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	src, err := store.Open(*from, master.DefaultStorePath(*data, *from, *fromPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Open source store failed: %s\n", err)
+		return 1
+	}
+	defer src.Close()
+
+	dst, err := store.Open(*to, master.DefaultStorePath(*data, *to, *toPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Open target store failed: %s\n", err)
+		return 1
+	}
+	defer dst.Close()
+
+	jobs, runners, err := master.Migrate(src, dst)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate failed after [%d] Jobs: %s\n", jobs, err)
+		return 1
+	}
+
+	fmt.Printf("Migrated [%d] Jobs and [%d] Runners from [%s] to [%s] store.\n", jobs, runners, *from, *to)
+	return 0
 }
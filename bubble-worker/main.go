@@ -7,6 +7,7 @@ package main
 import (
 	"bubble/def"
 	"bubble/worker"
+	"os"
 
 	"github.com/giant-tech/go-service/framework/app"
 	"github.com/giant-tech/go-service/framework/service"
@@ -15,10 +16,21 @@ import (
 const (
 	ServiceName       string = "Worker"
 	ServiceConfigPath string = "./worker.toml"
+	// SERVICEENV defines the OS env of the service configure file path.
+	SERVICEENV string = "BUBBLE_WORKER_SERVICE"
 )
 
+// Paths could be set by flags, which are taken before the service
+// framework parses the rest. Workers on the same host should use
+// different data folders and service configures, like:
+//
+//	bubble-worker -config w1/worker.yml -data w1 -workspace /mnt/ssd/w1 -service w1/worker.toml
 func main() {
-	service.RegService(def.WorkerService, ServiceName, &worker.Worker{})
+	flags, rest := def.TakeFlags(os.Args[1:], "config", "data", "workspace", "service")
+	os.Args = append(os.Args[:1], rest...)
 
-	app.Run(ServiceConfigPath)
+	w := &worker.Worker{ConfigFile: flags["config"], DataDir: flags["data"], Workspace: flags["workspace"]}
+	service.RegService(def.WorkerService, ServiceName, w)
+
+	app.Run(def.FirstOf(flags["service"], os.Getenv(SERVICEENV), ServiceConfigPath))
 }
@@ -0,0 +1,14 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bubble/client"
+	"os"
+)
+
+func main() {
+	os.Exit(client.Run(os.Args[1:]))
+}
@@ -8,4 +8,5 @@ set GOOS=windows
 set GOARCH=amd64
 go build -o bin/master/bubble-master.exe bubble-master/main.go
 go build -o bin/worker/bubble-worker.exe bubble-worker/main.go
+go build -o bin/bubble.exe bubble/main.go
 
@@ -0,0 +1,368 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bubble/def"
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BASEURL defines the API v2 path.
+	BASEURL string = "/api/v2/"
+	// STREAMURL defines the API path of the Runner event stream.
+	STREAMURL string = "/api/v1/jobs/%s/stream/%s"
+	// TIMEOUT defines the timeout of the API requests except streaming.
+	TIMEOUT time.Duration = 30 * time.Second
+)
+
+// Runner presents a Runner of Job.
+type Runner struct {
+	ID       string      `json:"id"`
+	Status   def.STATUS  `json:"status"`
+	Revision string      `json:"revision,omitempty"`
+	Cmds     []*Command  `json:"cmds"`
+	Cause    interface{} `json:"cause,omitempty"`
+}
+
+// Command presents a command of Runner.
+type Command struct {
+	Index   int        `json:"index"`
+	Name    string     `json:"name"`
+	Alias   string     `json:"alias"`
+	Status  def.STATUS `json:"status"`
+	Measure int64      `json:"measure"`
+}
+
+// Cron presents a cron trigger of Job.
+type Cron struct {
+	ID   string `json:"id"`
+	Type int    `json:"type"`
+}
+
+// Worker presents a connected Worker.
+type Worker struct {
+	ID       string `json:"id"`
+	Workload int    `json:"workload"`
+}
+
+// Event presents a log chunk or status change of a command.
+type Event struct {
+	Type   string     `json:"type"`
+	Index  int        `json:"index"`
+	Offset int64      `json:"offset"`
+	Status def.STATUS `json:"status"`
+	Data   string     `json:"data,omitempty"`
+}
+
+// NewClient creates an IClient by the profile.
+func NewClient(p *Profile) (IClient, error) {
+	if p.URL == "" {
+		return nil, errors.New("master url is not set, please run \"bubble profile set\"")
+	}
+
+	t := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{InsecureSkipVerify: p.Insecure}}
+	if p.CA != "" {
+		pem, err := ioutil.ReadFile(p.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate is found in CA file [%s]", p.CA)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	return &client{
+		url:    strings.TrimSuffix(p.URL, "/"),
+		token:  p.Token,
+		http:   &http.Client{Transport: t, Timeout: TIMEOUT},
+		stream: &http.Client{Transport: t},
+	}, nil
+}
+
+type client struct {
+	url    string
+	token  string
+	http   *http.Client
+	stream *http.Client
+}
+
+type failure struct {
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	// Data is the message of v1 errors, such as authentication failures.
+	Data string `json:"data"`
+}
+
+type page struct {
+	Items json.RawMessage `json:"items"`
+	Next  string          `json:"next"`
+}
+
+func (c *client) Jobs() ([]string, error) {
+	jobs := make([]string, 0)
+	cursor := ""
+	for {
+		var p page
+		if err := c.do("GET", "jobs?limit=100&cursor="+url.QueryEscape(cursor), nil, &p, nil); err != nil {
+			return nil, err
+		}
+
+		var names []string
+		if err := json.Unmarshal(p.Items, &names); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, names...)
+
+		if p.Next == "" {
+			return jobs, nil
+		}
+		cursor = p.Next
+	}
+}
+
+func (c *client) CreateJob(job string) error {
+	return c.do("POST", "jobs", map[string]string{"name": job}, nil, nil)
+}
+
+func (c *client) DeleteJob(job string) error {
+	return c.do("DELETE", "jobs/"+url.PathEscape(job), nil, nil, nil)
+}
+
+func (c *client) Script(job string) ([]byte, string, error) {
+	var s struct {
+		Script string `json:"script"`
+	}
+	header := make(http.Header)
+	if err := c.do("GET", "jobs/"+url.PathEscape(job)+"/script", nil, &s, header); err != nil {
+		return nil, "", err
+	}
+
+	return []byte(s.Script), header.Get("ETag"), nil
+}
+
+func (c *client) SetScript(job string, script []byte, etag string) (string, error) {
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	if err := c.do("PUT", "jobs/"+url.PathEscape(job)+"/script", map[string]string{"script": string(script)}, nil, header); err != nil {
+		return "", err
+	}
+
+	return header.Get("ETag"), nil
+}
+
+func (c *client) Trigger(job string, ref string, params map[string]string) (string, error) {
+	var r struct {
+		ID string `json:"id"`
+	}
+	body := map[string]interface{}{"ref": ref, "params": params}
+	if err := c.do("POST", "jobs/"+url.PathEscape(job)+"/runners", body, &r, nil); err != nil {
+		return "", err
+	}
+
+	return r.ID, nil
+}
+
+func (c *client) Runners(job string, limit int) ([]*Runner, error) {
+	var p page
+	if err := c.do("GET", "jobs/"+url.PathEscape(job)+"/runners?limit="+strconv.Itoa(limit), nil, &p, nil); err != nil {
+		return nil, err
+	}
+
+	runners := make([]*Runner, 0)
+	return runners, json.Unmarshal(p.Items, &runners)
+}
+
+func (c *client) Runner(job string, id string) (*Runner, error) {
+	r := &Runner{}
+	return r, c.do("GET", "jobs/"+url.PathEscape(job)+"/runners/"+url.PathEscape(id), nil, r, nil)
+}
+
+func (c *client) Cancel(job string, id string) error {
+	return c.do("POST", "jobs/"+url.PathEscape(job)+"/runners/"+url.PathEscape(id)+"/cancel", nil, nil, nil)
+}
+
+func (c *client) Stream(job string, id string, f func(e *Event) error) error {
+	from := ""
+	for {
+		done, last, err := c.subscribe(job, id, from, f)
+		if done || err != nil {
+			return err
+		}
+
+		// Resume from the last event if the connection is broken.
+		from = last
+		time.Sleep(time.Second)
+	}
+}
+
+func (c *client) Crons(job string) ([]*Cron, error) {
+	crons := make([]*Cron, 0)
+	return crons, c.do("GET", "jobs/"+url.PathEscape(job)+"/triggers", nil, &crons, nil)
+}
+
+func (c *client) AddCron(job string, t int) (*Cron, error) {
+	cron := &Cron{}
+	return cron, c.do("POST", "jobs/"+url.PathEscape(job)+"/triggers", map[string]int{"type": t}, cron, nil)
+}
+
+func (c *client) RemoveCron(job string, id string) error {
+	return c.do("DELETE", "jobs/"+url.PathEscape(job)+"/triggers/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *client) Workers() ([]*Worker, error) {
+	workers := make([]*Worker, 0)
+	return workers, c.do("GET", "workers", nil, &workers, nil)
+}
+
+// --- Inner ---
+
+// do sends the request with JSON body, and decodes the response into out.
+// Headers are sent from header, and the response headers are copied back.
+func (c *client) do(method string, path string, body interface{}, out interface{}, header http.Header) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url+BASEURL+path, reader)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	c.authorize(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return decodeFailure(resp.StatusCode, data)
+	}
+
+	if header != nil {
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+
+	return nil
+}
+
+// subscribe reads the Server-Sent Events from the event id, and returns
+// whether the stream is completed and the last event id.
+func (c *client) subscribe(job string, id string, from string, f func(e *Event) error) (bool, string, error) {
+	req, err := http.NewRequest("GET", c.url+fmt.Sprintf(STREAMURL, url.PathEscape(job), url.PathEscape(id)), nil)
+	if err != nil {
+		return false, from, err
+	}
+	c.authorize(req)
+	if from != "" {
+		req.Header.Set("Last-Event-ID", from)
+	}
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return false, from, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return false, from, decodeFailure(resp.StatusCode, data)
+	}
+
+	last := from
+	event, data := "", ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			last = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if event == "error" {
+				return true, last, errors.New(data)
+			}
+
+			e := &Event{}
+			if err := json.Unmarshal([]byte(data), e); err == nil {
+				if err = f(e); err != nil {
+					return true, last, err
+				}
+				if e.Type == "end" {
+					return true, last, nil
+				}
+			}
+			event, data = "", ""
+		}
+	}
+
+	return false, last, nil
+}
+
+func (c *client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+func decodeFailure(status int, data []byte) error {
+	var f failure
+	if err := json.Unmarshal(data, &f); err == nil {
+		if f.Error != nil {
+			return fmt.Errorf("%s: %s", f.Error.Code, f.Error.Message)
+		}
+		if f.Data != "" {
+			return errors.New(f.Data)
+		}
+	}
+
+	return fmt.Errorf("request failed with status [%d]", status)
+}
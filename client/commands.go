@@ -0,0 +1,739 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bubble/def"
+	"bubble/master"
+	"bubble/worker/action"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// EXITSUCCESS is returned when the command or the Runner is succeeded.
+	EXITSUCCESS int = 0
+	// EXITFAILURE is returned when the request or the Runner is failed.
+	EXITFAILURE int = 1
+	// EXITUSAGE is returned when the arguments are incorrect.
+	EXITUSAGE int = 2
+	// EXITCANCEL is returned when the Runner is canceled or interrupted.
+	EXITCANCEL int = 3
+	// EXITTIMEOUT is returned when waiting the Runner is timeout.
+	EXITTIMEOUT int = 4
+
+	// SCRIPTFILE defines the default local script file.
+	SCRIPTFILE string = ".bubble.yml"
+	// RUNDIR defines the default folder of working directories for running
+	// Job scripts locally.
+	RUNDIR string = ".bubble-run"
+	// WAITINTERVAL defines the interval of polling the Runner status.
+	WAITINTERVAL time.Duration = 2 * time.Second
+)
+
+const usage = `Usage: bubble [-profile NAME] [-o json] COMMAND [ARGS]
+
+Commands:
+  jobs list                       List all Jobs.
+  jobs create JOB                 Create a Job.
+  jobs delete JOB                 Delete a Job.
+  pull JOB [-f FILE]              Save the Job script to FILE (.bubble.yml).
+  push JOB [-f FILE] [-force]     Update the Job script from FILE, it fails if
+                                  the script is changed since the last pull.
+  trigger JOB [-ref REF] [-p K=V]... [-wait] [-logs] [-timeout 1h]
+                                  Trigger the Job, and wait for completion.
+  run [-f FILE] [-p K=V]... [-dir DIR] [-templates DIR]
+                                  Run the script locally without Master, each
+                                  Worker uses a numbered folder in DIR.
+  runners JOB [-limit 20]         List the latest Runners.
+  wait JOB RUNNER [-timeout 1h]   Wait for the Runner completion.
+  logs JOB RUNNER                 Print the logs until the Runner completion.
+  cancel JOB RUNNER               Cancel the Runner.
+  crons list JOB                  List cron triggers.
+  crons add JOB TYPE              Add a cron trigger.
+  crons remove JOB ID             Remove a cron trigger.
+  workers                         List connected Workers.
+  profile list                    List profiles.
+  profile set NAME -url URL [-token TOKEN] [-ca FILE] [-insecure]
+                                  Create or update a profile.
+  profile use NAME                Select the current profile.
+  profile delete NAME             Delete a profile.
+
+Exit codes: 0 success, 1 failure, 2 usage, 3 canceled, 4 timeout.
+`
+
+// errUsage indicates the arguments are incorrect.
+var errUsage = errors.New("incorrect arguments")
+
+// exitError returns the exit code of waiting a Runner.
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
+type cli struct {
+	profiles *Profiles
+	profile  string
+	json     bool
+	out      io.Writer
+}
+
+// Run executes the command line and returns the exit code.
+func Run(args []string) int {
+	c := &cli{out: os.Stdout}
+
+	fs := flag.NewFlagSet("bubble", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&c.profile, "profile", "", "")
+	output := fs.String("o", "text", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return EXITUSAGE
+	}
+	c.json = *output == "json"
+
+	err := c.run(fs.Arg(0), fs.Args()[1:])
+	switch e := err.(type) {
+	case nil:
+		return EXITSUCCESS
+	case *exitError:
+		fmt.Fprintln(os.Stderr, e.msg)
+		return e.code
+	default:
+		if err == errUsage || err == flag.ErrHelp {
+			fmt.Fprint(os.Stderr, usage)
+			return EXITUSAGE
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return EXITFAILURE
+	}
+}
+
+func (c *cli) run(cmd string, args []string) error {
+	var err error
+	if c.profiles, err = LoadProfiles(); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "profile":
+		return c.profileCmd(args)
+	case "jobs":
+		return c.jobs(args)
+	case "pull":
+		return c.pull(args)
+	case "push":
+		return c.push(args)
+	case "trigger":
+		return c.trigger(args)
+	case "run":
+		return c.runLocal(args)
+	case "runners":
+		return c.runners(args)
+	case "wait":
+		return c.wait(args)
+	case "logs":
+		return c.logs(args)
+	case "cancel":
+		return c.cancel(args)
+	case "crons":
+		return c.crons(args)
+	case "workers":
+		return c.workers(args)
+	}
+
+	return errUsage
+}
+
+func (c *cli) client() (IClient, error) {
+	p, err := c.profiles.Select(c.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(p)
+}
+
+// --- Commands ---
+
+func (c *cli) profileCmd(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	url := fs.String("url", "", "")
+	token := fs.String("token", "", "")
+	ca := fs.String("ca", "", "")
+	insecure := fs.Bool("insecure", false, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) == 0 {
+		return errUsage
+	}
+
+	switch {
+	case pos[0] == "list" && len(pos) == 1:
+		if c.json {
+			return c.print(c.profiles.Profiles)
+		}
+
+		w := c.table("", "NAME", "URL")
+		for _, n := range c.profiles.Names() {
+			current := ""
+			if n == c.profiles.Current {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, n, c.profiles.Profiles[n].URL)
+		}
+		return w.Flush()
+
+	case pos[0] == "set" && len(pos) == 2:
+		p, ok := c.profiles.Profiles[pos[1]]
+		if !ok {
+			if *url == "" {
+				return errors.New("-url is required for a new profile")
+			}
+			p = &Profile{}
+			c.profiles.Profiles[pos[1]] = p
+		}
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "url":
+				p.URL = *url
+			case "token":
+				p.Token = *token
+			case "ca":
+				p.CA = *ca
+			case "insecure":
+				p.Insecure = *insecure
+			}
+		})
+		if c.profiles.Current == "" {
+			c.profiles.Current = pos[1]
+		}
+		return c.profiles.Save()
+
+	case pos[0] == "use" && len(pos) == 2:
+		if _, ok := c.profiles.Profiles[pos[1]]; !ok {
+			return fmt.Errorf("profile [%s] is not exist", pos[1])
+		}
+		c.profiles.Current = pos[1]
+		return c.profiles.Save()
+
+	case pos[0] == "delete" && len(pos) == 2:
+		delete(c.profiles.Profiles, pos[1])
+		if c.profiles.Current == pos[1] {
+			c.profiles.Current = ""
+		}
+		return c.profiles.Save()
+	}
+
+	return errUsage
+}
+
+func (c *cli) jobs(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		jobs, err := cl.Jobs()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.print(jobs)
+		}
+		for _, j := range jobs {
+			fmt.Fprintln(c.out, j)
+		}
+		return nil
+
+	case args[0] == "create" && len(args) == 2:
+		return c.done(cl.CreateJob(args[1]), args[1])
+
+	case args[0] == "delete" && len(args) == 2:
+		return c.done(cl.DeleteJob(args[1]), args[1])
+	}
+
+	return errUsage
+}
+
+func (c *cli) pull(args []string) error {
+	fs := flag.NewFlagSet("pull", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	file := fs.String("f", SCRIPTFILE, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 1 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	script, etag, err := cl.Script(pos[0])
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(*file, script, 0644); err != nil {
+		return err
+	}
+
+	// Keep the ETag to detect others' changes when pushing.
+	if err = ioutil.WriteFile(etagFile(*file), []byte(etag), 0644); err != nil {
+		return err
+	}
+
+	return c.done(nil, map[string]string{"file": *file, "etag": etag})
+}
+
+func (c *cli) push(args []string) error {
+	fs := flag.NewFlagSet("push", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	file := fs.String("f", SCRIPTFILE, "")
+	force := fs.Bool("force", false, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 1 {
+		return errUsage
+	}
+
+	script, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	etag := ""
+	if !*force {
+		if bytes, err := ioutil.ReadFile(etagFile(*file)); err == nil {
+			etag = strings.TrimSpace(string(bytes))
+		}
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if etag, err = cl.SetScript(pos[0], script, etag); err != nil {
+		return err
+	}
+	if etag != "" {
+		ioutil.WriteFile(etagFile(*file), []byte(etag), 0644)
+	}
+
+	return c.done(nil, map[string]string{"job": pos[0], "etag": etag})
+}
+
+func (c *cli) trigger(args []string) error {
+	fs := flag.NewFlagSet("trigger", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	ref := fs.String("ref", "", "")
+	params := make(params)
+	fs.Var(params, "p", "")
+	wait := fs.Bool("wait", false, "")
+	logs := fs.Bool("logs", false, "")
+	timeout := fs.Duration("timeout", 0, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 1 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	id, err := cl.Trigger(pos[0], *ref, params)
+	if err != nil {
+		return err
+	}
+	if !*wait && !*logs {
+		return c.done(nil, map[string]string{"job": pos[0], "runner": id})
+	}
+	fmt.Fprintf(os.Stderr, "Runner [%s] of Job [%s] is triggered.\n", id, pos[0])
+
+	return c.await(cl, pos[0], id, *logs, *timeout)
+}
+
+func (c *cli) runLocal(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	file := fs.String("f", SCRIPTFILE, "")
+	params := make(params)
+	fs.Var(params, "p", "")
+	dir := fs.String("dir", RUNDIR, "")
+	templates := fs.String("templates", "", "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 0 {
+		return errUsage
+	}
+
+	script, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	action.SetRoot(root)
+	log.ReplaceLogger(log.Disabled)
+
+	l := &local{out: c.out, err: os.Stderr, workers: make(map[int]bool)}
+	cmds, status, err := master.RunLocal(master.NewTemplates(*templates), script, params, l)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		results := make([]*Command, len(cmds))
+		for i, cmd := range cmds {
+			results[i] = &Command{Index: i, Name: cmd.Name(), Alias: cmd.Alias(), Status: cmd.Status(), Measure: cmd.Measure()}
+		}
+		c.print(results)
+	}
+
+	msg := fmt.Sprintf("Script [%s] is %s.", *file, statusName(status))
+	switch status {
+	case def.SUCCESS, def.NOTSTART:
+		fmt.Fprintln(os.Stderr, msg)
+		return nil
+	case def.CANCEL, def.INTERRUPT:
+		return &exitError{code: EXITCANCEL, msg: msg}
+	}
+
+	return &exitError{code: EXITFAILURE, msg: msg}
+}
+
+func (c *cli) runners(args []string) error {
+	fs := flag.NewFlagSet("runners", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	limit := fs.Int("limit", 20, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 1 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	runners, err := cl.Runners(pos[0], *limit)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(runners)
+	}
+
+	w := c.table("RUNNER", "STATUS", "REVISION", "COMMANDS")
+	for _, r := range runners {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", r.ID, statusName(r.Status), r.Revision, len(r.Cmds))
+	}
+	return w.Flush()
+}
+
+func (c *cli) wait(args []string) error {
+	fs := flag.NewFlagSet("wait", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	timeout := fs.Duration("timeout", 0, "")
+	pos, err := parse(fs, args)
+	if err != nil || len(pos) != 2 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	return c.await(cl, pos[0], pos[1], false, *timeout)
+}
+
+func (c *cli) logs(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	return c.tail(cl, args[0], args[1])
+}
+
+func (c *cli) cancel(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	return c.done(cl.Cancel(args[0], args[1]), args[1])
+}
+
+func (c *cli) crons(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 2:
+		crons, err := cl.Crons(args[1])
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.print(crons)
+		}
+
+		w := c.table("ID", "TYPE")
+		for _, t := range crons {
+			fmt.Fprintf(w, "%s\t%d\n", t.ID, t.Type)
+		}
+		return w.Flush()
+
+	case args[0] == "add" && len(args) == 3:
+		var t int
+		if _, err := fmt.Sscanf(args[2], "%d", &t); err != nil {
+			return errUsage
+		}
+
+		cron, err := cl.AddCron(args[1], t)
+		return c.done(err, cron)
+
+	case args[0] == "remove" && len(args) == 3:
+		return c.done(cl.RemoveCron(args[1], args[2]), args[2])
+	}
+
+	return errUsage
+}
+
+func (c *cli) workers(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	workers, err := cl.Workers()
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(workers)
+	}
+
+	w := c.table("WORKER", "WORKLOAD")
+	for _, wk := range workers {
+		fmt.Fprintf(w, "%s\t%d\n", wk.ID, wk.Workload)
+	}
+	return w.Flush()
+}
+
+// --- Inner ---
+
+// await waits for the Runner completion by polling, or by following its
+// logs, and returns the exitError by the Runner status.
+func (c *cli) await(cl IClient, job string, id string, logs bool, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		if logs {
+			done <- c.tail(cl, job, id)
+			return
+		}
+
+		for {
+			r, err := cl.Runner(job, id)
+			if err != nil {
+				done <- err
+				return
+			}
+			if def.IsCompleted(r.Status) || r.Status == def.INTERRUPT {
+				done <- nil
+				return
+			}
+			time.Sleep(WAITINTERVAL)
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+	case <-expired:
+		return &exitError{code: EXITTIMEOUT, msg: fmt.Sprintf("Waiting Runner [%s] is timeout.", id)}
+	}
+
+	r, err := cl.Runner(job, id)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		c.print(r)
+	}
+
+	msg := fmt.Sprintf("Runner [%s] of Job [%s] is %s.", id, job, statusName(r.Status))
+	switch r.Status {
+	case def.SUCCESS:
+		fmt.Fprintln(os.Stderr, msg)
+		return nil
+	case def.CANCEL, def.INTERRUPT:
+		return &exitError{code: EXITCANCEL, msg: msg}
+	}
+
+	return &exitError{code: EXITFAILURE, msg: msg}
+}
+
+// tail prints the logs of all commands until the Runner is completed.
+func (c *cli) tail(cl IClient, job string, id string) error {
+	return cl.Stream(job, id, func(e *Event) error {
+		if c.json {
+			return json.NewEncoder(c.out).Encode(e)
+		}
+
+		switch e.Type {
+		case "log":
+			bytes, err := base64.StdEncoding.DecodeString(e.Data)
+			if err != nil {
+				return err
+			}
+			c.out.Write(bytes)
+		case "status":
+			fmt.Fprintf(os.Stderr, "--- Command [%d] is %s.\n", e.Index, statusName(e.Status))
+		}
+
+		return nil
+	})
+}
+
+// done prints the result of a mutation.
+func (c *cli) done(err error, v interface{}) error {
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(v)
+	}
+
+	fmt.Fprintln(c.out, "OK")
+	return nil
+}
+
+func (c *cli) print(v interface{}) error {
+	e := json.NewEncoder(c.out)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func (c *cli) table(columns ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	return w
+}
+
+// parse parses the flags before and after the positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	pos := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// params collects the repeated "-p key=value" flags.
+type params map[string]string
+
+func (p params) String() string {
+	return fmt.Sprint(map[string]string(p))
+}
+
+func (p params) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("param [%s] should be key=value", value)
+	}
+
+	p[kv[0]] = kv[1]
+	return nil
+}
+
+func etagFile(file string) string {
+	return file + ".etag"
+}
+
+func statusName(s def.STATUS) string {
+	switch s {
+	case def.NOTSTART:
+		return "not started"
+	case def.SUCCESS:
+		return "success"
+	case def.ONGOING:
+		return "ongoing"
+	case def.PENDING:
+		return "pending"
+	case def.FAILURE:
+		return "failure"
+	case def.CANCEL:
+		return "canceled"
+	case def.INTERRUPT:
+		return "interrupted"
+	case def.SKIPPED:
+		return "skipped"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+// IClient is the interface for the Master web API.
+type IClient interface {
+	// Jobs returns all Job names.
+	Jobs() ([]string, error)
+
+	// CreateJob creates a Job by name.
+	CreateJob(job string) error
+
+	// DeleteJob deletes a Job by name.
+	DeleteJob(job string) error
+
+	// Script returns the Job script and its ETag.
+	Script(job string) ([]byte, string, error)
+
+	// SetScript updates the Job script if etag matches (empty matches any),
+	// and returns the new ETag.
+	SetScript(job string, script []byte, etag string) (string, error)
+
+	// Trigger triggers the Job and returns the new Runner id.
+	Trigger(job string, ref string, params map[string]string) (string, error)
+
+	// Runners returns at most limit Runners from the newest.
+	Runners(job string, limit int) ([]*Runner, error)
+
+	// Runner returns the Runner by id.
+	Runner(job string, id string) (*Runner, error)
+
+	// Cancel cancels the Runner.
+	Cancel(job string, id string) error
+
+	// Stream calls f with the log and status events of the Runner until
+	// it's completed.
+	Stream(job string, id string, f func(e *Event) error) error
+
+	// Crons returns the cron triggers of the Job.
+	Crons(job string) ([]*Cron, error)
+
+	// AddCron adds a cron trigger of type to the Job.
+	AddCron(job string, t int) (*Cron, error)
+
+	// RemoveCron removes the cron trigger by id.
+	RemoveCron(job string, id string) error
+
+	// Workers returns the status of all connected Workers.
+	Workers() ([]*Worker, error)
+}
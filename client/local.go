@@ -0,0 +1,68 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"bubble/master"
+	"bubble/worker"
+	"bubble/worker/action"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// local executes Job commands in-process with the Worker Actions, each
+// simulated Worker uses the working directory numbered by itself.
+type local struct {
+	out     io.Writer
+	err     io.Writer
+	workers map[int]bool
+}
+
+func (l *local) Execute(cmd master.ICommand, w int, e env.IEnv) (def.STATUS, env.IEnv) {
+	l.prepare(w)
+	success, err := worker.ExecuteLocal(cmd.Name(), uint64(w), cmd.Script(), cmd.Variables(), cmd.Target(), e, l.out, l.err)
+	if err != nil {
+		fmt.Fprintln(l.err, err)
+	}
+	if !success {
+		return def.FAILURE, e
+	}
+
+	return def.SUCCESS, e
+}
+
+func (l *local) Transfer(from int, to int, disk string) error {
+	fmt.Fprintf(l.err, "--- Transfer disk [%s] from Worker [%d] to Worker [%d].\n", disk, from, to)
+	l.prepare(to)
+	return worker.TransferLocal(uint64(from), uint64(to), disk)
+}
+
+func (l *local) Notify(cmd master.ICommand, status def.STATUS, message string) {
+	if message != "" {
+		fmt.Fprintln(l.err, message)
+	}
+
+	if status == def.ONGOING {
+		fmt.Fprintf(l.err, "--- Command [%d] %s is started.\n", cmd.Index(), cmd.Alias())
+	} else {
+		fmt.Fprintf(l.err, "--- Command [%d] %s is %s.\n", cmd.Index(), cmd.Alias(), statusName(status))
+	}
+}
+
+// prepare cleans the working directory left by the last run when the
+// simulated Worker is used for the first time, like a new Runner.
+func (l *local) prepare(w int) {
+	if l.workers[w] {
+		return
+	}
+
+	l.workers[w] = true
+	os.RemoveAll(filepath.Join(action.Root(), strconv.FormatUint(uint64(w), 16)))
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Profiles of Masters are saved in PROFILEFILE under the home folder:
+//
+// ```yaml
+// current: prod
+// profiles:
+//  prod:
+//   url: https://bubble.example.com
+//   token: bbl_...
+//   ca: /etc/ssl/bubble.crt
+//  local:
+//   url: http://localhost
+// ```
+//
+// BUBBLE_PROFILE selects another profile, and BUBBLE_URL and BUBBLE_TOKEN
+// override the values of the selected one.
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// PROFILEFILE defines the profiles file path under the home folder.
+	PROFILEFILE string = ".bubble/config.yml"
+	// PROFILEENV defines the OS env name of the selected profile.
+	PROFILEENV string = "BUBBLE_PROFILE"
+	// URLENV defines the OS env name of the Master url.
+	URLENV string = "BUBBLE_URL"
+	// TOKENENV defines the OS env name of the API token.
+	TOKENENV string = "BUBBLE_TOKEN"
+)
+
+// Profile presents a Master and its credential.
+type Profile struct {
+	URL      string `yaml:"url" json:"url"`
+	Token    string `yaml:"token,omitempty" json:"-"`
+	CA       string `yaml:"ca,omitempty" json:"ca,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+// Profiles is the profiles file content.
+type Profiles struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// LoadProfiles loads the profiles file, it's empty if the file is missing.
+func LoadProfiles() (*Profiles, error) {
+	ps := &Profiles{Profiles: make(map[string]*Profile)}
+
+	file, err := profileFile()
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ps, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(bytes, ps); err != nil {
+		return nil, err
+	}
+	if ps.Profiles == nil {
+		ps.Profiles = make(map[string]*Profile)
+	}
+
+	return ps, nil
+}
+
+// Save writes the profiles file, which is only readable by the user.
+func (ps *Profiles) Save() error {
+	file, err := profileFile()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	bytes, err := yaml.Marshal(ps)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, bytes, 0600)
+}
+
+// Select returns the profile by name (the current one if it's empty) with
+// the OS env overrides.
+func (ps *Profiles) Select(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(PROFILEENV)
+	}
+	if name == "" {
+		name = ps.Current
+	}
+
+	p := &Profile{}
+	if name != "" {
+		v, ok := ps.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile [%s] is not exist", name)
+		}
+		*p = *v
+	}
+
+	if v := os.Getenv(URLENV); v != "" {
+		p.URL = v
+	}
+	if v := os.Getenv(TOKENENV); v != "" {
+		p.Token = v
+	}
+
+	return p, nil
+}
+
+// Names returns all profile names.
+func (ps *Profiles) Names() []string {
+	names := make([]string, 0, len(ps.Profiles))
+	for n := range ps.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func profileFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, PROFILEFILE), nil
+}
@@ -6,10 +6,9 @@ package cron
 
 import (
 	"bubble/def"
+	"bubble/store"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"sync"
 	"time"
 
@@ -19,9 +18,9 @@ import (
 // JobFunc to create a target ICronJob instance.
 type JobFunc func() ICronJob
 
-// NewCron create a new ICron.
-func NewCron(f JobFunc, file string) ICron {
-	c := &cron{f: f, file: file}
+// NewCron create a new ICron with the stats kept in the store by key.
+func NewCron(f JobFunc, s store.IStore, key string) ICron {
+	c := &cron{f: f, store: s, key: key}
 	c.load()
 
 	return c
@@ -29,7 +28,8 @@ func NewCron(f JobFunc, file string) ICron {
 
 type cron struct {
 	f             JobFunc
-	file          string
+	store         store.IStore
+	key           string
 	triggerLocker sync.Mutex
 	triggers      map[uint64]*trigger
 }
@@ -56,7 +56,7 @@ func (c *cron) Flush() {
 		return
 	}
 
-	if err = ioutil.WriteFile(c.file, bytes, os.ModePerm); err != nil {
+	if err = c.store.Put(c.key, bytes); err != nil {
 		log.Error(err)
 	}
 }
@@ -102,13 +102,8 @@ func (c *cron) Destroy() {
 
 func (c *cron) load() {
 	c.triggers = make(map[uint64]*trigger)
-	_, err := os.Stat(c.file)
+	bytes, err := c.store.Get(c.key)
 	if err == nil {
-		bytes, err := ioutil.ReadFile(c.file)
-		if err != nil {
-			return
-		}
-
 		var stats map[uint64]*triggerStat
 		if err = json.Unmarshal(bytes, &stats); err != nil {
 			return
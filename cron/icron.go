@@ -24,7 +24,7 @@ type ICron interface {
 	// StartAll will start all triggers of the Cron.
 	StartAll()
 
-	// Flush the stats into file.
+	// Flush the stats into store.
 	Flush()
 
 	// Add a new Trigger by type.
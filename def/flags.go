@@ -0,0 +1,82 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package def
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TakeFlags removes the named flags like "-name value" or "--name=value"
+// from args, and returns their values with the rest args, so the rest
+// could be passed to the service framework.
+func TakeFlags(args []string, names ...string) (map[string]string, []string) {
+	values := make(map[string]string)
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			rest = append(rest, arg)
+			continue
+		}
+
+		value, inline := "", false
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			name, value, inline = name[:j], name[j+1:], true
+		}
+
+		if !contains(names, name) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !inline && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		values[name] = value
+	}
+
+	return values, rest
+}
+
+// FirstOf returns the first non-empty value.
+func FirstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// ExeDir returns the folder of the executable, which is the default folder
+// of data.
+func ExeDir() string {
+	ext, _ := os.Executable()
+	return filepath.Dir(ext)
+}
+
+// Abs returns the path if it's absolute, or joins it to base.
+func Abs(base string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(base, path)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,6 +5,10 @@
 package def
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/giant-tech/go-service/framework/idata"
 	"github.com/sony/sonyflake"
 )
@@ -16,15 +20,24 @@ const (
 
 // NextUid generates a new unique ID of uint64 type.
 func NextUid() (uint64, error) {
+	once.Do(func() {
+		var st sonyflake.Settings
+		uid = sonyflake.NewSonyflake(st)
+	})
+	if uid == nil {
+		return 0, errors.New("sonyflake not created")
+	}
+
 	return uid.NextID()
 }
 
-var uid *sonyflake.Sonyflake
-
-func init() {
-	var st sonyflake.Settings
-	uid = sonyflake.NewSonyflake(st)
-	if uid == nil {
-		panic("sonyflake not created")
-	}
+// UidTime returns the time when the unique ID is generated.
+func UidTime(id uint64) time.Time {
+	elapsed := sonyflake.Decompose(id)["time"]
+	return time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(elapsed) * 10 * time.Millisecond)
 }
+
+var (
+	once sync.Once
+	uid  *sonyflake.Sonyflake
+)
@@ -0,0 +1,53 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package def
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MASKLINEMIN defines the min length of a line of a multi-line secret to be
+// masked alone, so lines like "{" or "-----" won't blank out other logs.
+const MASKLINEMIN int = 4
+
+// Masks returns the texts to mask for the secret values. Logs are masked
+// line by line, so every line of a multi-line value (e.g. a PEM key) with
+// at least MASKLINEMIN characters and a letter or digit is a mask as well.
+// Longer masks come first, so a whole value is replaced before its lines.
+func Masks(values ...string) []string {
+	masks := make([]string, 0, len(values))
+	exists := make(map[string]bool)
+	add := func(m string) {
+		if m != "" && !exists[m] {
+			exists[m] = true
+			masks = append(masks, m)
+		}
+	}
+
+	for _, v := range values {
+		add(v)
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				line = strings.TrimSpace(line)
+				if utf8.RuneCountInString(line) >= MASKLINEMIN && strings.IndexFunc(line, isAlnum) >= 0 {
+					add(line)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(masks, func(i, j int) bool {
+		return len(masks[i]) > len(masks[j])
+	})
+
+	return masks
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,31 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package def
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMasks(t *testing.T) {
+	cases := []struct {
+		values []string
+		expect []string
+	}{
+		{[]string{"token"}, []string{"token"}},
+		{[]string{"", "a", "a"}, []string{"a"}},
+		{[]string{"abcd\ncde\n"}, []string{"abcd\ncde\n", "abcd"}},
+		{[]string{"-----BEGIN-----\r\n  key1\r\n\r\n-----END-----"}, []string{"-----BEGIN-----\r\n  key1\r\n\r\n-----END-----", "-----BEGIN-----", "-----END-----", "key1"}},
+		{[]string{"{\n  \"key\": \"s3cret\",\n  \"n\": 1\n}"}, []string{"{\n  \"key\": \"s3cret\",\n  \"n\": 1\n}", "\"key\": \"s3cret\",", "\"n\": 1"}},
+		{[]string{"-----\nabc\n-----"}, []string{"-----\nabc\n-----"}},
+	}
+
+	for _, c := range cases {
+		masks := Masks(c.values...)
+		if !reflect.DeepEqual(masks, c.expect) {
+			t.Errorf("Masks %q expect %q, but actual %q", c.values, c.expect, masks)
+		}
+	}
+}
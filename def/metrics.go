@@ -0,0 +1,16 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package def
+
+// Metrics is the telemetry which Worker reports to Master by METRICS.
+type Metrics struct {
+	// Actions is the executing count of each Action.
+	Actions map[string]int `json:"actions"`
+	// Disk is the bytes of the jobs folder.
+	Disk int64 `json:"disk"`
+	// Sent and Received are the total bytes of disk transfer.
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
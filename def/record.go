@@ -0,0 +1,61 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package def
+
+type LEVEL uint8
+
+const (
+	DEBUG    LEVEL = 0
+	INFO     LEVEL = 1
+	WARN     LEVEL = 2
+	ERROR    LEVEL = 3
+	CRITICAL LEVEL = 4
+)
+
+type KIND uint8
+
+const (
+	// LINE is a log line of the current section.
+	LINE KIND = 0
+	// BEGIN starts a section.
+	BEGIN KIND = 1
+	// END ends a section with exit code and duration.
+	END KIND = 2
+)
+
+const (
+	STDOUT string = "stdout"
+	STDERR string = "stderr"
+)
+
+// Record is a structured log record sent from Worker to Master.
+type Record struct {
+	Kind     KIND   `json:"kind"`
+	Time     int64  `json:"time"`
+	Level    LEVEL  `json:"level"`
+	Stream   string `json:"stream,omitempty"`
+	Section  int    `json:"section"`
+	Text     string `json:"text,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Exit     int    `json:"exit,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Offset   int64  `json:"offset"`
+}
+
+// ParseLevel returns the level by name, and DEBUG for unknown names.
+func ParseLevel(name string) LEVEL {
+	switch name {
+	case "info":
+		return INFO
+	case "warn", "warning":
+		return WARN
+	case "error":
+		return ERROR
+	case "critical":
+		return CRITICAL
+	}
+
+	return DEBUG
+}
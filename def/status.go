@@ -14,10 +14,11 @@ const (
 	FAILURE   STATUS = 4
 	CANCEL    STATUS = 5
 	INTERRUPT STATUS = 6
+	SKIPPED   STATUS = 7
 )
 
 func IsCompleted(status STATUS) bool {
-	if status == SUCCESS || status == FAILURE || status == CANCEL {
+	if status == SUCCESS || status == FAILURE || status == CANCEL || status == SKIPPED {
 		return true
 	}
 
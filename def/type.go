@@ -8,4 +8,5 @@ type TYPE byte
 
 const (
 	WORKLOAD TYPE = 0x01
+	METRICS  TYPE = 0x02
 )
@@ -35,6 +35,21 @@ func (e *env) Format(code IAny) string {
 	return format
 }
 
+func (e *env) Eval(code string) (bool, error) {
+	tokens, err := scanExpr(code)
+	if err != nil {
+		return false, err
+	}
+
+	p := &exprParser{tokens: tokens, env: e}
+	v, err := p.parse()
+	if err != nil {
+		return false, err
+	}
+
+	return Truthy(v), nil
+}
+
 func (e *env) Get(name string) (IAny, error) {
 	if strings.HasPrefix(name, "$") {
 		name = name[1:]
@@ -54,6 +69,27 @@ func (e *env) Set(name string, value IAny) error {
 	return nil
 }
 
+func (e *env) Delete(name string) error {
+	if strings.HasPrefix(name, "$") {
+		name = name[1:]
+	}
+
+	delete(e.vars, strings.ToLower(name))
+	return nil
+}
+
+func (e *env) Strip(texts ...string) {
+	for k, v := range e.vars {
+		s := v.ToString()
+		for _, t := range texts {
+			if t != "" && strings.Contains(s, t) {
+				delete(e.vars, k)
+				break
+			}
+		}
+	}
+}
+
 func (e *env) GetFunc(name string) (MethodFunc, error) {
 	if strings.HasPrefix(name, "$") {
 		name = name[1:]
@@ -0,0 +1,415 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Condition expression support, like:
+//
+//   $_BRANCH == "main" && ($PLATFORM == "android" || failure(build))
+//
+// Operators by precedence from low to high: ||, &&, !, and the
+// comparisons ==, !=, <, <=, >, >=. Operands could be quoted strings,
+// numbers, true/false, $variables and function calls. A bare word which
+// is not a function call is treated as a string.
+
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CheckExpr validates the syntax of expression code without evaluating it.
+func CheckExpr(code string) error {
+	tokens, err := scanExpr(code)
+	if err != nil {
+		return err
+	}
+
+	p := &exprParser{tokens: tokens, env: nil}
+	_, err = p.parse()
+	return err
+}
+
+// Truthy returns whether the value is considered as true in expressions.
+func Truthy(v IAny) bool {
+	a, ok := v.(*any)
+	if !ok || a == nil {
+		return false
+	}
+
+	switch a.t {
+	case NIL, UNKNOWN:
+		return false
+	case BOOL:
+		return a.Bool()
+	case STRING:
+		s := strings.ToLower(strings.TrimSpace(a.String()))
+		return s != "" && s != "false" && s != "0"
+	case ARRAY:
+		return len(a.Array()) > 0
+	case MAP:
+		return len(a.Map()) > 0
+	}
+
+	return a.Float() != 0
+}
+
+type exprToken int
+
+const (
+	EXPR_END exprToken = iota
+	EXPR_STRING
+	EXPR_NUMBER
+	EXPR_IDENT
+	EXPR_VARIABLE
+	EXPR_OPERATOR
+	EXPR_LEFT
+	EXPR_RIGHT
+	EXPR_COMMA
+)
+
+type exprItem struct {
+	t exprToken
+	v string
+}
+
+func scanExpr(code string) ([]*exprItem, error) {
+	items := make([]*exprItem, 0)
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == SPACE || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == LEFT_BRACKET:
+			items = append(items, &exprItem{t: EXPR_LEFT, v: "("})
+			i++
+		case c == RIGHT_BRACKET:
+			items = append(items, &exprItem{t: EXPR_RIGHT, v: ")"})
+			i++
+		case c == COMMA:
+			items = append(items, &exprItem{t: EXPR_COMMA, v: ","})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(code[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("string is not closed at [%d] of expression [%s]", i, code)
+			}
+			items = append(items, &exprItem{t: EXPR_STRING, v: code[i+1 : i+1+end]})
+			i += end + 2
+		case strings.IndexByte("=!<>&|", c) >= 0:
+			op := string(c)
+			if i+1 < len(code) {
+				if two := code[i : i+2]; two == "==" || two == "!=" || two == "<=" || two == ">=" || two == "&&" || two == "||" {
+					op = two
+				}
+			}
+			if op == "=" || op == "&" || op == "|" {
+				return nil, fmt.Errorf("unknown operator [%s] at [%d] of expression [%s]", op, i, code)
+			}
+			items = append(items, &exprItem{t: EXPR_OPERATOR, v: op})
+			i += len(op)
+		case c == PREFIX:
+			j := i + 1
+			for j < len(code) && isExprName(code[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("variable name is missing at [%d] of expression [%s]", i, code)
+			}
+			items = append(items, &exprItem{t: EXPR_VARIABLE, v: code[i+1 : j]})
+			i = j
+		case isExprName(c) || c == '-':
+			j := i + 1
+			for j < len(code) && isExprName(code[j]) {
+				j++
+			}
+			v := code[i:j]
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				items = append(items, &exprItem{t: EXPR_NUMBER, v: v})
+			} else {
+				items = append(items, &exprItem{t: EXPR_IDENT, v: v})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected char [%c] at [%d] of expression [%s]", c, i, code)
+		}
+	}
+
+	return append(items, &exprItem{t: EXPR_END}), nil
+}
+
+func isExprName(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || NameExp.Match([]byte{c})
+}
+
+// exprParser is a recursive descent parser which evaluates the expression
+// while parsing. If env is nil, only the syntax will be checked.
+type exprParser struct {
+	tokens []*exprItem
+	pos    int
+	env    IEnv
+}
+
+func (p *exprParser) parse() (IAny, error) {
+	v, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.t != EXPR_END {
+		return nil, fmt.Errorf("unexpected token [%s] in expression", t.v)
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) peek() *exprItem {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() *exprItem {
+	t := p.tokens[p.pos]
+	if t.t != EXPR_END {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *exprParser) parseOr() (IAny, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.t == EXPR_OPERATOR && t.v == "||"; t = p.peek() {
+		p.next()
+		if p.env != nil && Truthy(l) {
+			if err = p.skip(p.parseAnd); err != nil {
+				return nil, err
+			}
+			l = NewAny(true)
+			continue
+		}
+
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l = NewAny(Truthy(r))
+	}
+
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (IAny, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.t == EXPR_OPERATOR && t.v == "&&"; t = p.peek() {
+		p.next()
+		if p.env != nil && !Truthy(l) {
+			if err = p.skip(p.parseNot); err != nil {
+				return nil, err
+			}
+			l = NewAny(false)
+			continue
+		}
+
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l = NewAny(Truthy(l) && Truthy(r))
+	}
+
+	return l, nil
+}
+
+// skip parses the operand without evaluating it, since the result is
+// already known, so only its syntax is checked.
+func (p *exprParser) skip(parse func() (IAny, error)) error {
+	e := p.env
+	p.env = nil
+	defer func() { p.env = e }()
+
+	_, err := parse()
+	return err
+}
+
+func (p *exprParser) parseNot() (IAny, error) {
+	if t := p.peek(); t.t == EXPR_OPERATOR && t.v == "!" {
+		p.next()
+		v, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewAny(!Truthy(v)), nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (IAny, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.t != EXPR_OPERATOR || t.v == "&&" || t.v == "||" || t.v == "!" {
+		return l, nil
+	}
+	p.next()
+
+	r, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := compareAny(l, r)
+	switch t.v {
+	case "==":
+		return NewAny(ret == 0), nil
+	case "!=":
+		return NewAny(ret != 0), nil
+	case "<":
+		return NewAny(ret < 0), nil
+	case "<=":
+		return NewAny(ret <= 0), nil
+	case ">":
+		return NewAny(ret > 0), nil
+	default:
+		return NewAny(ret >= 0), nil
+	}
+}
+
+func (p *exprParser) parsePrimary() (IAny, error) {
+	t := p.next()
+	switch t.t {
+	case EXPR_LEFT:
+		v, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if r := p.next(); r.t != EXPR_RIGHT {
+			return nil, fmt.Errorf("expect [)] but actual [%s] in expression", r.v)
+		}
+
+		return v, nil
+	case EXPR_STRING:
+		return NewAny(t.v), nil
+	case EXPR_NUMBER:
+		f, _ := strconv.ParseFloat(t.v, 64)
+		return NewAny(f), nil
+	case EXPR_VARIABLE, EXPR_IDENT:
+		if p.peek().t == EXPR_LEFT {
+			return p.parseCall(t.v)
+		}
+
+		if t.t == EXPR_IDENT {
+			switch strings.ToLower(t.v) {
+			case "true":
+				return NewAny(true), nil
+			case "false":
+				return NewAny(false), nil
+			}
+
+			return NewAny(t.v), nil
+		}
+
+		if p.env == nil {
+			return NewAny(nil), nil
+		}
+
+		v, err := p.env.Get(t.v)
+		if err != nil {
+			// Unknown variable is treated as nil.
+			return NewAny(nil), nil
+		}
+
+		return v, nil
+	case EXPR_END:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected token [%s] in expression", t.v)
+}
+
+func (p *exprParser) parseCall(name string) (IAny, error) {
+	p.next()
+
+	args := make([]IAny, 0)
+	if p.peek().t == EXPR_RIGHT {
+		p.next()
+	} else {
+		for {
+			v, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+
+			t := p.next()
+			if t.t == EXPR_RIGHT {
+				break
+			} else if t.t != EXPR_COMMA {
+				return nil, fmt.Errorf("expect [,] or [)] but actual [%s] in expression", t.v)
+			}
+		}
+	}
+
+	if p.env == nil {
+		return NewAny(nil), nil
+	}
+
+	fn, err := p.env.GetFunc(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn(args...)
+}
+
+// compareAny compares two values as numbers if both are numeric,
+// otherwise as strings.
+func compareAny(l, r IAny) int {
+	lf, lok := toNumber(l)
+	rf, rok := toNumber(r)
+	if lok && rok {
+		switch {
+		case lf < rf:
+			return -1
+		case lf > rf:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(l.ToString(), r.ToString())
+}
+
+func toNumber(v IAny) (float64, bool) {
+	a, ok := v.(*any)
+	if !ok || a == nil {
+		return 0, false
+	}
+
+	switch a.t {
+	case NIL, UNKNOWN, BOOL, ARRAY, MAP:
+		return 0, false
+	case STRING:
+		f, err := strconv.ParseFloat(strings.TrimSpace(a.String()), 64)
+		return f, err == nil
+	}
+
+	return a.Float(), true
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	e := NewEnv()
+	e.Set("_BRANCH", NewAny("main"))
+	e.Set("PLATFORM", NewAny("android"))
+	e.Set("COUNT", NewAny(3))
+	e.SetFunc("failure", func(args ...IAny) (IAny, error) {
+		return NewAny(len(args) > 0 && args[0].ToString() == "build"), nil
+	})
+
+	cases := []struct {
+		code   string
+		expect bool
+	}{
+		{`$_BRANCH == "main"`, true},
+		{`$_BRANCH == 'dev'`, false},
+		{`$_BRANCH == "main" && $PLATFORM == "android"`, true},
+		{`$_BRANCH == "main" && $PLATFORM == "ios"`, false},
+		{`$_BRANCH == "dev" || $PLATFORM == "android"`, true},
+		{`!($_BRANCH == "dev")`, true},
+		{`$COUNT > 2`, true},
+		{`$COUNT <= 2`, false},
+		{`$COUNT == 3.0`, true},
+		{`$_ROUND($_ADD($COUNT, 1.6)) == 5`, true},
+		{`failure(build)`, true},
+		{`failure(test)`, false},
+		{`!failure(test) && $PLATFORM != "ios"`, true},
+		{`$UNKNOWN`, false},
+		{`$UNKNOWN == ""`, true},
+		{`true`, true},
+		{`false || 0`, false},
+		{`$PLATFORM`, true},
+	}
+
+	for _, c := range cases {
+		ret, err := e.Eval(c.code)
+		if err != nil {
+			t.Errorf("Eval [%s] failed: %s", c.code, err)
+			continue
+		}
+
+		if ret != c.expect {
+			t.Errorf("Eval [%s] expect [%t], but actual [%t]", c.code, c.expect, ret)
+		}
+	}
+}
+
+func TestCheckExpr(t *testing.T) {
+	cases := []struct {
+		code  string
+		valid bool
+	}{
+		{`$A == "x" && ($B || failure(c))`, true},
+		{`$A = "x"`, false},
+		{`$A == "x`, false},
+		{`($A == 1`, false},
+		{`$A == 1)`, false},
+		{`$ == 1`, false},
+		{`$A ==`, false},
+	}
+
+	for _, c := range cases {
+		err := CheckExpr(c.code)
+		if (err == nil) != c.valid {
+			t.Errorf("CheckExpr [%s] expect valid [%t], but actual error [%v]", c.code, c.valid, err)
+		}
+	}
+}
+
+func TestEvalShortCircuit(t *testing.T) {
+	e := NewEnv()
+	e.Set("A", NewAny("x"))
+	calls := 0
+	e.SetFunc("fail", func(args ...IAny) (IAny, error) {
+		calls++
+		return nil, errors.New("fail is called")
+	})
+
+	cases := []struct {
+		code   string
+		expect bool
+		valid  bool
+		calls  int
+	}{
+		{`$F != "" && _READFILE($F)`, false, true, 0},
+		{`false && fail()`, false, true, 0},
+		{`$A == "y" && fail() && fail()`, false, true, 0},
+		{`true || fail()`, true, true, 0},
+		{`$A == "x" || fail() || fail()`, true, true, 0},
+		{`false && fail() || $A == "x"`, true, true, 0},
+		{`!(true || fail())`, false, true, 0},
+		{`false || fail()`, false, false, 1},
+		{`true && fail()`, false, false, 1},
+		{`false && (fail(`, false, false, 0},
+		{`true || $A ==`, false, false, 0},
+	}
+
+	for _, c := range cases {
+		calls = 0
+		ret, err := e.Eval(c.code)
+		if (err == nil) != c.valid {
+			t.Errorf("Eval [%s] expect valid [%t], but actual error [%v]", c.code, c.valid, err)
+			continue
+		}
+		if ret != c.expect {
+			t.Errorf("Eval [%s] expect [%t], but actual [%t]", c.code, c.expect, ret)
+		}
+		if calls != c.calls {
+			t.Errorf("Eval [%s] expect [%d] calls, but actual [%d]", c.code, c.calls, calls)
+		}
+	}
+}
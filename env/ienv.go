@@ -12,12 +12,21 @@ type IEnv interface {
 	// Format code with variable value if there are variables in code.
 	Format(code IAny) string
 
+	// Eval evaluates the condition expression code and returns the result.
+	Eval(code string) (bool, error)
+
 	// Get target name variable.
 	Get(name string) (IAny, error)
 
 	// Set target name variable with value.
 	Set(name string, value IAny) error
 
+	// Delete target name variable.
+	Delete(name string) error
+
+	// Strip deletes all variables whose values contain any of the texts.
+	Strip(texts ...string)
+
 	// GetFunc try to get target func.
 	GetFunc(name string) (MethodFunc, error)
 
@@ -135,7 +135,8 @@ func LexValueState(l *lexer) LexState {
 func LexPrefixState(l *lexer) LexState {
 	for ; l.pos < len(l.input); l.pos++ {
 		c := l.input[l.pos]
-		if !NameExp.Match([]byte{c}) {
+		// Dot is allowed in the middle of name for namespaced variable, like "$build.version".
+		if !NameExp.Match([]byte{c}) && !(c == DOT && l.pos > l.start+1) {
 			if l.pos == l.start {
 				return LexValueState
 			} else {
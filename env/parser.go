@@ -4,6 +4,10 @@
 
 package env
 
+import (
+	"strings"
+)
+
 type NodeType int
 
 const (
@@ -185,11 +189,18 @@ type variable struct {
 
 func (v *variable) Execute(env IEnv) string {
 	ret, err := env.Get(v.name)
-	if err != nil {
-		return v.name
+	if err == nil {
+		return ret.ToString()
 	}
 
-	return ret.ToString()
+	// Try the shorter name before dot for the case like "$NAME.zip".
+	for i := strings.LastIndexByte(v.name, DOT); i > 0; i = strings.LastIndexByte(v.name[:i], DOT) {
+		if ret, err = env.Get(v.name[:i]); err == nil {
+			return ret.ToString() + v.name[i:]
+		}
+	}
+
+	return v.name
 }
 
 func (v *variable) Push(x INode) INode {
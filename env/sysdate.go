@@ -5,11 +5,15 @@
 package env
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func init() {
-	regMethod("_DATE", _Date)
+	regMethod("_DATE", _Date, "_DATE(format?)", "Returns the current local date, formatted with Go layout (default 2006-01-02).")
+	regMethod("_NOW", _Now, "_NOW(format?, zone?, offset?)", "Returns the current time in zone (like UTC or Asia/Shanghai) shifted by offset (like -24h, +7d, 1h30m).")
 }
 
 func _Date(args ...IAny) (IAny, error) {
@@ -19,3 +23,61 @@ func _Date(args ...IAny) (IAny, error) {
 	}
 	return NewAny(time.Now().Format(format)), nil
 }
+
+func _Now(args ...IAny) (IAny, error) {
+	format := "2006-01-02 15:04:05"
+	if len(args) > 0 && args[0].ToString() != "" {
+		format = args[0].ToString()
+	}
+
+	now := time.Now()
+	if len(args) > 1 && args[1].ToString() != "" {
+		loc, err := time.LoadLocation(args[1].ToString())
+		if err != nil {
+			return NewAny(""), err
+		}
+		now = now.In(loc)
+	}
+
+	if len(args) > 2 && args[2].ToString() != "" {
+		d, err := parseOffset(args[2].ToString())
+		if err != nil {
+			return NewAny(""), err
+		}
+		now = now.Add(d)
+	}
+
+	return NewAny(now.Format(format)), nil
+}
+
+// parseOffset parses duration string with extra day unit "d", like "+7d" or "-1d12h".
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	var total time.Duration
+	if i := strings.Index(s, "d"); i >= 0 {
+		days, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("offset [%s] is invalid", s)
+		}
+		total += time.Duration(days * float64(24*time.Hour))
+		s = s[i+1:]
+	}
+
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+
+	return sign * total, nil
+}
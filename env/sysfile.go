@@ -0,0 +1,167 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	Describe("_SIZEOF", "_SIZEOF(file)", "Returns the size of file or directory in working directory.")
+	Describe("_MD5", "_MD5(file)", "Returns the MD5 hex code of file in working directory.")
+	Describe("_SHA256", "_SHA256(file)", "Returns the SHA256 hex code of file in working directory.")
+	Describe("_GLOB", "_GLOB(pattern, sep?)", "Returns all files matching pattern in working directory, joined with sep (default space).")
+	Describe("_FILEEXISTS", "_FILEEXISTS(file)", "Returns whether file exists in working directory.")
+	Describe("_READFILE", "_READFILE(file)", "Returns the content of file in working directory without trailing newlines.")
+}
+
+// SetFileFuncs registers file methods into env, and all relative file
+// paths are resolved against cwd.
+func SetFileFuncs(e IEnv, cwd string) {
+	f := &files{cwd: cwd}
+	e.SetFunc("_SIZEOF", f.SizeOf)
+	e.SetFunc("_MD5", f.Md5)
+	e.SetFunc("_SHA256", f.Sha256)
+	e.SetFunc("_GLOB", f.Glob)
+	e.SetFunc("_FILEEXISTS", f.Exists)
+	e.SetFunc("_READFILE", f.ReadFile)
+}
+
+type files struct {
+	cwd string
+}
+
+func (f *files) SizeOf(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(0), nil
+	}
+
+	return NewAny(f.calcSize(args[0].ToString())), nil
+}
+
+func (f *files) Md5(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	return f.hash(args[0].ToString(), md5.New())
+}
+
+func (f *files) Sha256(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	return f.hash(args[0].ToString(), sha256.New())
+}
+
+func (f *files) Glob(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	sep := " "
+	if len(args) > 1 {
+		sep = args[1].ToString()
+	}
+
+	matches, err := filepath.Glob(f.abs(args[0].ToString()))
+	if err != nil {
+		return NewAny(""), err
+	}
+
+	rels := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if rel, err := filepath.Rel(f.cwd, m); err == nil {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(rels)
+
+	return NewAny(strings.Join(rels, sep)), nil
+}
+
+func (f *files) Exists(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(false), nil
+	}
+
+	_, err := os.Stat(f.abs(args[0].ToString()))
+	return NewAny(err == nil), nil
+}
+
+func (f *files) ReadFile(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	bytes, err := ioutil.ReadFile(f.abs(args[0].ToString()))
+	if err != nil {
+		return NewAny(""), err
+	}
+
+	return NewAny(strings.TrimRight(string(bytes), "\r\n")), nil
+}
+
+func (f *files) abs(p string) string {
+	if path.IsAbs(p) || filepath.IsAbs(p) {
+		return p
+	}
+
+	return path.Join(f.cwd, p)
+}
+
+func (f *files) hash(p string, h hash.Hash) (IAny, error) {
+	file, err := os.Open(f.abs(p))
+	if err != nil {
+		return NewAny(""), err
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(h, file); err != nil {
+		return NewAny(""), err
+	}
+
+	return NewAny(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+func (f *files) calcSize(p string) int64 {
+	file, err := os.Open(f.abs(p))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+
+	if stat.IsDir() {
+		fs, err := file.Readdir(-1)
+		if err != nil {
+			return 0
+		}
+
+		var total int64
+		for _, i := range fs {
+			total += f.calcSize(p + "/" + i.Name())
+		}
+
+		return total
+	}
+
+	return stat.Size()
+}
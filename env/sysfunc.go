@@ -6,6 +6,7 @@ package env
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -18,10 +19,39 @@ func GetSysfunc(name string) (MethodFunc, error) {
 	return f, nil
 }
 
+// FuncInfo describes a method for listing.
+type FuncInfo struct {
+	Name  string `json:"name"`
+	Usage string `json:"usage"`
+	Desc  string `json:"desc"`
+}
+
+// Sysfuncs returns all described methods sorted by name.
+func Sysfuncs() []*FuncInfo {
+	infos := make([]*FuncInfo, 0, len(sysinfos))
+	for _, i := range sysinfos {
+		infos = append(infos, i)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Describe registers the usage of a method which is provided out of
+// the system methods, like the methods set by Actions.
+func Describe(name, usage, desc string) {
+	sysinfos[strings.ToLower(name)] = &FuncInfo{Name: name, Usage: usage, Desc: desc}
+}
+
 var (
 	sysfuncs map[string]MethodFunc = make(map[string]MethodFunc)
+	sysinfos map[string]*FuncInfo  = make(map[string]*FuncInfo)
 )
 
-func regMethod(name string, f MethodFunc) {
+func regMethod(name string, f MethodFunc, usage, desc string) {
 	sysfuncs[strings.ToLower(name)] = f
+	Describe(name, usage, desc)
 }
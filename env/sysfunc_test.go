@@ -5,6 +5,10 @@
 package env
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
 	"testing"
 	"time"
 )
@@ -98,3 +102,161 @@ func TestRound(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestStringFuncs(t *testing.T) {
+	cases := []struct {
+		name   string
+		args   []interface{}
+		expect string
+	}{
+		{"_UPPER", []interface{}{"abc"}, "ABC"},
+		{"_LOWER", []interface{}{"AbC"}, "abc"},
+		{"_REPLACE", []interface{}{"a-b-c", "-", "_"}, "a_b_c"},
+		{"_SPLIT", []interface{}{"a,b,c", ",", 1}, "b"},
+		{"_SPLIT", []interface{}{"a,b,c", ",", -1}, "c"},
+		{"_SPLIT", []interface{}{"a,b,c", ","}, "[a,b,c]"},
+		{"_JOIN", []interface{}{"-", "a", "b", "c"}, "a-b-c"},
+		{"_JOIN", []interface{}{"+", []interface{}{"a", "b"}}, "a+b"},
+		{"_SUBSTR", []interface{}{"abcdef", 2}, "cdef"},
+		{"_SUBSTR", []interface{}{"abcdef", 1, 3}, "bcd"},
+		{"_SUBSTR", []interface{}{"abcdef", -2}, "ef"},
+		{"_SUBSTR", []interface{}{"abcdef", 10}, ""},
+		{"_TRIM", []interface{}{"  abc \n"}, "abc"},
+		{"_TRIM", []interface{}{"--abc--", "-"}, "abc"},
+		{"_BASENAME", []interface{}{"a/b/c.zip"}, "c.zip"},
+		{"_BASENAME", []interface{}{"a\\b\\c.zip", ".zip"}, "c"},
+		{"_DIRNAME", []interface{}{"a/b/c.zip"}, "a/b"},
+		{"_JOINPATH", []interface{}{"a", "b/", "c.zip"}, "a/b/c.zip"},
+		{"_JSON", []interface{}{`{"a": {"b": [1, {"c": "x"}]}}`, "a.b[1].c"}, "x"},
+		{"_JSON", []interface{}{`{"version": "1.2.3"}`, "version"}, "1.2.3"},
+	}
+
+	for _, c := range cases {
+		f, err := GetSysfunc(c.name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		args := make([]IAny, len(c.args))
+		for i, a := range c.args {
+			args[i] = NewAny(a)
+		}
+
+		ret, err := f(args...)
+		if err != nil {
+			t.Errorf("%s%v failed: %s", c.name, c.args, err)
+			continue
+		}
+
+		if ret.ToString() != c.expect {
+			t.Errorf("%s%v expect [%s], but actual [%s]", c.name, c.args, c.expect, ret.ToString())
+		}
+	}
+}
+
+func TestEnvFunc(t *testing.T) {
+	os.Setenv("BUBBLE_TEST_ENV", "bubble")
+	e := NewEnv()
+
+	// It's not available until registered.
+	if _, err := GetSysfunc("_ENV"); err == nil {
+		t.Errorf("Method [_ENV] expect not global, but actual found")
+	}
+	if ret := e.Format(NewAny("$_ENV(BUBBLE_TEST_ENV)")); strings.Contains(ret, "bubble") {
+		t.Errorf("Expect no OS env, but actual [%s]", ret)
+	}
+
+	SetOSFuncs(e)
+	ret := e.Format(NewAny("$_ENV(BUBBLE_TEST_ENV)-$_ENV(BUBBLE_TEST_NONE,none)"))
+	if ret != "bubble-none" {
+		t.Errorf("Expect [bubble-none], but actual [%s]", ret)
+	}
+}
+
+func TestNow(t *testing.T) {
+	f, err := GetSysfunc("_NOW")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args   []interface{}
+		offset time.Duration
+		layout string
+	}{
+		{[]interface{}{"2006-01-02", "UTC"}, 0, "2006-01-02"},
+		{[]interface{}{"2006-01-02", "UTC", "-1d"}, -24 * time.Hour, "2006-01-02"},
+		{[]interface{}{"2006-01-02 15", "UTC", "+1d2h"}, 26 * time.Hour, "2006-01-02 15"},
+	}
+
+	for _, c := range cases {
+		args := make([]IAny, len(c.args))
+		for i, a := range c.args {
+			args[i] = NewAny(a)
+		}
+
+		// The time may pass a boundary during the call, so the result
+		// could be formatted from the time before or after it.
+		before := time.Now().UTC().Add(c.offset).Format(c.layout)
+		ret, err := f(args...)
+		after := time.Now().UTC().Add(c.offset).Format(c.layout)
+		if err != nil {
+			t.Errorf("_NOW%v failed: %s", c.args, err)
+		} else if s := ret.ToString(); s != before && s != after {
+			t.Errorf("_NOW%v expect [%s], but actual [%s]", c.args, before, s)
+		}
+	}
+
+	if _, err = f(NewAny(""), NewAny("Unknown/Zone")); err == nil {
+		t.Error("Expect error for unknown zone")
+	}
+}
+
+func TestFileFuncs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bubble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(path.Join(dir, "a.txt"), []byte("1.0.0\n"), os.ModePerm)
+	ioutil.WriteFile(path.Join(dir, "b.txt"), []byte("bubble"), os.ModePerm)
+
+	e := NewEnv()
+	SetFileFuncs(e, dir)
+
+	cases := []struct {
+		code   string
+		expect string
+	}{
+		{"$_READFILE(a.txt)", "1.0.0"},
+		{"$_FILEEXISTS(a.txt)", "true"},
+		{"$_FILEEXISTS(c.txt)", "false"},
+		{"$_SIZEOF(b.txt)", "6"},
+		{"$_GLOB(*.txt)", "a.txt b.txt"},
+		{"$_GLOB(*.txt,;)", "a.txt;b.txt"},
+		{"$_MD5(b.txt)", "a3fa9e0b6b24b1cada4b756c0d240444"},
+		{"$_SHA256(b.txt)", "df4ac416257333cf770e5b162da9c2a06b37e428d0a4035ec3a0f114df08d231"},
+	}
+
+	for _, c := range cases {
+		ret := e.Format(NewAny(c.code))
+		if ret != c.expect {
+			t.Errorf("Format [%s] expect [%s], but actual [%s]", c.code, c.expect, ret)
+		}
+	}
+}
+
+func TestSysfuncsList(t *testing.T) {
+	names := make(map[string]bool)
+	for _, i := range Sysfuncs() {
+		names[i.Name] = true
+	}
+
+	for _, n := range []string{"_ADD", "_DATE", "_NOW", "_UPPER", "_JSON", "_SIZEOF", "_GLOB"} {
+		if !names[n] {
+			t.Errorf("Method [%s] is not listed", n)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	regMethod("_JSON", _Json, "_JSON(data, path)", "Extracts the value at path (like a.b[0].c) from JSON data.")
+}
+
+func _Json(args ...IAny) (IAny, error) {
+	if len(args) < 2 {
+		return NewAny(nil), nil
+	}
+
+	// JSON is a subset of YAML, so parse it with YAML to get the same
+	// structure as other IAny values.
+	var data interface{}
+	if err := yaml.Unmarshal([]byte(args[0].ToString()), &data); err != nil {
+		return NewAny(nil), err
+	}
+
+	v, err := jsonPath(data, args[1].ToString())
+	if err != nil {
+		return NewAny(nil), err
+	}
+
+	return NewAny(v), nil
+}
+
+func jsonPath(data interface{}, p string) (interface{}, error) {
+	p = strings.Replace(strings.Replace(p, "[", ".", -1), "]", "", -1)
+	for _, key := range strings.Split(p, ".") {
+		if key == "" || key == "$" {
+			continue
+		}
+
+		switch node := data.(type) {
+		case map[interface{}]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("key [%s] is not exist", key)
+			}
+			data = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("index [%s] is out of range", key)
+			}
+			data = node[i]
+		default:
+			return nil, fmt.Errorf("can't find [%s] in a value", key)
+		}
+	}
+
+	return data, nil
+}
@@ -10,13 +10,13 @@ import (
 )
 
 func init() {
-	regMethod("_ADD", _Add)
-	regMethod("_SUB", _Sub)
-	regMethod("_MUL", _Mul)
-	regMethod("_DIV", _Div)
-	regMethod("_ROUND", _Round)
-	regMethod("_CEIL", _Ceil)
-	regMethod("_FLOOR", _Floor)
+	regMethod("_ADD", _Add, "_ADD(x, y, ...)", "Returns the sum of all numbers.")
+	regMethod("_SUB", _Sub, "_SUB(x, y, ...)", "Returns x subtracting all following numbers.")
+	regMethod("_MUL", _Mul, "_MUL(x, y, ...)", "Returns the product of all numbers.")
+	regMethod("_DIV", _Div, "_DIV(x, y, ...)", "Returns x dividing by all following numbers.")
+	regMethod("_ROUND", _Round, "_ROUND(x)", "Returns the nearest integer of x.")
+	regMethod("_CEIL", _Ceil, "_CEIL(x)", "Returns the least integer greater than or equal to x.")
+	regMethod("_FLOOR", _Floor, "_FLOOR(x)", "Returns the greatest integer less than or equal to x.")
 }
 
 func _Add(args ...IAny) (IAny, error) {
@@ -0,0 +1,33 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"os"
+)
+
+func init() {
+	Describe("_ENV", "_ENV(name, default?)", "Returns the OS environment variable of Worker, or default if it's not set.")
+}
+
+// SetOSFuncs registers OS methods into env. They're only registered in the
+// Worker Action env, so scripts can't read the OS env of Master, like the
+// secrets master key.
+func SetOSFuncs(e IEnv) {
+	e.SetFunc("_ENV", _Env)
+}
+
+func _Env(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	v, ok := os.LookupEnv(args[0].ToString())
+	if !ok && len(args) > 1 {
+		return args[1], nil
+	}
+
+	return NewAny(v), nil
+}
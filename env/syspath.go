@@ -0,0 +1,50 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"path"
+	"strings"
+)
+
+func init() {
+	regMethod("_BASENAME", _Basename, "_BASENAME(p, ext?)", "Returns the last element of path p, with ext suffix removed if it's set.")
+	regMethod("_DIRNAME", _Dirname, "_DIRNAME(p)", "Returns all but the last element of path p.")
+	regMethod("_JOINPATH", _JoinPath, "_JOINPATH(x, y, ...)", "Joins all elements into a single path.")
+}
+
+func _Basename(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	base := path.Base(toSlash(args[0].ToString()))
+	if len(args) > 1 {
+		base = strings.TrimSuffix(base, args[1].ToString())
+	}
+
+	return NewAny(base), nil
+}
+
+func _Dirname(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	return NewAny(path.Dir(toSlash(args[0].ToString()))), nil
+}
+
+func _JoinPath(args ...IAny) (IAny, error) {
+	elems := make([]string, len(args))
+	for i, a := range args {
+		elems[i] = toSlash(a.ToString())
+	}
+
+	return NewAny(path.Join(elems...)), nil
+}
+
+func toSlash(p string) string {
+	return strings.Replace(p, "\\", "/", -1)
+}
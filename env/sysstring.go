@@ -0,0 +1,136 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package env
+
+import (
+	"strings"
+)
+
+func init() {
+	regMethod("_UPPER", _Upper, "_UPPER(s)", "Returns s with all letters mapped to upper case.")
+	regMethod("_LOWER", _Lower, "_LOWER(s)", "Returns s with all letters mapped to lower case.")
+	regMethod("_REPLACE", _Replace, "_REPLACE(s, old, new)", "Returns s with all old replaced by new.")
+	regMethod("_SPLIT", _Split, "_SPLIT(s, sep, index?)", "Splits s by sep, returns the item at index if it's set.")
+	regMethod("_JOIN", _Join, "_JOIN(sep, x, y, ...)", "Joins all items with sep.")
+	regMethod("_SUBSTR", _Substr, "_SUBSTR(s, start, length?)", "Returns the sub string from start (negative counts from end).")
+	regMethod("_TRIM", _Trim, "_TRIM(s, cutset?)", "Returns s with leading and trailing spaces (or chars in cutset) removed.")
+}
+
+func _Upper(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	return NewAny(strings.ToUpper(args[0].ToString())), nil
+}
+
+func _Lower(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	return NewAny(strings.ToLower(args[0].ToString())), nil
+}
+
+func _Replace(args ...IAny) (IAny, error) {
+	if len(args) < 3 {
+		if len(args) == 0 {
+			return NewAny(""), nil
+		}
+
+		return args[0], nil
+	}
+
+	return NewAny(strings.Replace(args[0].ToString(), args[1].ToString(), args[2].ToString(), -1)), nil
+}
+
+func _Split(args ...IAny) (IAny, error) {
+	if len(args) < 2 {
+		return NewAny(nil), nil
+	}
+
+	parts := strings.Split(args[0].ToString(), args[1].ToString())
+	if len(args) > 2 {
+		i := args[2].Int()
+		if i < 0 {
+			i += len(parts)
+		}
+
+		if i < 0 || i >= len(parts) {
+			return NewAny(""), nil
+		}
+
+		return NewAny(parts[i]), nil
+	}
+
+	arr := make([]interface{}, len(parts))
+	for i, p := range parts {
+		arr[i] = p
+	}
+
+	return NewAny(arr), nil
+}
+
+func _Join(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	items := make([]string, 0)
+	for _, a := range args[1:] {
+		if a.IsArr() {
+			for _, i := range a.Array() {
+				items = append(items, i.ToString())
+			}
+		} else {
+			items = append(items, a.ToString())
+		}
+	}
+
+	return NewAny(strings.Join(items, args[0].ToString())), nil
+}
+
+func _Substr(args ...IAny) (IAny, error) {
+	if len(args) < 2 {
+		if len(args) == 0 {
+			return NewAny(""), nil
+		}
+
+		return args[0], nil
+	}
+
+	runes := []rune(args[0].ToString())
+	start := args[1].Int()
+	if start < 0 {
+		start += len(runes)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes) {
+		start = len(runes)
+	}
+
+	end := len(runes)
+	if len(args) > 2 {
+		if l := args[2].Int(); l >= 0 && start+l < end {
+			end = start + l
+		}
+	}
+
+	return NewAny(string(runes[start:end])), nil
+}
+
+func _Trim(args ...IAny) (IAny, error) {
+	if len(args) == 0 {
+		return NewAny(""), nil
+	}
+
+	if len(args) > 1 {
+		return NewAny(strings.Trim(args[0].ToString(), args[1].ToString())), nil
+	}
+
+	return NewAny(strings.TrimSpace(args[0].ToString())), nil
+}
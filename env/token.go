@@ -25,6 +25,7 @@ const (
 	RIGHT_BRACKET = ')'
 	COMMA         = ','
 	SPACE         = ' '
+	DOT           = '.'
 )
 
 var (
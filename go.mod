@@ -4,6 +4,7 @@ go 1.12
 
 require (
 	github.com/cihub/seelog v0.0.0-20170130134532-f561c5e57575
+	github.com/garyburd/redigo v1.6.0
 	github.com/giant-tech/go-service v0.0.3
 	github.com/gorilla/mux v1.7.3
 	github.com/hpcloud/tail v1.0.0
@@ -11,6 +12,7 @@ require (
 	github.com/sony/sonyflake v1.0.0
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.4.0
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/net v0.0.0-20190724013045-ca1201d0de80 // indirect
 	gopkg.in/fsnotify.v1 v1.4.7 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
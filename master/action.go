@@ -7,6 +7,7 @@ package master
 import (
 	"bubble/def"
 	"bubble/env"
+	"encoding/json"
 	"fmt"
 	"sync"
 
@@ -23,6 +24,8 @@ func NewAction(worker *worker, name string, bytes []byte) (IAction, error) {
 
 	a := &action{worker: worker, name: name}
 	a.procs = make(map[uint64]ICtx)
+	a.running = make(map[uint64]bool)
+	a.orphans = make(map[uint64]*orphan)
 
 	if c.IsMap() {
 		m := c.Map()
@@ -48,6 +51,15 @@ type action struct {
 	prefer      []env.IAny
 	procsLocker sync.Mutex
 	procs       map[uint64]ICtx
+	running     map[uint64]bool
+	orphans     map[uint64]*orphan
+}
+
+// orphan is the result of a running Runner finished before it's adopted.
+type orphan struct {
+	status def.STATUS
+	env    env.IEnv
+	span   string
 }
 
 func (a *action) Target() []env.IAny {
@@ -59,7 +71,7 @@ func (a *action) Prefer() []env.IAny {
 }
 
 func (a *action) Execute(ctx ICtx) {
-	err := a.worker.Execute(a.name, ctx.ID(), ctx.LastWorker(), ctx.Disk(), ctx.Script(), ctx.Variables(), ctx.Target(), ctx.Env())
+	err := a.worker.Execute(a.name, ctx.ID(), ctx.LastWorker(), ctx.Disk(), ctx.Script(), ctx.Variables(), ctx.Target(), ctx.Env(), ctx.Secrets(), ctx.Span().Context())
 	if err != nil {
 		ctx.SetResult(def.FAILURE, ctx.Env())
 		return
@@ -70,6 +82,37 @@ func (a *action) Execute(ctx ICtx) {
 	a.procs[ctx.ID()] = ctx
 }
 
+// adoptable returns whether the Runner is reported running or finished
+// on the Worker, and not adopted yet.
+func (a *action) adoptable(runner uint64) bool {
+	a.procsLocker.Lock()
+	defer a.procsLocker.Unlock()
+
+	_, ok := a.orphans[runner]
+	return ok || a.running[runner]
+}
+
+func (a *action) Adopt(ctx ICtx) bool {
+	a.procsLocker.Lock()
+	defer a.procsLocker.Unlock()
+
+	if o, ok := a.orphans[ctx.ID()]; ok {
+		delete(a.orphans, ctx.ID())
+		delete(a.running, ctx.ID())
+		ctx.Span().Link(o.span)
+		ctx.SetResult(o.status, o.env)
+		return true
+	}
+
+	if !a.running[ctx.ID()] {
+		return false
+	}
+
+	delete(a.running, ctx.ID())
+	a.procs[ctx.ID()] = ctx
+	return true
+}
+
 func (a *action) Cancel(runner uint64) error {
 	err := a.worker.Cancel(a.name, runner)
 	if err != nil {
@@ -90,7 +133,7 @@ func (a *action) Cancel(runner uint64) error {
 	return nil
 }
 
-func (a *action) Finish(runner uint64, success bool, env env.IEnv) error {
+func (a *action) Finish(runner uint64, success bool, env env.IEnv, span string) error {
 	status := def.SUCCESS
 	if !success {
 		status = def.FAILURE
@@ -100,9 +143,18 @@ func (a *action) Finish(runner uint64, success bool, env env.IEnv) error {
 
 	proc, ok := a.procs[runner]
 	if !ok {
+		// Keep the result of a running Runner which will be adopted.
+		a.procsLocker.Lock()
+		defer a.procsLocker.Unlock()
+		if a.running[runner] {
+			a.orphans[runner] = &orphan{status: status, env: env, span: span}
+			return nil
+		}
+
 		return fmt.Errorf("runner [%d] is not exist", runner)
 	}
 
+	proc.Span().Link(span)
 	proc.SetResult(status, env)
 
 	a.procsLocker.Lock()
@@ -112,7 +164,7 @@ func (a *action) Finish(runner uint64, success bool, env env.IEnv) error {
 	return nil
 }
 
-func (a *action) Progress(runner uint64, payload []byte) error {
+func (a *action) Progress(runner uint64, payload []byte, span string) error {
 	log.Debugf("Action [%s] receive progress for Runner [%d].\n", a.name, runner)
 
 	proc, ok := a.procs[runner]
@@ -120,11 +172,50 @@ func (a *action) Progress(runner uint64, payload []byte) error {
 		return fmt.Errorf("runner [%d] is not exist", runner)
 	}
 
-	proc.Notify(def.ONGOING, payload)
+	proc.Span().Link(span)
+
+	// Payload is the records array, or raw text from old Workers.
+	records := make([]*def.Record, 0)
+	if len(payload) > 0 && payload[0] == '[' && json.Unmarshal(payload, &records) == nil {
+		proc.Record(records)
+	} else {
+		proc.Notify(def.ONGOING, payload)
+	}
 
 	return nil
 }
 
+// run marks the Runners running on the Worker before adopted.
+func (a *action) run(runners []uint64) {
+	a.procsLocker.Lock()
+	defer a.procsLocker.Unlock()
+
+	for _, r := range runners {
+		if _, ok := a.procs[r]; !ok {
+			a.running[r] = true
+		}
+	}
+}
+
+// keep interrupts the procs except the Runners still running on the
+// reconnected Worker.
+func (a *action) keep(runners []uint64) {
+	a.procsLocker.Lock()
+	defer a.procsLocker.Unlock()
+
+	running := make(map[uint64]bool)
+	for _, r := range runners {
+		running[r] = true
+	}
+
+	for id, p := range a.procs {
+		if !running[id] {
+			p.SetResult(def.INTERRUPT, p.Env())
+			delete(a.procs, id)
+		}
+	}
+}
+
 func (a *action) Destroy() {
 	a.procsLocker.Lock()
 	defer a.procsLocker.Unlock()
@@ -0,0 +1,156 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// The `approval` action runs on Master and pauses the Runner until it's
+// approved or rejected by web API, or fails when timeout:
+//
+// ```yaml
+// -
+//  action: approval
+//  script:
+//   - Upload to the store?
+//  approvers: [alice, bob]
+//  timeout: 24h
+// ```
+//
+// Any one of `approvers` could approve, and anyone could if it's not set.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// APPROVAL defines the action name to wait for manual approval.
+	APPROVAL string = "approval"
+)
+
+// Approval presents the decision of an approval command.
+type Approval struct {
+	Index    int    `json:"index"`
+	User     string `json:"user"`
+	Approved bool   `json:"approved"`
+	Comment  string `json:"comment,omitempty"`
+	Time     int64  `json:"time"`
+}
+
+// approval executes the `approval` command and returns its status.
+func (r *runner) approval(cmd *command, e env.IEnv) def.STATUS {
+	var timeout <-chan time.Time
+	if cmd.timeout != "" {
+		d, err := time.ParseDuration(cmd.timeout)
+		if err != nil {
+			cmd.Notify(def.FAILURE, []byte(fmt.Sprintf("Timeout [%s] is invalid: %s\n", cmd.timeout, err.Error())))
+			return def.FAILURE
+		}
+		timeout = time.After(d)
+	}
+
+	ch := make(chan *Approval, 1)
+	r.locker.Lock()
+	r.pending[cmd.index] = ch
+	r.locker.Unlock()
+
+	defer func() {
+		r.locker.Lock()
+		delete(r.pending, cmd.index)
+		r.locker.Unlock()
+	}()
+
+	msg := "Waiting for approval"
+	if s := cmd.Script(); s != nil && !s.IsNil() {
+		if s.IsArr() {
+			lines := make([]string, 0)
+			for _, l := range s.Array() {
+				lines = append(lines, e.Format(l))
+			}
+			msg = strings.Join(lines, "\n")
+		} else {
+			msg = e.Format(s)
+		}
+	}
+	if len(cmd.approvers) > 0 {
+		msg += fmt.Sprintf("\nApprovers: %s", strings.Join(cmd.approvers, ", "))
+	}
+	cmd.Notify(def.ONGOING, nil)
+	cmd.Notify(def.PENDING, []byte(msg+"\n"))
+
+	select {
+	case a := <-ch:
+		if a == nil {
+			cmd.Notify(def.CANCEL, []byte("Approval is canceled.\n"))
+			return def.CANCEL
+		}
+
+		r.locker.Lock()
+		r.approvals = append(r.approvals, a)
+		r.locker.Unlock()
+		r.save()
+
+		decision := "rejected"
+		status := def.FAILURE
+		if a.Approved {
+			decision = "approved"
+			status = def.SUCCESS
+		}
+
+		text := fmt.Sprintf("%s by [%s].", strings.Title(decision), a.User)
+		if a.Comment != "" {
+			text += " " + a.Comment
+		}
+		log.Infof("Job [%s] Runner [%x] command [%d] is %s by [%s].\n", r.job.name, r.id, cmd.index, decision, a.User)
+		cmd.Notify(status, []byte(text+"\n"))
+
+		return status
+	case <-timeout:
+		cmd.Notify(def.FAILURE, []byte(fmt.Sprintf("Approval is timeout after [%s].\n", cmd.timeout)))
+		return def.FAILURE
+	}
+}
+
+// Approve approves or rejects the waiting approval command at index.
+func (r *runner) Approve(index int, user string, approved bool, comment string) error {
+	if index < 0 || index >= len(r.cmds) {
+		return fmt.Errorf("runner index [%d] is out of range", index)
+	}
+
+	cmd := r.cmds[index].(*command)
+	if len(cmd.approvers) > 0 {
+		allowed := false
+		for _, a := range cmd.approvers {
+			if a == user {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("user [%s] is not an approver of command [%d]", user, index)
+		}
+	} else if user == "" {
+		return fmt.Errorf("approver user is not set")
+	}
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	ch, ok := r.pending[index]
+	if !ok {
+		return fmt.Errorf("command [%d] is not waiting for approval", index)
+	}
+
+	select {
+	case ch <- &Approval{Index: index, User: user, Approved: approved, Comment: comment, Time: time.Now().Unix()}:
+		return nil
+	default:
+		return fmt.Errorf("command [%d] has been decided", index)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// auth guards the web API with user accounts and roles when `auth` is set
+// in the web configure of master.yml:
+//
+// ```yaml
+// web:
+//  port: 80
+//  root: dist
+//  index: index.html
+//  auth:
+//   admin: admin        # the first admin user created if there is no user.
+//   password: secret    # or BUBBLE_ADMIN_PASSWORD, random if both not set.
+//   session: 24h
+// ```
+//
+// Requests are authenticated by the portal session cookie, or by
+// "Authorization: Bearer <token>" with a session or API token. A viewer
+// could read, an operator could trigger, cancel, re-run and approve, and
+// an admin could change scripts, secrets, templates and users. Users could
+// have other roles in some Jobs. A write route not listed in permissions
+// needs an admin. All mutating requests are appended to AUDITFILE.
+
+package master
+
+import (
+	"bubble/env"
+	mweb "bubble/master/web"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/gorilla/mux"
+)
+
+// ROLE redefines int8 as user role type.
+type ROLE int8
+
+const (
+	// NOROLE defines the role of public routes.
+	NOROLE ROLE = 0
+	// VIEWER could read all.
+	VIEWER ROLE = 1
+	// OPERATOR could execute Jobs.
+	OPERATOR ROLE = 2
+	// ADMIN could change all.
+	ADMIN ROLE = 3
+)
+
+const (
+	// AUDITFILE defines the audit log file name.
+	AUDITFILE string = "audit.log"
+	// SESSIONTTL defines the default idle time before a session expires.
+	SESSIONTTL time.Duration = 24 * time.Hour
+	// ADMINPASSWORDENV defines the OS env name of the first admin password.
+	ADMINPASSWORDENV string = "BUBBLE_ADMIN_PASSWORD"
+)
+
+var roleNames = map[ROLE]string{
+	NOROLE:   "none",
+	VIEWER:   "viewer",
+	OPERATOR: "operator",
+	ADMIN:    "admin",
+}
+
+// ParseRole returns the role by name.
+func ParseRole(name string) (ROLE, error) {
+	for r, n := range roleNames {
+		if n == strings.ToLower(name) {
+			return r, nil
+		}
+	}
+
+	return NOROLE, fmt.Errorf("role [%s] should be viewer, operator or admin", name)
+}
+
+func (r ROLE) String() string {
+	return roleNames[r]
+}
+
+// MarshalText keeps the role name in JSON.
+func (r ROLE) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses the role name in JSON.
+func (r *ROLE) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = role
+	return nil
+}
+
+// permissions lists the routes which need other role than the default,
+// which is VIEWER for GET and ADMIN for others, so a new route changing
+// data is only open to admins until it's listed.
+var permissions = map[string]ROLE{
+	"GET " + mweb.BASEURL + "jobs/create/{job}":                                        ADMIN,
+	"DELETE " + mweb.BASEURL + "jobs/delete/{job}":                                     ADMIN,
+	"POST " + mweb.BASEURL + "jobs/{job}/script":                                       ADMIN,
+	"POST " + mweb.BASEURL + "jobs/{job}/repo":                                         ADMIN,
+	"GET " + mweb.BASEURL + "jobs/{job}/crons/add/{cron}":                              OPERATOR,
+	"GET " + mweb.BASEURL + "jobs/{job}/trigger":                                       OPERATOR,
+	"GET " + mweb.BASEURL + "jobs/{job}/cancel/{runner}":                               OPERATOR,
+	"GET " + mweb.BASEURL + "jobs/{job}/rerun/{runner}":                                OPERATOR,
+	"GET " + mweb.BASEURL + "jobs/{job}/rerun/{runner}/{index}":                        OPERATOR,
+	"POST " + mweb.BASEURL + "jobs/{job}/plan":                                         OPERATOR,
+	"POST " + mweb.BASEURL + "jobs/{job}/trigger":                                      OPERATOR,
+	"DELETE " + mweb.BASEURL + "jobs/{job}/crons/remove/{id}":                          OPERATOR,
+	"POST " + mweb.BASEURL + "jobs/{job}/approve/{runner}/{index}":                     OPERATOR,
+	"POST " + mweb.BASEURL + "jobs/{job}/reject/{runner}/{index}":                      OPERATOR,
+	"GET " + mweb.BASEURL + "secrets/list":                                             ADMIN,
+	"POST " + mweb.BASEURL + "secrets/set/{name}":                                      ADMIN,
+	"DELETE " + mweb.BASEURL + "secrets/delete/{name}":                                 ADMIN,
+	"POST " + mweb.BASEURL + "templates/{name}":                                        ADMIN,
+	"DELETE " + mweb.BASEURL + "templates/delete/{name}":                               ADMIN,
+	"GET " + mweb.BASEURL + "workers/enrolled":                                         ADMIN,
+	"POST " + mweb.BASEURL + "workers/enroll/{name}":                                   ADMIN,
+	"DELETE " + mweb.BASEURL + "workers/revoke/{name}":                                 ADMIN,
+	"GET " + mweb.BASEURL + "users/list":                                               ADMIN,
+	"POST " + mweb.BASEURL + "users/{name}":                                            ADMIN,
+	"DELETE " + mweb.BASEURL + "users/delete/{name}":                                   ADMIN,
+	"GET " + mweb.BASEURL + "audit":                                                    ADMIN,
+	"POST " + mweb.BASEURLV2 + "jobs":                                                  ADMIN,
+	"DELETE " + mweb.BASEURLV2 + "jobs/{job}":                                          ADMIN,
+	"PUT " + mweb.BASEURLV2 + "jobs/{job}/script":                                      ADMIN,
+	"PUT " + mweb.BASEURLV2 + "jobs/{job}/repo":                                        ADMIN,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/plan":                                       OPERATOR,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/runners":                                    OPERATOR,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/runners/{runner}/cancel":                    OPERATOR,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/runners/{runner}/rerun":                     OPERATOR,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/runners/{runner}/commands/{index}/approval": OPERATOR,
+	"POST " + mweb.BASEURLV2 + "jobs/{job}/triggers":                                   OPERATOR,
+	"DELETE " + mweb.BASEURLV2 + "jobs/{job}/triggers/{id}":                            OPERATOR,
+	"POST " + mweb.BASEURL + "auth/login":                                              NOROLE,
+	"POST " + mweb.BASEURL + "auth/logout":                                             NOROLE,
+	"POST " + mweb.BASEURL + "auth/tokens":                                             VIEWER,
+	"DELETE " + mweb.BASEURL + "auth/tokens/{id}":                                      VIEWER,
+}
+
+// newAuth creates the auth by configure, returns nil if it's not set.
+func newAuth(conf env.IAny, dir string) *auth {
+	if conf == nil || !conf.IsMap() {
+		log.Warn("Web API authentication is not enabled, set \"auth\" in web configure to enable it.")
+		return nil
+	}
+
+	m := conf.Map()
+	a := &auth{
+		users:    NewUsers(dir + "/" + USERSFILE),
+		ttl:      SESSIONTTL,
+		sessions: make(map[string]*session),
+		audit:    dir + "/" + AUDITFILE,
+	}
+	if v, ok := m["session"]; ok {
+		if d, err := time.ParseDuration(v.ToString()); err == nil && d > 0 {
+			a.ttl = d
+		} else {
+			log.Errorf("Session [%s] is invalid, use [%s].", v.ToString(), SESSIONTTL)
+		}
+	}
+
+	// Create the first admin.
+	if a.users.(*users).empty() {
+		name := "admin"
+		if v, ok := m["admin"]; ok && v.ToString() != "" {
+			name = v.ToString()
+		}
+
+		password := os.Getenv(ADMINPASSWORDENV)
+		if v, ok := m["password"]; ok && v.ToString() != "" {
+			password = v.ToString()
+		}
+		if password == "" {
+			password = randomHex(8)
+			log.Warnf("Admin user [%s] is created with password [%s], please change it.", name, password)
+		}
+
+		if err := a.users.Set(name, password, ADMIN, nil); err != nil {
+			log.Error(err)
+		}
+	}
+
+	return a
+}
+
+type session struct {
+	user   string
+	expire time.Time
+}
+
+type auth struct {
+	users    IUsers
+	ttl      time.Duration
+	locker   sync.Mutex
+	sessions map[string]*session
+	audit    string
+	auditing sync.Mutex
+}
+
+// guard wraps the route handler to check the role of the request user.
+func (a *auth) guard(path string, method string, f func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	required := requiredRole(path, method)
+	if required == NOROLE {
+		return f
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		user := a.identify(req)
+		if user == nil {
+			a.reject(w, http.StatusUnauthorized, "authentication is required")
+			return
+		}
+
+		// Some routes take the Job from the query, like search.
+		job := mux.Vars(req)["job"]
+		if job == "" {
+			job = req.URL.Query().Get("job")
+		}
+		if user.RoleOf(job) < required {
+			a.reject(w, http.StatusForbidden, fmt.Sprintf("user [%s] needs [%s] role", user.Name, required))
+			a.record(user.Name, req, http.StatusForbidden)
+			return
+		}
+
+		req = mweb.WithUser(req, user.Name)
+		if required == VIEWER && method == "GET" {
+			f(w, req)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		f(rec, req)
+		a.record(user.Name, req, rec.status)
+	}
+}
+
+// requiredRole returns the role which the route needs.
+func requiredRole(path string, method string) ROLE {
+	if r, ok := permissions[method+" "+path]; ok {
+		return r
+	}
+
+	if method == "GET" {
+		return VIEWER
+	}
+
+	return ADMIN
+}
+
+// login verifies the password and returns a new session token.
+func (a *auth) login(name string, password string, remote string) (string, error) {
+	u, err := a.users.Verify(name, password)
+	if err != nil {
+		a.write(&auditEntry{Time: time.Now().Unix(), User: name, Action: "LOGIN", Status: http.StatusUnauthorized, Remote: remote})
+		return "", err
+	}
+
+	token := randomHex(32)
+
+	a.locker.Lock()
+	now := time.Now()
+	for k, s := range a.sessions {
+		if now.After(s.expire) {
+			delete(a.sessions, k)
+		}
+	}
+	a.sessions[token] = &session{user: u.Name, expire: now.Add(a.ttl)}
+	a.locker.Unlock()
+
+	a.write(&auditEntry{Time: now.Unix(), User: name, Action: "LOGIN", Status: http.StatusOK, Remote: remote})
+	return token, nil
+}
+
+func (a *auth) logout(token string) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	delete(a.sessions, token)
+}
+
+// identify returns the user of the request session or API token.
+func (a *auth) identify(req *http.Request) *User {
+	token := mweb.Credential(req)
+	if token == "" {
+		return nil
+	}
+
+	a.locker.Lock()
+	s, ok := a.sessions[token]
+	if ok {
+		if time.Now().After(s.expire) {
+			delete(a.sessions, token)
+			ok = false
+		} else {
+			// Sliding expiration.
+			s.expire = time.Now().Add(a.ttl)
+		}
+	}
+	a.locker.Unlock()
+
+	if ok {
+		u, err := a.users.Get(s.user)
+		if err != nil {
+			return nil
+		}
+		return u
+	}
+
+	u, err := a.users.Resolve(token)
+	if err != nil {
+		return nil
+	}
+
+	return u
+}
+
+func (a *auth) reject(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": -1, "data": msg})
+}
+
+type auditEntry struct {
+	Time   int64  `json:"time"`
+	User   string `json:"user"`
+	Action string `json:"action"`
+	Status int    `json:"status"`
+	Remote string `json:"remote,omitempty"`
+}
+
+func (a *auth) record(user string, req *http.Request, status int) {
+	a.write(&auditEntry{
+		Time:   time.Now().Unix(),
+		User:   user,
+		Action: req.Method + " " + req.URL.RequestURI(),
+		Status: status,
+		Remote: req.RemoteAddr,
+	})
+}
+
+func (a *auth) write(e *auditEntry) {
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	a.auditing.Lock()
+	defer a.auditing.Unlock()
+
+	f, err := os.OpenFile(a.audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer f.Close()
+
+	f.Write(append(bytes, '\n'))
+}
+
+// entries returns the latest limit audit entries, the newest first.
+func (a *auth) entries(limit int) ([]*auditEntry, error) {
+	a.auditing.Lock()
+	bytes, err := ioutil.ReadFile(a.audit)
+	a.auditing.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	entries := make([]*auditEntry, 0)
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	for i := len(lines) - 1; i >= 0 && (limit <= 0 || len(entries) < limit); i-- {
+		e := &auditEntry{}
+		if json.Unmarshal([]byte(lines[i]), e) == nil {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps streaming responses working.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func randomHex(size int) string {
+	bytes := make([]byte, size)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
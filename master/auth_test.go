@@ -0,0 +1,351 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/env"
+	mweb "bubble/master/web"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// routing records the routes registered by the web controls.
+type routing struct {
+	mweb.IWebHandler
+	routes []string
+}
+
+func (r *routing) HandleFunc(path string, f func(http.ResponseWriter, *http.Request), method string) {
+	r.routes = append(r.routes, method+" "+path)
+}
+
+func (r *routing) HandleStatic(path string, f func(http.ResponseWriter, *http.Request)) {
+}
+
+func TestRequiredRole(t *testing.T) {
+	expected := map[string]ROLE{
+		"GET /api/v1/jobs/list":                                              VIEWER,
+		"GET /api/v1/jobs/create/{job}":                                      ADMIN,
+		"DELETE /api/v1/jobs/delete/{job}":                                   ADMIN,
+		"GET /api/v1/jobs/{job}/script":                                      VIEWER,
+		"POST /api/v1/jobs/{job}/script":                                     ADMIN,
+		"GET /api/v1/jobs/{job}/repo":                                        VIEWER,
+		"POST /api/v1/jobs/{job}/repo":                                       ADMIN,
+		"GET /api/v1/jobs/{job}/plan":                                        VIEWER,
+		"POST /api/v1/jobs/{job}/plan":                                       OPERATOR,
+		"GET /api/v1/jobs/{job}/crons/add/{cron}":                            OPERATOR,
+		"DELETE /api/v1/jobs/{job}/crons/remove/{id}":                        OPERATOR,
+		"GET /api/v1/jobs/{job}/crons/list":                                  VIEWER,
+		"GET /api/v1/jobs/{job}/trigger":                                     OPERATOR,
+		"POST /api/v1/jobs/{job}/trigger":                                    OPERATOR,
+		"GET /api/v1/jobs/{job}/list/{index}":                                VIEWER,
+		"GET /api/v1/jobs/{job}/cancel/{runner}":                             OPERATOR,
+		"GET /api/v1/jobs/{job}/rerun/{runner}":                              OPERATOR,
+		"GET /api/v1/jobs/{job}/rerun/{runner}/{index}":                      OPERATOR,
+		"POST /api/v1/jobs/{job}/approve/{runner}/{index}":                   OPERATOR,
+		"POST /api/v1/jobs/{job}/reject/{runner}/{index}":                    OPERATOR,
+		"GET /api/v1/jobs/{job}/log/{runner}/{index}/{full}":                 VIEWER,
+		"GET /api/v1/jobs/{job}/logs/{runner}/{index}":                       VIEWER,
+		"GET /api/v1/jobs/{job}/records/{runner}/{index}":                    VIEWER,
+		"GET /api/v1/jobs/{job}/stream/{runner}":                             VIEWER,
+		"GET /api/v1/search":                                                 VIEWER,
+		"GET /metrics":                                                       VIEWER,
+		"GET /api/v1/workers/monitor":                                        VIEWER,
+		"GET /api/v1/workers/enrolled":                                       ADMIN,
+		"POST /api/v1/workers/enroll/{name}":                                 ADMIN,
+		"DELETE /api/v1/workers/revoke/{name}":                               ADMIN,
+		"GET /api/v1/env/funcs":                                              VIEWER,
+		"GET /api/v1/secrets/list":                                           ADMIN,
+		"POST /api/v1/secrets/set/{name}":                                    ADMIN,
+		"DELETE /api/v1/secrets/delete/{name}":                               ADMIN,
+		"GET /api/v1/templates/list":                                         VIEWER,
+		"DELETE /api/v1/templates/delete/{name}":                             ADMIN,
+		"GET /api/v1/templates/{name}":                                       VIEWER,
+		"POST /api/v1/templates/{name}":                                      ADMIN,
+		"GET /api/v2/jobs":                                                   VIEWER,
+		"POST /api/v2/jobs":                                                  ADMIN,
+		"DELETE /api/v2/jobs/{job}":                                          ADMIN,
+		"GET /api/v2/jobs/{job}/script":                                      VIEWER,
+		"PUT /api/v2/jobs/{job}/script":                                      ADMIN,
+		"GET /api/v2/jobs/{job}/repo":                                        VIEWER,
+		"PUT /api/v2/jobs/{job}/repo":                                        ADMIN,
+		"POST /api/v2/jobs/{job}/plan":                                       OPERATOR,
+		"GET /api/v2/jobs/{job}/runners":                                     VIEWER,
+		"POST /api/v2/jobs/{job}/runners":                                    OPERATOR,
+		"GET /api/v2/jobs/{job}/runners/{runner}":                            VIEWER,
+		"POST /api/v2/jobs/{job}/runners/{runner}/cancel":                    OPERATOR,
+		"POST /api/v2/jobs/{job}/runners/{runner}/rerun":                     OPERATOR,
+		"GET /api/v2/jobs/{job}/runners/{runner}/commands":                   VIEWER,
+		"GET /api/v2/jobs/{job}/runners/{runner}/commands/{index}/log":       VIEWER,
+		"GET /api/v2/jobs/{job}/runners/{runner}/commands/{index}/records":   VIEWER,
+		"POST /api/v2/jobs/{job}/runners/{runner}/commands/{index}/approval": OPERATOR,
+		"GET /api/v2/jobs/{job}/triggers":                                    VIEWER,
+		"POST /api/v2/jobs/{job}/triggers":                                   OPERATOR,
+		"DELETE /api/v2/jobs/{job}/triggers/{id}":                            OPERATOR,
+		"GET /api/v2/workers":                                                VIEWER,
+		"GET /api/v2/openapi.json":                                           VIEWER,
+		"POST /api/v1/auth/login":                                            NOROLE,
+		"POST /api/v1/auth/logout":                                           NOROLE,
+		"GET /api/v1/auth/me":                                                VIEWER,
+		"POST /api/v1/auth/tokens":                                           VIEWER,
+		"DELETE /api/v1/auth/tokens/{id}":                                    VIEWER,
+		"GET /api/v1/users/list":                                             ADMIN,
+		"DELETE /api/v1/users/delete/{name}":                                 ADMIN,
+		"POST /api/v1/users/{name}":                                          ADMIN,
+		"GET /api/v1/audit":                                                  ADMIN,
+	}
+
+	r := &routing{}
+	for _, c := range []mweb.IWebControl{mweb.NewWebApi(), mweb.NewWebApiV2(), mweb.NewAuthApi()} {
+		c.Init(r)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range r.routes {
+		registered[route] = true
+		role, ok := expected[route]
+		if !ok {
+			t.Errorf("route [%s] is registered, but not expected", route)
+			continue
+		}
+
+		var method, p string
+		for i := range route {
+			if route[i] == ' ' {
+				method, p = route[:i], route[i+1:]
+				break
+			}
+		}
+		if actual := requiredRole(p, method); actual != role {
+			t.Errorf("route [%s] expect [%s], but actual [%s]", route, role, actual)
+		}
+	}
+
+	for route := range expected {
+		if !registered[route] {
+			t.Errorf("route [%s] is expected, but not registered", route)
+		}
+	}
+	for route := range permissions {
+		if !registered[route] {
+			t.Errorf("permission [%s] is not a registered route", route)
+		}
+	}
+
+	// Unlisted routes.
+	if actual := requiredRole("/api/v2/jobs/{job}/unlisted", "GET"); actual != VIEWER {
+		t.Errorf("unlisted GET expect [%s], but actual [%s]", VIEWER, actual)
+	}
+	for _, method := range []string{"POST", "PUT", "DELETE", "PATCH"} {
+		if actual := requiredRole("/api/v2/jobs/{job}/unlisted", method); actual != ADMIN {
+			t.Errorf("unlisted %s expect [%s], but actual [%s]", method, ADMIN, actual)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := newAuth(env.NewAny(map[interface{}]interface{}{"password": "secret"}), dir)
+	if err := a.users.Set("alice", "alice-pw", VIEWER, map[string]ROLE{"deploy": OPERATOR, "prod": NOROLE}); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := a.login("admin", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := a.login("alice", "alice-pw", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.users.CreateToken("alice", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path   string
+		method string
+		token  string
+		job    string
+		status int
+	}{
+		{"/api/v1/jobs/list", "GET", "", "", http.StatusUnauthorized},
+		{"/api/v1/jobs/list", "GET", "invalid", "", http.StatusUnauthorized},
+		{"/api/v1/auth/login", "POST", "", "", http.StatusOK},
+		{"/api/v1/jobs/list", "GET", alice, "", http.StatusOK},
+		{"/api/v1/jobs/list", "GET", token, "", http.StatusOK},
+		{"/api/v2/jobs/{job}/runners", "POST", alice, "build", http.StatusForbidden},
+		{"/api/v2/jobs/{job}/runners", "POST", alice, "deploy", http.StatusOK},
+		{"/api/v2/jobs/{job}/runners", "POST", token, "deploy", http.StatusOK},
+		{"/api/v2/jobs/{job}/runners", "GET", alice, "prod", http.StatusForbidden},
+		{"/api/v2/jobs/{job}", "DELETE", alice, "deploy", http.StatusForbidden},
+		{"/api/v2/jobs/{job}", "DELETE", admin, "deploy", http.StatusOK},
+		{"/api/v2/jobs/{job}/unlisted", "GET", alice, "build", http.StatusOK},
+		{"/api/v2/jobs/{job}/unlisted", "POST", alice, "deploy", http.StatusForbidden},
+		{"/api/v2/jobs/{job}/unlisted", "POST", admin, "deploy", http.StatusOK},
+		{"/api/v1/secrets/list", "GET", alice, "", http.StatusForbidden},
+		{"/api/v1/secrets/list", "GET", admin, "", http.StatusOK},
+		{"/api/v1/search?job=prod", "GET", alice, "", http.StatusForbidden},
+		{"/api/v1/search?job=build", "GET", alice, "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		route := strings.Split(c.path, "?")[0]
+		f := a.guard(route, c.method, func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.job != "" {
+			req = mux.SetURLVars(req, map[string]string{"job": c.job})
+		}
+
+		w := httptest.NewRecorder()
+		f(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s [%s] expect [%d], but actual [%d]", c.method, c.path, c.job, c.status, w.Code)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, USERSFILE)
+	s := NewUsers(file)
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"alice", true},
+		{"bob.smith", true},
+		{"", false},
+		{"a/b", false},
+		{"a b", false},
+	}
+
+	for _, c := range cases {
+		err := s.Set(c.name, "pw-"+c.name, VIEWER, nil)
+		if (err == nil) != c.valid {
+			t.Errorf("Set [%s] expect valid [%t], but actual error [%v]", c.name, c.valid, err)
+		}
+	}
+
+	if _, err := s.Verify("alice", "pw-alice"); err != nil {
+		t.Errorf("Verify [alice] expect success, but actual [%s]", err)
+	}
+	if _, err := s.Verify("alice", "wrong"); err == nil {
+		t.Errorf("Verify [alice] with wrong password expect failure, but actual success")
+	}
+	if _, err := s.Verify("nobody", "pw"); err == nil {
+		t.Errorf("Verify [nobody] expect failure, but actual success")
+	}
+
+	// An empty password keeps the old one.
+	if err := s.Set("alice", "", OPERATOR, nil); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.Verify("alice", "pw-alice"); err != nil || u.Role != OPERATOR {
+		t.Errorf("Verify [alice] expect [%s], but actual [%v] [%v]", OPERATOR, u, err)
+	}
+
+	token, err := s.CreateToken("alice", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateToken("nobody", "ci"); err == nil {
+		t.Errorf("CreateToken [nobody] expect failure, but actual success")
+	}
+
+	// Reload from the file.
+	s = NewUsers(file)
+	u, err := s.Resolve(token)
+	if err != nil || u.Name != "alice" {
+		t.Fatalf("Resolve expect [alice], but actual [%v] [%v]", u, err)
+	}
+	if u.Hash != "" || u.Salt != "" || u.Tokens[0].Hash != "" {
+		t.Errorf("Resolve expect no hashes, but actual [%v]", u)
+	}
+	if _, err := s.Resolve(token + "0"); err == nil {
+		t.Errorf("Resolve invalid token expect failure, but actual success")
+	}
+
+	if err := s.RevokeToken("alice", u.Tokens[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Resolve(token); err == nil {
+		t.Errorf("Resolve revoked token expect failure, but actual success")
+	}
+	if err := s.RevokeToken("alice", u.Tokens[0].ID); err == nil {
+		t.Errorf("RevokeToken twice expect failure, but actual success")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := newAuth(env.NewAny(map[interface{}]interface{}{"password": "secret", "session": "1h"}), dir)
+	if a.ttl != time.Hour {
+		t.Errorf("ttl expect [%s], but actual [%s]", time.Hour, a.ttl)
+	}
+	if _, err := a.login("admin", "wrong", ""); err == nil {
+		t.Errorf("login with wrong password expect failure, but actual success")
+	}
+
+	identify := func(token string) *User {
+		req := httptest.NewRequest("GET", "/api/v1/auth/me", nil)
+		req.AddCookie(&http.Cookie{Name: mweb.SESSIONCOOKIE, Value: token})
+		return a.identify(req)
+	}
+
+	token, err := a.login("admin", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := identify(token); u == nil || u.Name != "admin" {
+		t.Errorf("identify expect [admin], but actual [%v]", u)
+	}
+
+	a.logout(token)
+	if u := identify(token); u != nil {
+		t.Errorf("identify after logout expect nil, but actual [%v]", u)
+	}
+
+	token, err = a.login("admin", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.sessions[token].expire = time.Now().Add(-time.Second)
+	if u := identify(token); u != nil {
+		t.Errorf("identify expired session expect nil, but actual [%v]", u)
+	}
+	if _, ok := a.sessions[token]; ok {
+		t.Errorf("expired session expect removed, but actual kept")
+	}
+}
@@ -7,12 +7,19 @@ package master
 import (
 	"bubble/def"
 	"bubble/env"
+	"bubble/trace"
+	"encoding/base64"
+	"errors"
 	"path"
 	"strconv"
+	"strings"
 	"time"
+
+	log "github.com/cihub/seelog"
 )
 
 // NewCommand method create a new command by runner and index.
+// The runner could be nil for planning without execution.
 func NewCommand(runner *runner, index int) ICommand {
 	c := &command{
 		runner:      runner,
@@ -21,6 +28,8 @@ func NewCommand(runner *runner, index int) ICommand {
 		alias:       "",
 		disk:        "",
 		variables:   env.NewAny(nil),
+		outputs:     env.NewAny(nil),
+		values:      make(map[string]string),
 		when:        "success",
 		where:       -1,
 		target:      "",
@@ -29,7 +38,10 @@ func NewCommand(runner *runner, index int) ICommand {
 		beginStamp:  -1,
 		finishStamp: -1,
 	}
-	c.payloader = newPayloader(c.LogFilePath())
+	if runner != nil {
+		c.payloader = newPayloader(c.LogFilePath())
+		c.recorder = newRecorder(c.LogFilePath() + RECEXT)
+	}
 
 	return c
 }
@@ -42,8 +54,13 @@ type command struct {
 	disk        string
 	script      env.IAny
 	variables   env.IAny
+	outputs     env.IAny
+	values      map[string]string
 	when        string
 	where       int
+	wait        bool
+	approvers   []string
+	timeout     string
 	target      string
 	prefer      string
 	group       *group
@@ -51,12 +68,18 @@ type command struct {
 	beginStamp  int64
 	finishStamp int64
 	payloader   *payloader
+	recorder    *recorder
+	started     time.Time
+	span        *trace.Span
+	worker      uint64
 }
 
 type commandStat struct {
-	Status     def.STATUS `json:"status"`
-	BeginTime  int64      `json:"begin"`
-	FinishTime int64      `json:"finish"`
+	Status     def.STATUS        `json:"status"`
+	BeginTime  int64             `json:"begin"`
+	FinishTime int64             `json:"finish"`
+	Outputs    map[string]string `json:"outputs,omitempty"`
+	Worker     uint64            `json:"worker,omitempty"`
 }
 
 // --- ICommand ---
@@ -89,17 +112,31 @@ func (c *command) Variables() env.IAny {
 	return c.variables
 }
 
+func (c *command) Outputs() map[string]string {
+	return c.values
+}
+
 func (c *command) When() WHEN {
-	switch c.when {
+	switch strings.TrimSpace(c.when) {
 	case "always":
 		return ALWAYS
 	case "failure":
 		return FAILURE
-	default:
+	case "", "success":
 		return SUCCESS
+	default:
+		return EXPRESSION
 	}
 }
 
+func (c *command) Condition() string {
+	if c.When() != EXPRESSION {
+		return ""
+	}
+
+	return c.when
+}
+
 func (c *command) Where() int {
 	return c.where
 }
@@ -132,17 +169,69 @@ func (c *command) Logs(full bool) ([]byte, bool, error) {
 	return c.payloader.Bytes(full)
 }
 
+func (c *command) LogRange(offset int64, limit int64) ([]byte, []*Chunk, int64, error) {
+	bytes, err := c.payloader.Range(offset, limit)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	chunks, err := c.payloader.Chunks(offset, limit)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return bytes, chunks, c.payloader.Size(), nil
+}
+
+func (c *command) Records(filter *RecordFilter) ([]*def.Record, []*Section, error) {
+	return c.recorder.Records(filter)
+}
+
+func (c *command) Record(records []*def.Record) error {
+	c.write(def.ONGOING, records...)
+	return c.Notify(def.ONGOING, nil)
+}
+
 func (c *command) Notify(status def.STATUS, payload []byte) error {
-	c.payloader.Write(payload)
+	if len(payload) > 0 {
+		level := def.INFO
+		if status == def.FAILURE {
+			level = def.ERROR
+		}
+		c.write(status, &def.Record{Time: time.Now().UnixNano() / int64(time.Millisecond), Level: level, Text: string(payload)})
+	}
+	changed := c.status != status
 
 	switch c.status = status; status {
 	case def.ONGOING:
 		if c.beginStamp == -1 {
 			c.beginStamp = time.Now().Unix()
+			c.started = time.Now()
+		}
+		if c.span == nil {
+			c.span = c.runner.span.Child("command " + c.name)
+			c.span.Set("index", c.index).Set("action", c.name).Set("alias", c.alias)
 		}
 	case def.SUCCESS, def.FAILURE, def.CANCEL, def.INTERRUPT:
 		c.finishStamp = time.Now().Unix()
+		if changed && !c.started.IsZero() {
+			telemetry.command(c.name, time.Since(c.started))
+		}
 		c.payloader.Flush()
+		if changed && c.payloader.Size() > 0 {
+			go c.runner.job.index.add(c)
+		}
+		if status == def.FAILURE {
+			c.span.Fail(errors.New("command is failed"))
+		}
+		c.span.Set("status", statusNames[status]).Finish()
+	case def.SKIPPED:
+		c.beginStamp = -1
+		c.finishStamp = -1
+	}
+
+	if changed {
+		c.runner.events.publish(&Event{Type: STATUSEVENT, Index: c.index, Offset: c.payloader.Size(), Status: status})
 	}
 
 	return nil
@@ -150,6 +239,63 @@ func (c *command) Notify(status def.STATUS, payload []byte) error {
 
 // --- Inner ---
 
+// write appends the text of records to the log, pushes it to all viewers
+// and saves the records with the log offset.
+func (c *command) write(status def.STATUS, records ...*def.Record) {
+	for _, r := range records {
+		masked, offset := c.payloader.append([]byte(r.Text))
+		if len(masked) == 0 {
+			offset = c.payloader.Size()
+		}
+
+		r.Text = string(masked)
+		r.Title = c.payloader.masked(r.Title)
+		r.Offset = offset
+
+		if len(masked) > 0 {
+			c.runner.events.publish(&Event{
+				Type:   LOGEVENT,
+				Index:  c.index,
+				Offset: offset,
+				Status: status,
+				Data:   base64.StdEncoding.EncodeToString(masked),
+				bytes:  masked,
+			})
+		}
+	}
+
+	if err := c.recorder.append(records...); err != nil {
+		log.Error(err)
+	}
+}
+
+// publish collects the declared output values from env, and sets them
+// back to env with alias as namespace, like "build.version".
+func (c *command) publish(e env.IEnv) {
+	if c.outputs.IsNil() {
+		return
+	}
+
+	if c.outputs.IsMap() {
+		// Map of name and value expression.
+		for k, v := range c.outputs.Map() {
+			c.values[k] = e.Format(v)
+		}
+	} else {
+		// Array of names published by the Action.
+		for _, n := range c.outputs.Array() {
+			name := n.ToString()
+			if v, err := e.Get(name); err == nil {
+				c.values[name] = v.ToString()
+			}
+		}
+	}
+
+	for k, v := range c.values {
+		e.Set(c.Alias()+"."+k, env.NewAny(v))
+	}
+}
+
 func (c *command) LogFilePath() string {
 	name := "." + strconv.Itoa(c.index) + ".log"
 	return path.Join(c.runner.Dir(), name)
@@ -0,0 +1,93 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// `when` of a command could be a keyword (always, success, failure) or
+// a condition expression evaluated against the runner env, like:
+//
+// ```yaml
+// -
+//  action: shell
+//  when: $_BRANCH == "main" && failure(build)
+//  script:
+//   - echo ...
+// ```
+//
+// Status predicates are available in expressions:
+//   always()              always true.
+//   success(alias...)     all target commands are success, or the last status without alias.
+//   failure(alias...)     any target command is failed, or the last status without alias.
+//   skipped(alias...)     all target commands are skipped.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"fmt"
+)
+
+// evaluate returns whether the command should be executed with the last
+// executed status and the runner env.
+func (r *runner) evaluate(cmd ICommand, status def.STATUS, e env.IEnv) (bool, error) {
+	switch cmd.When() {
+	case ALWAYS:
+		return true, nil
+	case SUCCESS:
+		return status == def.SUCCESS, nil
+	case FAILURE:
+		return status == def.FAILURE, nil
+	}
+
+	e.SetFunc("always", func(args ...env.IAny) (env.IAny, error) {
+		return env.NewAny(true), nil
+	})
+	e.SetFunc("success", r.predicate(status, def.SUCCESS, true))
+	e.SetFunc("failure", r.predicate(status, def.FAILURE, false))
+	e.SetFunc("skipped", r.predicate(status, def.SKIPPED, true))
+
+	ret, err := e.Eval(cmd.Condition())
+	if err != nil {
+		return false, fmt.Errorf("command [%s] condition [%s] is invalid: %s", cmd.Alias(), cmd.Condition(), err.Error())
+	}
+
+	return ret, nil
+}
+
+// predicate creates a status predicate method. If all is true, all target
+// commands should match the expect status, otherwise any of them.
+func (r *runner) predicate(status def.STATUS, expect def.STATUS, all bool) env.MethodFunc {
+	return func(args ...env.IAny) (env.IAny, error) {
+		if len(args) == 0 {
+			return env.NewAny(status == expect), nil
+		}
+
+		for _, a := range args {
+			alias := a.ToString()
+			cmd := r.find(alias)
+			if cmd == nil {
+				return nil, fmt.Errorf("there is no command [%s]", alias)
+			}
+
+			match := cmd.Status() == expect
+			if all && !match {
+				return env.NewAny(false), nil
+			} else if !all && match {
+				return env.NewAny(true), nil
+			}
+		}
+
+		return env.NewAny(all), nil
+	}
+}
+
+// find returns the command with target alias.
+func (r *runner) find(alias string) ICommand {
+	for _, c := range r.cmds {
+		if c.Alias() == alias {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -7,6 +7,9 @@ package master
 import (
 	"bubble/def"
 	"bubble/env"
+	"bubble/trace"
+
+	log "github.com/cihub/seelog"
 )
 
 // NewCtx method create a new ctx by runner.
@@ -14,14 +17,25 @@ func NewCtx(runner IRunner) ICtx {
 	c := &ctx{runner: runner, Cmd: nil, Result: make(chan def.STATUS, 1), env: env.NewEnv()}
 	c.env.Set("_INSTANCE", env.NewAny(runner.ID())) // Set "_INSTANCE" variable.
 
+	// Params and upstream of the trigger.
+	if cause := runner.Cause(); cause != nil {
+		for k, v := range cause.Params {
+			c.env.Set(k, env.NewAny(v))
+		}
+		if cause.Upstream != "" {
+			c.env.Set(UPSTREAMVAR, env.NewAny(cause.Upstream))
+		}
+	}
+
 	return c
 }
 
 type ctx struct {
-	runner IRunner
-	Cmd    ICommand
-	Result chan def.STATUS
-	env    env.IEnv
+	runner  IRunner
+	Cmd     ICommand
+	Result  chan def.STATUS
+	env     env.IEnv
+	secrets map[string]string
 }
 
 func (c *ctx) ID() uint64 {
@@ -34,6 +48,10 @@ func (c *ctx) LastWorker() uint64 {
 	}
 
 	cmd := c.runner.Commands()[c.Cmd.Index()-1].(*command)
+	if cmd.group.worker == nil {
+		return 0
+	}
+
 	return cmd.group.worker.ID()
 }
 
@@ -79,13 +97,59 @@ func (c *ctx) Env() env.IEnv {
 	return c.env
 }
 
+func (c *ctx) Secrets() map[string]string {
+	c.secrets = make(map[string]string)
+	if c.Cmd == nil {
+		return c.secrets
+	}
+
+	store := c.runner.(*runner).job.master.Secrets()
+	values := make([]string, 0)
+	for _, name := range references(c.Script(), c.Variables()) {
+		v, err := store.Get(name)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		c.secrets[name] = v
+		values = append(values, v)
+	}
+	c.Cmd.(*command).payloader.mask(values...)
+
+	return c.secrets
+}
+
 func (c *ctx) Notify(status def.STATUS, payload []byte) {
 	if c.Cmd != nil {
 		c.Cmd.Notify(status, payload)
 	}
 }
 
+func (c *ctx) Record(records []*def.Record) {
+	if c.Cmd != nil {
+		c.Cmd.Record(records)
+	}
+}
+
+func (c *ctx) Span() *trace.Span {
+	if c.Cmd == nil {
+		return nil
+	}
+
+	return c.Cmd.(*command).span
+}
+
 func (c *ctx) SetResult(result def.STATUS, env env.IEnv) {
+	// Never keep secrets in runner env, including the variables and outputs
+	// made of them.
+	values := make([]string, 0, len(c.secrets))
+	for name, v := range c.secrets {
+		env.Delete(SECRETPREFIX + name)
+		values = append(values, v)
+	}
+	env.Strip(values...)
+
 	c.Notify(result, nil)
 	c.env = env
 	c.Result <- result
@@ -0,0 +1,158 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Workers are enrolled by the web API with a name, and the returned token
+// is set in worker.yml (or BUBBLE_WORKER_TOKEN) of the Worker:
+//
+// ```yaml
+// enroll:
+//  name: builder-1
+//  token: bbw_...
+// ```
+//
+// Master rejects the Worker registering without an enrolled name and
+// token when `enroll: true` is set in master.yml, and disconnects it when
+// its enrollment is revoked. Only the token hashes are saved in ENROLLFILE.
+
+package master
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// NewEnrollments method create an IEnrollments by file path.
+func NewEnrollments(file string) IEnrollments {
+	e := &enrollments{file: file, values: make(map[string]*Enrollment)}
+	if err := e.load(); err != nil {
+		log.Error(err)
+	}
+
+	return e
+}
+
+const (
+	// ENROLLFILE defines the enrolled Workers file name.
+	ENROLLFILE string = ".bubble.workers"
+	// ENROLLPREFIX defines the prefix of Worker tokens.
+	ENROLLPREFIX string = "bbw_"
+)
+
+var workerNameExp = regexp.MustCompile(`^[\w\-.]+$`)
+
+// Enrollment presents an enrolled Worker.
+type Enrollment struct {
+	Name    string `json:"name"`
+	Hash    string `json:"hash,omitempty"`
+	Created int64  `json:"created"`
+	Seen    int64  `json:"seen,omitempty"`
+	Worker  string `json:"worker,omitempty"`
+}
+
+type enrollments struct {
+	file   string
+	locker sync.Mutex
+	values map[string]*Enrollment
+}
+
+func (e *enrollments) List() []*Enrollment {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	list := make([]*Enrollment, 0, len(e.values))
+	for _, v := range e.values {
+		c := *v
+		c.Hash = ""
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+func (e *enrollments) Enroll(name string) (string, error) {
+	if !workerNameExp.MatchString(name) {
+		return "", fmt.Errorf("worker name [%s] is invalid", name)
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	token := ENROLLPREFIX + hex.EncodeToString(secret)
+	e.values[name] = &Enrollment{Name: name, Hash: tokenHash(token), Created: time.Now().Unix()}
+
+	return token, e.flush()
+}
+
+func (e *enrollments) Revoke(name string) error {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	if _, ok := e.values[name]; !ok {
+		return fmt.Errorf("worker [%s] is not enrolled", name)
+	}
+
+	delete(e.values, name)
+	return e.flush()
+}
+
+func (e *enrollments) Verify(name string, token string, id uint64) error {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	v, ok := e.values[name]
+	if !ok || !strings.HasPrefix(token, ENROLLPREFIX) ||
+		subtle.ConstantTimeCompare([]byte(v.Hash), []byte(tokenHash(token))) != 1 {
+		return fmt.Errorf("worker [%s] is not enrolled or the token is invalid", name)
+	}
+
+	v.Seen = time.Now().Unix()
+	v.Worker = strconv.FormatUint(id, 16)
+	return e.flush()
+}
+
+// --- Inner ---
+
+func (e *enrollments) load() error {
+	_, err := os.Stat(e.file)
+	if err != nil {
+		return nil
+	}
+
+	bytes, err := ioutil.ReadFile(e.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, &e.values)
+}
+
+func (e *enrollments) flush() error {
+	bytes, err := json.Marshal(e.values)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(e.file, bytes, 0600)
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/giant-tech/go-service/framework/idata"
+	"github.com/giant-tech/go-service/framework/iserver"
+)
+
+func TestEnrollments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, ENROLLFILE)
+	e := NewEnrollments(file)
+	token, err := e.Enroll("builder-1")
+	if err != nil || !strings.HasPrefix(token, ENROLLPREFIX) {
+		t.Fatalf("Enroll failed: [%s] %v", token, err)
+	}
+	if _, err = e.Enroll("bad name"); err == nil {
+		t.Error("Enroll invalid name should fail")
+	}
+
+	bytes, _ := ioutil.ReadFile(file)
+	if strings.Contains(string(bytes), token) {
+		t.Error("Enrollments file contains plain token")
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"builder-1", token, true},
+		{"builder-2", token, false},
+		{"builder-1", token + "0", false},
+		{"builder-1", strings.TrimPrefix(token, ENROLLPREFIX), false},
+		{"builder-1", "", false},
+	}
+
+	// Verify with the reloaded enrollments as well.
+	for _, v := range []IEnrollments{e, NewEnrollments(file)} {
+		for _, c := range cases {
+			err := v.Verify(c.name, c.token, 0x2a)
+			if (err == nil) != c.valid {
+				t.Errorf("Verify [%s] [%s] expect valid [%t], but error is [%v]", c.name, c.token, c.valid, err)
+			}
+		}
+	}
+
+	list := NewEnrollments(file).List()
+	if len(list) != 1 || list[0].Hash != "" || list[0].Worker != "2a" || list[0].Seen == 0 {
+		t.Errorf("List enrollments is incorrect: %+v", list[0])
+	}
+
+	// A re-enrolled token replaces the old one.
+	renewed, _ := e.Enroll("builder-1")
+	if e.Verify("builder-1", token, 1) == nil || e.Verify("builder-1", renewed, 1) != nil {
+		t.Error("Re-enroll doesn't replace the token")
+	}
+
+	if err = e.Revoke("builder-1"); err != nil {
+		t.Error(err)
+	}
+	if e.Verify("builder-1", renewed, 1) == nil {
+		t.Error("Verify revoked Worker should fail")
+	}
+	if e.Revoke("builder-1") == nil {
+		t.Error("Revoke missing Worker should fail")
+	}
+}
+
+func TestRevokeConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{
+		workers:     make(map[uint64]IWorker),
+		enrolled:    make(map[uint64]string),
+		lost:        make(map[uint64]*lost),
+		enrollments: NewEnrollments(path.Join(dir, ENROLLFILE)),
+	}
+	for id := uint64(1); id <= 100; id++ {
+		m.workers[id] = &worker{proxy: &proxy{id: id}, actions: make(map[string]IAction)}
+		m.enrolled[id] = "builder"
+	}
+
+	// Revoke on web goroutine while Workers disconnect on service goroutine.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			m.enrollments.Enroll("builder")
+			m.Revoke("builder")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for id := uint64(1); id <= 100; id++ {
+			m.OnDisconnected([]*idata.ServiceInfo{{Type: def.WorkerService, ServiceID: id}})
+			m.Workers()
+		}
+	}()
+	wg.Wait()
+
+	if len(m.Workers()) != 0 || len(m.enrolled) != 0 {
+		t.Errorf("Workers are left: %d %d", len(m.workers), len(m.enrolled))
+	}
+}
+
+func TestRegisterEnrolled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{
+		workers:     make(map[uint64]IWorker),
+		connected:   make(map[uint64]IWorker),
+		enrolled:    make(map[uint64]string),
+		lost:        make(map[uint64]*lost),
+		enrollments: NewEnrollments(path.Join(dir, ENROLLFILE)),
+		enroll:      true,
+	}
+	token, err := m.enrollments.Enroll("builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Worker 3 is lost in the grace period, and Worker 4 never registers.
+	m.lost[3] = &lost{worker: &worker{proxy: &proxy{id: 3}, actions: make(map[string]IAction), session: "s3"}}
+	for id := uint64(1); id <= 4; id++ {
+		m.connected[id] = &worker{proxy: &proxy{id: id}, actions: make(map[string]IAction)}
+	}
+
+	m.RPCRegister(1, nil, "builder", token)
+	m.RPCRegister(2, nil, "builder", token+"0")
+	m.RPCRegister(3, nil, "other", token)
+	for id := uint64(1); id <= 4; id++ {
+		m.RPCSession(id, fmt.Sprintf("s%d", id), nil)
+		m.RPCRunning(id, nil)
+		m.RPCOnFinish(id, "shell", 1, true, nil, "")
+		m.RPCOnProgress(id, "shell", 1, nil, "")
+		m.RPCOnBroadcast(id, def.TYPE(0), nil)
+	}
+
+	workers := m.Workers()
+	if len(workers) != 1 || workers[0].ID() != 1 || workers[0].Session() != "s1" {
+		t.Errorf("Registered Workers expect [1], but actual %v", workers)
+	}
+	if len(m.enrolled) != 1 || m.enrolled[1] != "builder" {
+		t.Errorf("Enrolled Workers expect [1: builder], but actual %v", m.enrolled)
+	}
+	if _, ok := m.lost[3]; !ok {
+		t.Error("Lost Worker [3] is resumed by a rejected Worker")
+	}
+	if _, ok := m.connected[4]; !ok || len(m.connected) != 1 {
+		t.Errorf("Connected Workers expect [4], but actual %v", m.connected)
+	}
+
+	m.OnDisconnected([]*idata.ServiceInfo{{Type: def.WorkerService, ServiceID: 4}})
+	if len(m.connected) != 0 {
+		t.Errorf("Connected Workers expect empty, but actual %v", m.connected)
+	}
+}
+
+// proxy is a Worker service proxy which ignores all calls.
+type proxy struct {
+	iserver.IServiceProxy
+	id uint64
+}
+
+func (p *proxy) GetSID() uint64 {
+	return p.id
+}
+
+func (p *proxy) AsyncCall(name string, args ...interface{}) error {
+	return nil
+}
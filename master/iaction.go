@@ -19,14 +19,19 @@ type IAction interface {
 	// Execute ICtx.
 	Execute(ctx ICtx)
 
+	// Adopt the ICtx whose Runner is still running on the Worker after
+	// the leader changed, it returns false if it's not running.
+	Adopt(ctx ICtx) bool
+
 	// Finish the Action with result and env.
-	Finish(runner uint64, success bool, env env.IEnv) error
+	// The span is the traceparent of the Action span on Worker.
+	Finish(runner uint64, success bool, env env.IEnv, span string) error
 
 	// Cancel the target job.
 	Cancel(runner uint64) error
 
 	// Progress the target job status with payload data.
-	Progress(runner uint64, payload []byte) error
+	Progress(runner uint64, payload []byte, span string) error
 
 	// Destroy the Action.
 	Destroy()
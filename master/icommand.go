@@ -19,6 +19,8 @@ const (
 	SUCCESS WHEN = 1
 	// FAILURE defines the action should be triggered when the pre actions is failed.
 	FAILURE WHEN = -1
+	// EXPRESSION defines the action should be triggered when the condition expression is true.
+	EXPRESSION WHEN = 2
 )
 
 // ICommand is the interface for Command in Job.
@@ -41,9 +43,15 @@ type ICommand interface {
 	// Variables returns the Command variables.
 	Variables() env.IAny
 
+	// Outputs returns the values published by the Command.
+	Outputs() map[string]string
+
 	// When returns the trigger condition.
 	When() WHEN
 
+	// Condition returns the condition expression when the trigger condition is EXPRESSION.
+	Condition() string
+
 	// Where the command should be executed. -1 indicates anywhere.
 	Where() int
 
@@ -62,6 +70,17 @@ type ICommand interface {
 	// Logs return all log data of the Command.
 	Logs(full bool) ([]byte, bool, error)
 
+	// LogRange returns at most limit bytes (no limit if it's not positive)
+	// of the log from offset, the chunks overlapped and the total size.
+	LogRange(offset int64, limit int64) ([]byte, []*Chunk, int64, error)
+
+	// Records returns the structured log records matching filter, and all
+	// sections of the Command.
+	Records(filter *RecordFilter) ([]*def.Record, []*Section, error)
+
+	// Record appends the structured log records from Worker.
+	Record(records []*def.Record) error
+
 	// Notify Command status.
 	Notify(status def.STATUS, payload []byte) error
 }
@@ -7,6 +7,7 @@ package master
 import (
 	"bubble/def"
 	"bubble/env"
+	"bubble/trace"
 )
 
 // ICtx interface.
@@ -32,9 +33,18 @@ type ICtx interface {
 	// Env return the current running IEnv.
 	Env() env.IEnv
 
+	// Secrets return the secrets referenced by the current command.
+	Secrets() map[string]string
+
 	// Notify the status with payload data.
 	Notify(status def.STATUS, payload []byte)
 
+	// Record the structured log records from Worker.
+	Record(records []*def.Record)
+
+	// Span returns the trace span of the current command.
+	Span() *trace.Span
+
 	// SetResult to finish the ICtx execution.
 	SetResult(result def.STATUS, env env.IEnv)
 }
@@ -0,0 +1,22 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+// IEnrollments is the interface for the enrolled Workers store.
+type IEnrollments interface {
+	// List returns all enrolled Workers without token hashes.
+	List() []*Enrollment
+
+	// Enroll creates or replaces the token of the Worker name, and returns
+	// the plain token which could not be read again.
+	Enroll(name string) (string, error)
+
+	// Revoke deletes the enrolled Worker.
+	Revoke(name string) error
+
+	// Verify checks the token of the Worker name, and records the Worker
+	// service id as the last seen.
+	Verify(name string, token string, id uint64) error
+}
@@ -16,8 +16,15 @@ type IJob interface {
 	// Name returns the Job name.
 	Name() string
 
-	// Trigger the Job.
-	Trigger() error
+	// Trigger the Job with cause (nil means manual) and returns the new
+	// Runner. If the Job has a repository, the script is loaded at the
+	// cause ref, and empty ref means the repository branch.
+	Trigger(cause *Cause) (IRunner, error)
+
+	// Rerun creates a new Runner with the script and params of the target
+	// Runner, and starts from the command at index by copying statuses and
+	// outputs of the previous commands, which should all be success.
+	Rerun(runner uint64, from int) (IRunner, error)
 
 	// Cancel the target Runner of the Job.
 	Cancel(runner uint64) error
@@ -25,9 +32,19 @@ type IJob interface {
 	// Script returns the Job script code.
 	Script() ([]byte, error)
 
-	// SetScript update bytes to the Job script code.
+	// SetScript validates and updates bytes to the Job script code.
 	SetScript(bytes []byte) error
 
+	// Repo returns the repository config of the Job, nil if it's not set.
+	Repo() *Repo
+
+	// SetRepo updates the repository config, nil means using the Job script.
+	SetRepo(repo *Repo) error
+
+	// Plan dry-runs the script bytes (or the Job script if it's nil)
+	// without executing anything.
+	Plan(bytes []byte) (*Plan, error)
+
 	// Triggers returns all triggers of the Job.
 	Triggers() ([]cron.ITrigger, error)
 
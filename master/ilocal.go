@@ -0,0 +1,25 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+)
+
+// ILocal is the interface to execute Job commands on the local machine,
+// each Worker of the script is simulated by a numbered workspace.
+type ILocal interface {
+	// Execute the command in the workspace of the simulated Worker, and
+	// returns the status with the result env.
+	Execute(cmd ICommand, worker int, e env.IEnv) (def.STATUS, env.IEnv)
+
+	// Transfer the disk path from the workspace of a simulated Worker to
+	// another one.
+	Transfer(from int, to int, disk string) error
+
+	// Notify the command status with an optional message.
+	Notify(cmd ICommand, status def.STATUS, message string)
+}
@@ -4,6 +4,10 @@
 
 package master
 
+import (
+	"bubble/store"
+)
+
 // IMaster interface.
 type IMaster interface {
 	// Create a Job by name.
@@ -23,4 +27,32 @@ type IMaster interface {
 
 	// Workers returns all workers.
 	Workers() []IWorker
+
+	// Secrets returns the secrets store.
+	Secrets() ISecrets
+
+	// Enrollments returns the enrolled Workers store.
+	Enrollments() IEnrollments
+
+	// Revoke deletes the enrolled Worker and disconnects it.
+	Revoke(name string) error
+
+	// Templates returns the shared script templates store.
+	Templates() ITemplates
+
+	// Dir returns the data folder.
+	Dir() string
+
+	// Store returns the persistent storage of Job states.
+	Store() store.IStore
+
+	// Mirror returns the local Git mirror cache.
+	Mirror() IMirror
+
+	// Search returns the matched lines in the stored command logs.
+	Search(query *SearchQuery) ([]*SearchResult, error)
+
+	// Metrics returns the telemetry of Master and Workers in Prometheus
+	// text format.
+	Metrics() []byte
 }
@@ -0,0 +1,12 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+// IMirror is the interface for the local Git mirror cache.
+type IMirror interface {
+	// Checkout fetches the repository and returns the commit of ref (or
+	// HEAD if it's empty) and the content of file at that commit.
+	Checkout(url string, ref string, file string) (string, []byte, error)
+}
@@ -6,11 +6,11 @@ package master
 
 import (
 	"bubble/env"
-	"errors"
 	"fmt"
 )
 
-// Parse Job scripts to command sequence.
+// Parse Job scripts to command sequence. The runner could be nil for
+// planning without execution.
 func Parse(runner *runner, bytes []byte) ([]ICommand, error) {
 	script := env.NewAny(nil)
 	err := script.FromBytes(bytes)
@@ -18,8 +18,8 @@ func Parse(runner *runner, bytes []byte) ([]ICommand, error) {
 		return nil, err
 	}
 
-	if !script.IsArr() {
-		return nil, errors.New("job script is not an array")
+	if script, err = commandsOf(script); err != nil {
+		return nil, err
 	}
 
 	arr := script.Array()
@@ -45,8 +45,10 @@ func Parse(runner *runner, bytes []byte) ([]ICommand, error) {
 				cmd.script = v
 			case "variables":
 				cmd.variables = v
+			case "outputs":
+				cmd.outputs = v
 			case "when":
-				cmd.when = v.String()
+				cmd.when = v.ToString()
 			case "where":
 				{
 					if v.IsNil() {
@@ -55,6 +57,18 @@ func Parse(runner *runner, bytes []byte) ([]ICommand, error) {
 						cmd.where = v.Int()
 					}
 				}
+			case "wait":
+				cmd.wait = v.Bool()
+			case "approvers":
+				if v.IsArr() {
+					for _, a := range v.Array() {
+						cmd.approvers = append(cmd.approvers, a.ToString())
+					}
+				} else if !v.IsNil() {
+					cmd.approvers = append(cmd.approvers, v.ToString())
+				}
+			case "timeout":
+				cmd.timeout = v.ToString()
 			case "target":
 				cmd.target = v.String()
 			case "prefer":
@@ -63,6 +77,10 @@ func Parse(runner *runner, bytes []byte) ([]ICommand, error) {
 		}
 
 		where := cmd.Where()
+		if i > 0 && (where < -1 || where > i) {
+			return nil, fmt.Errorf("command [%d] where [%d] is out of range", i, where)
+		}
+
 		if where == -1 || i == 0 {
 			// Anywhere.
 			cmd.group = &group{cmds: make([]ICommand, 0)}
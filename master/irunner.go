@@ -4,6 +4,10 @@
 
 package master
 
+import (
+	"bubble/def"
+)
+
 // IRunner presents an executation of a Job.
 type IRunner interface {
 	// ID returns Runner unique id.
@@ -15,6 +19,33 @@ type IRunner interface {
 	// Cancel the executation of the Runner.
 	Cancel() error
 
+	// Revision returns the repository commit of the Runner script, empty
+	// if the script is not from a repository.
+	Revision() string
+
+	// Cause returns why the Runner is triggered, nil if it's manual.
+	Cause() *Cause
+
+	// Status returns the Runner status, including propagated downstream result.
+	Status() def.STATUS
+
+	// Downstreams returns all Runners triggered by this Runner.
+	Downstreams() []*Downstream
+
+	// Approve approves or rejects the waiting approval command at index.
+	Approve(index int, user string, approved bool, comment string) error
+
+	// Approvals returns all decisions of approval commands.
+	Approvals() []*Approval
+
+	// Wait blocks until the Runner is completed and returns its status.
+	Wait() def.STATUS
+
+	// Stream sends the logs and status changes of all commands from the
+	// command index and its log byte offset, until the Runner is completed,
+	// done is closed or send fails.
+	Stream(index int, offset int64, done <-chan struct{}, send func(*Event) error) error
+
 	// Commands returns all ICommand of the Runner.
 	Commands() []ICommand
 }
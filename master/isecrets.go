@@ -0,0 +1,20 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+// ISecrets is the interface for the encrypted secrets store.
+type ISecrets interface {
+	// Names returns all secret names.
+	Names() []string
+
+	// Get returns the plain value of the target secret.
+	Get(name string) (string, error)
+
+	// Set encrypts and saves the secret value.
+	Set(name string, value string) error
+
+	// Delete the target secret.
+	Delete(name string) error
+}
@@ -0,0 +1,20 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+// ITemplates is the interface for the shared script templates store.
+type ITemplates interface {
+	// Names returns all template names.
+	Names() []string
+
+	// Get returns the template script bytes.
+	Get(name string) ([]byte, error)
+
+	// Set validates and saves the template script bytes.
+	Set(name string, bytes []byte) error
+
+	// Delete the target template.
+	Delete(name string) error
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+// IUsers is the interface for the user accounts store.
+type IUsers interface {
+	// List returns all users without password and token hashes.
+	List() []*User
+
+	// Get returns the target user.
+	Get(name string) (*User, error)
+
+	// Set creates or updates the user. The password is kept if it's empty.
+	Set(name string, password string, role ROLE, jobs map[string]ROLE) error
+
+	// Delete the target user.
+	Delete(name string) error
+
+	// Verify returns the user if the password is correct.
+	Verify(name string, password string) (*User, error)
+
+	// CreateToken creates an API token with label for the user, and returns
+	// the plain token which could not be read again.
+	CreateToken(name string, label string) (string, error)
+
+	// RevokeToken deletes the API token by id.
+	RevokeToken(name string, id string) error
+
+	// Resolve returns the user of the API token.
+	Resolve(token string) (*User, error)
+}
@@ -23,14 +23,18 @@ type IWorker interface {
 	// Workload returns the Worker running command quantity.
 	Workload() int
 
+	// Metrics returns the latest metrics reported by the Worker, nil if
+	// it's not reported yet.
+	Metrics() *def.Metrics
+
 	// Get target Action.
 	Get(name string) IAction
 
 	// Finish action with related parameters.
-	Finish(action string, runner uint64, success bool, env env.IEnv) error
+	Finish(action string, runner uint64, success bool, env env.IEnv, span string) error
 
 	// Notify action with related parameters.
-	Progress(action string, runner uint64, payload []byte) error
+	Progress(action string, runner uint64, payload []byte, span string) error
 
 	// Broadcast handles data from corresponding Worker.
 	Broadcast(t def.TYPE, payload []byte)
@@ -38,6 +42,24 @@ type IWorker interface {
 	// Clean the runner data on the Worker.
 	Clean(runner uint64) error
 
+	// Lead notifies the Worker that the Master is the leader.
+	Lead() error
+
+	// Running keeps the running Runners of each Action reported by the
+	// Worker.
+	Running(procs map[string][]uint64)
+
+	// Reported returns whether the Worker has reported the running Runners.
+	Reported() bool
+
+	// Session returns the session id of the Worker process.
+	Session() string
+
+	// Resume the session of the Worker. If the lost Worker has the same
+	// session, it takes over the connection and keeps the Runners in procs
+	// running, and it's returned. Otherwise the lost Worker is destroyed.
+	Resume(session string, lost IWorker, procs map[string][]uint64) IWorker
+
 	// Destroy the Worker.
 	Destroy()
 }
@@ -8,14 +8,14 @@ import (
 	"bubble/cron"
 	"bubble/def"
 	"bubble/env"
+	"bubble/store"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/cihub/seelog"
 )
@@ -49,9 +49,11 @@ type job struct {
 	id      uint64
 	name    string
 	script  env.IAny
+	repo    *Repo
 	locker  sync.Mutex
 	runners map[uint64]IRunner
 	cron    cron.ICron
+	index   *indexer
 }
 
 // --- IJob ---
@@ -64,18 +66,76 @@ func (j *job) Name() string {
 	return j.name
 }
 
-func (j *job) Trigger() error {
+func (j *job) Trigger(cause *Cause) (IRunner, error) {
+	ref := ""
+	if cause != nil {
+		ref = cause.Ref
+	}
+
+	// Fetch the script before locking, since it may take a while.
+	bytes, revision, err := j.source(ref)
+	if err != nil {
+		return nil, err
+	}
+
 	j.locker.Lock()
 	defer j.locker.Unlock()
 
 	uid, err := def.NextUid()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	r := NewRunner(uid, j, bytes, revision, cause)
+	if r == nil {
+		return nil, fmt.Errorf("job [%s] can't create Runner, please check the script", j.name)
+	}
+
+	j.runners[r.ID()] = r
+	return r, r.Execute()
+}
+
+func (j *job) Rerun(id uint64, from int) (IRunner, error) {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+
+	ir, ok := j.runners[id]
+	if !ok {
+		return nil, fmt.Errorf("job [%s] Runner [%d] is not exist", j.name, id)
+	}
+
+	src := ir.(*runner)
+	if err := src.rerunnable(from); err != nil {
+		return nil, err
+	}
+
+	bytes, err := j.store().Get(src.key(BUBBLEFILE))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the params and chain of the source Runner.
+	cause := &Cause{}
+	if src.cause != nil {
+		*cause = *src.cause
+	}
+	cause.Rerun = strconv.FormatUint(src.id, 16)
+	cause.From = from
+
+	uid, err := def.NextUid()
+	if err != nil {
+		return nil, err
 	}
 
-	r := NewRunner(uid, j)
+	r := NewRunner(uid, j, bytes, src.revision, cause)
+	if r == nil {
+		return nil, fmt.Errorf("job [%s] can't create Runner, please check the script", j.name)
+	}
+
+	r.(*runner).inherit(src, from)
+
 	j.runners[r.ID()] = r
-	return r.Execute()
+	return r, r.Execute()
 }
 
 func (j *job) Cancel(runner uint64) error {
@@ -92,14 +152,22 @@ func (j *job) Script() ([]byte, error) {
 }
 
 func (j *job) SetScript(bytes []byte) error {
+	issues := Validate(j.master, bytes)
+	if err := issuesError(issues); err != nil {
+		return err
+	}
+
+	for _, i := range issues {
+		log.Warnf("Job [%s] script command [%d]: %s", j.name, i.Index, i.Message)
+	}
+
 	err := j.script.FromBytes(bytes)
 	if err != nil {
 		return err
 	}
 
 	go func() {
-		fp := path.Join(j.Dir(), BUBBLEFILE)
-		if err = ioutil.WriteFile(fp, bytes, os.ModePerm); err != nil {
+		if err := j.store().Put(j.key(BUBBLEFILE), bytes); err != nil {
 			log.Error(err)
 		}
 	}()
@@ -107,6 +175,41 @@ func (j *job) SetScript(bytes []byte) error {
 	return nil
 }
 
+func (j *job) Repo() *Repo {
+	if j.repo == nil {
+		return nil
+	}
+
+	r := *j.repo
+	return &r
+}
+
+func (j *job) SetRepo(repo *Repo) error {
+	if repo != nil {
+		if err := repo.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := saveRepo(j.store(), j.key(REPOFILE), repo); err != nil {
+		return err
+	}
+	j.repo = repo
+
+	return nil
+}
+
+func (j *job) Plan(bytes []byte) (*Plan, error) {
+	if bytes == nil {
+		var err error
+		if bytes, err = j.Script(); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewPlan(j.master, bytes), nil
+}
+
 func (j *job) Triggers() ([]cron.ITrigger, error) {
 	return j.cron.Triggers()
 }
@@ -142,6 +245,10 @@ func (j *job) Destroy() error {
 		return fmt.Errorf("can't destroy Job [%s] since it's not exist", j.name)
 	}
 
+	if err = j.store().Delete(j.key("")); err != nil {
+		return err
+	}
+
 	return os.RemoveAll(dir)
 }
 
@@ -174,7 +281,9 @@ func (j *job) Repeat() bool {
 }
 
 func (j *job) Execute() {
-	j.Trigger()
+	if _, err := j.Trigger(nil); err != nil {
+		log.Error(err)
+	}
 }
 
 func (j *job) FromBytes(bytes []byte) {
@@ -188,8 +297,154 @@ func (j *job) ToBytes() []byte {
 // --- Inner ---
 
 func (j *job) Dir() string {
-	ext, _ := os.Executable()
-	return path.Join(filepath.Dir(ext), "jobs", j.name+"@"+strconv.FormatUint(j.id, 16))
+	return path.Join(j.master.Dir(), "jobs", j.folder())
+}
+
+// folder returns the Job folder name, which is also the key prefix of all
+// Job states in store.
+func (j *job) folder() string {
+	return j.name + "@" + strconv.FormatUint(j.id, 16)
+}
+
+// key returns the store key of the Job state by name.
+func (j *job) key(name string) string {
+	return path.Join(j.folder(), name)
+}
+
+func (j *job) store() store.IStore {
+	return j.master.Store()
+}
+
+// remove deletes the Runner and its data.
+func (j *job) remove(id uint64) error {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+
+	r, ok := j.runners[id]
+	if !ok {
+		return fmt.Errorf("runner [%d] is not exist", id)
+	}
+
+	delete(j.runners, id)
+	if err := j.store().Delete(r.(*runner).key("")); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(r.(*runner).Dir())
+}
+
+// reindex adds the logs of all completed commands into the search index.
+func (j *job) reindex() {
+	log.Infof("Job [%s] indexes logs for search.\n", j.name)
+	for _, ir := range j.Runners() {
+		for _, ic := range ir.Commands() {
+			c := ic.(*command)
+			if c.payloader.Size() > 0 && (def.IsCompleted(c.Status()) || c.Status() == def.INTERRUPT) {
+				j.index.add(c)
+			}
+		}
+	}
+}
+
+// resume re-runs all interrupted Runners from the interrupted command.
+func (j *job) resume() {
+	for _, ir := range j.Runners() {
+		r := ir.(*runner)
+		if !r.interrupted {
+			continue
+		}
+
+		from := r.resumable()
+		if from < 0 {
+			log.Warnf("Job [%s] Runner [%x] can't be resumed.\n", j.name, r.id)
+			continue
+		}
+
+		j.rerunFrom(r, from)
+	}
+}
+
+// takeover continues the interrupted Runners left by the last leader in
+// place, only if the interrupted command is still running on its Worker
+// reported before deadline. Others are left interrupted, or re-run if
+// resume is set, so no command is executed twice silently.
+func (j *job) takeover(deadline time.Time, resume bool) {
+	for _, ir := range j.Runners() {
+		r := ir.(*runner)
+		if !r.interrupted {
+			continue
+		}
+
+		from := r.resumable()
+		if from < 0 {
+			log.Warnf("Job [%s] Runner [%x] can't be taken over.\n", j.name, r.id)
+			continue
+		}
+
+		worker := r.adoptable(from, deadline)
+		if worker == nil {
+			if resume {
+				j.rerunFrom(r, from)
+			} else {
+				log.Warnf("Job [%s] Runner [%x] is left interrupted since command [%d] is not running on Worker.\n", j.name, r.id, from)
+			}
+			continue
+		}
+
+		if err := r.takeover(from, worker); err != nil {
+			log.Errorf("Job [%s] Runner [%x] takeover failed: %s", j.name, r.id, err.Error())
+			continue
+		}
+
+		log.Infof("Job [%s] Runner [%x] is taken over from [%d].\n", j.name, r.id, from)
+	}
+}
+
+// rerunFrom resumes the interrupted Runner by a new Runner from the
+// command at index from.
+func (j *job) rerunFrom(r *runner, from int) {
+	nr, err := j.Rerun(r.id, from)
+	if err != nil {
+		log.Errorf("Job [%s] Runner [%x] resume failed: %s", j.name, r.id, err.Error())
+		return
+	}
+
+	log.Infof("Job [%s] Runner [%x] is resumed by Runner [%x] from [%d].\n", j.name, r.id, nr.ID(), from)
+}
+
+// source returns the script bytes and its commit for a new Runner. If the
+// Job has a repository, the script is loaded from it at ref (or the repo
+// branch), and falls back to the Job script if it's allowed.
+func (j *job) source(ref string) ([]byte, string, error) {
+	if j.repo == nil {
+		if ref != "" {
+			return nil, "", fmt.Errorf("job [%s] has no repository to trigger ref [%s]", j.name, ref)
+		}
+
+		bytes, err := j.Script()
+		return bytes, "", err
+	}
+
+	if ref == "" {
+		ref = j.repo.Branch
+	}
+
+	commit, bytes, err := j.master.Mirror().Checkout(j.repo.URL, ref, j.repo.Path)
+	if err == nil {
+		err = issuesError(Validate(j.master, bytes))
+	}
+
+	if err != nil {
+		if !j.repo.Fallback {
+			return nil, "", err
+		}
+
+		log.Warnf("Job [%s] falls back to its own script: %s", j.name, err.Error())
+		bytes, err = j.Script()
+		return bytes, "", err
+	}
+
+	return bytes, commit, nil
 }
 
 func (j *job) init() error {
@@ -205,15 +460,13 @@ func (j *job) init() error {
 
 	// Load Job script. If it's not exist, create one with
 	// default initial script code.
-	var bytes []byte
-	fp := path.Join(dir, BUBBLEFILE)
-	_, err = os.Stat(fp)
+	bytes, err := j.store().Get(j.key(BUBBLEFILE))
 	if err != nil && os.IsNotExist(err) {
 		bytes = []byte(SCRIPT)
-		if err = ioutil.WriteFile(fp, bytes, os.ModePerm); err != nil {
+		if err = j.store().Put(j.key(BUBBLEFILE), bytes); err != nil {
 			return err
 		}
-	} else if bytes, err = ioutil.ReadFile(fp); err != nil {
+	} else if err != nil {
 		return err
 	}
 
@@ -223,9 +476,12 @@ func (j *job) init() error {
 		return err
 	}
 
-	// Load all runners under the Job by walking all folders.
-	f, _ := os.Open(dir)
-	fs, err := f.Readdir(-1)
+	if j.repo, err = loadRepo(j.store(), j.key(REPOFILE)); err != nil {
+		return err
+	}
+
+	// Load all runners under the Job, which are named by hex ids.
+	names, err := j.store().List(j.folder())
 	if err != nil {
 		return err
 	}
@@ -233,22 +489,29 @@ func (j *job) init() error {
 	j.locker.Lock()
 	defer j.locker.Unlock()
 
-	for _, child := range fs {
-		cp := path.Join(dir, child.Name())
-		stat, err := os.Stat(cp)
+	for _, name := range names {
+		id, err := strconv.ParseUint(name, 16, 64)
 		if err != nil {
-			return err
+			continue
 		}
 
-		if stat.IsDir() {
-			id, _ := strconv.ParseUint(child.Name(), 16, 64)
-			r := NewRunner(id, j)
-			j.runners[r.ID()] = r
+		r := NewRunner(id, j, nil, "", nil)
+		if r == nil {
+			log.Errorf("Job [%s] can't load Runner [%s]!", j.name, name)
+			continue
 		}
+
+		j.runners[r.ID()] = r
+	}
+
+	// Index the logs of existing Runners for search if it's not done.
+	j.index = newIndexer(path.Join(dir, INDEXFILE))
+	if !j.index.exist() && len(j.runners) > 0 {
+		go j.reindex()
 	}
 
 	// Load all crons and start.
-	j.cron = cron.NewCron(func() cron.ICronJob { return j }, path.Join(dir, CRONFILE))
+	j.cron = cron.NewCron(func() cron.ICronJob { return j }, j.store(), j.key(CRONFILE))
 	j.cron.StartAll()
 
 	return nil
@@ -0,0 +1,164 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Masters could run in active/standby mode by electing the leader with a
+// Redis lock. Only the leader serves web and executes Jobs, the standby
+// takes over the Runners from the shared data folder when it's elected:
+//
+// ```yaml
+// ha:
+//  redis: 127.0.0.1:6379
+//  password: ""
+//  db: 0
+//  key: bubble:master:leader
+//  ttl: 10s
+// ```
+
+package master
+
+import (
+	"bubble/env"
+	"errors"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// LEADERKEY defines the default Redis key of the leader lock.
+	LEADERKEY string = "bubble:master:leader"
+	// LEADERTTL defines the default expiration of the leader lock.
+	LEADERTTL time.Duration = 10 * time.Second
+)
+
+var (
+	// renewScript extends the lock only if it's still held by the id.
+	renewScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`)
+	// releaseScript deletes the lock only if it's still held by the id.
+	releaseScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+)
+
+// newLeader creates the leader election by `ha` configure with the Master
+// id, it's nil if HA mode is not configured.
+func newLeader(conf env.IAny, id string) (*leader, error) {
+	if conf == nil || !conf.IsMap() {
+		return nil, nil
+	}
+
+	m := conf.Map()
+	addr, ok := m["redis"]
+	if !ok || addr.ToString() == "" {
+		return nil, errors.New("\"redis\" of ha configure is not set")
+	}
+
+	l := &leader{id: id, key: LEADERKEY, ttl: LEADERTTL}
+	if k, ok := m["key"]; ok && k.ToString() != "" {
+		l.key = k.ToString()
+	}
+	if t, ok := m["ttl"]; ok {
+		d, err := time.ParseDuration(t.ToString())
+		if err != nil || d < time.Second {
+			return nil, errors.New("\"ttl\" of ha configure is invalid")
+		}
+		l.ttl = d
+	}
+
+	options := make([]redis.DialOption, 0)
+	if p, ok := m["password"]; ok && p.ToString() != "" {
+		options = append(options, redis.DialPassword(p.ToString()))
+	}
+	if d, ok := m["db"]; ok {
+		options = append(options, redis.DialDatabase(d.Int()))
+	}
+	options = append(options, redis.DialConnectTimeout(l.ttl/3), redis.DialReadTimeout(l.ttl/3), redis.DialWriteTimeout(l.ttl/3))
+
+	l.pool = &redis.Pool{
+		MaxIdle:     1,
+		IdleTimeout: l.ttl,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr.ToString(), options...)
+		},
+	}
+
+	return l, nil
+}
+
+type leader struct {
+	id   string
+	key  string
+	ttl  time.Duration
+	pool *redis.Pool
+}
+
+// campaign tries to acquire the lock until it's elected, then keeps
+// renewing it. The lost is called if the lock can't be renewed before
+// expiration, and the election stops.
+func (l *leader) campaign(elected func(), lost func()) {
+	interval := l.ttl / 3
+	for {
+		ok, err := l.acquire()
+		if err != nil {
+			log.Warnf("Acquire leader lock [%s] failed: %s", l.key, err.Error())
+		}
+		if ok {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	log.Infof("Master [%s] is elected as the leader.", l.id)
+	elected()
+
+	renewed := time.Now()
+	for {
+		time.Sleep(interval)
+
+		ok, err := l.renew()
+		if err != nil {
+			log.Warnf("Renew leader lock [%s] failed: %s", l.key, err.Error())
+		}
+
+		if ok {
+			renewed = time.Now()
+		} else if err == nil || time.Since(renewed) >= l.ttl {
+			// Another Master may hold the lock now.
+			lost()
+			return
+		}
+	}
+}
+
+// acquire sets the lock if it's not held by others.
+func (l *leader) acquire() (bool, error) {
+	c := l.pool.Get()
+	defer c.Close()
+
+	_, err := redis.String(c.Do("SET", l.key, l.id, "NX", "PX", int64(l.ttl/time.Millisecond)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// renew extends the expiration of the held lock.
+func (l *leader) renew() (bool, error) {
+	c := l.pool.Get()
+	defer c.Close()
+
+	n, err := redis.Int(renewScript.Do(c, l.key, l.id, int64(l.ttl/time.Millisecond)))
+	return n == 1, err
+}
+
+// release deletes the held lock, so a standby could take over at once.
+func (l *leader) release() {
+	c := l.pool.Get()
+	defer c.Close()
+
+	if _, err := releaseScript.Do(c, l.key, l.id); err != nil {
+		log.Error(err)
+	}
+	l.pool.Close()
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+)
+
+// RunLocal executes the Job script on the local machine without Master and
+// Workers, and returns the commands with the final statuses. Commands of
+// the same `where` group share a simulated Worker, and `disk` is
+// transferred when switching Workers. Approvals are approved automatically,
+// and downstream triggers are skipped.
+func RunLocal(templates ITemplates, bytes []byte, params map[string]string, local ILocal) ([]ICommand, def.STATUS, error) {
+	bytes, err := Resolve(templates, bytes)
+	if err != nil {
+		return nil, def.FAILURE, err
+	}
+
+	cmds, err := Parse(nil, bytes)
+	if err != nil {
+		return nil, def.FAILURE, err
+	}
+
+	r := &runner{cmds: cmds}
+	e := env.NewEnv()
+	e.Set("_INSTANCE", env.NewAny(r.id))
+	for k, v := range params {
+		e.Set(k, env.NewAny(v))
+	}
+
+	finish := func(cmd *command, status def.STATUS, msg string) {
+		cmd.status = status
+		local.Notify(cmd, status, msg)
+	}
+
+	workers := make(map[*group]int)
+	status := def.SUCCESS
+	for i := 0; i < len(cmds) && status != def.INTERRUPT && status != def.CANCEL; i++ {
+		cmd := cmds[i].(*command)
+
+		run, err := r.evaluate(cmd, status, e)
+		if err != nil {
+			status = def.FAILURE
+			finish(cmd, def.FAILURE, err.Error())
+			continue
+		} else if !run {
+			finish(cmd, def.SKIPPED, "")
+			continue
+		}
+		finish(cmd, def.ONGOING, "")
+
+		switch cmd.Name() {
+		case APPROVAL:
+			status = def.SUCCESS
+			finish(cmd, status, "Approved automatically on the local machine.")
+			continue
+		case TRIGGER:
+			finish(cmd, def.SKIPPED, "Downstream Jobs aren't triggered on the local machine.")
+			continue
+		}
+
+		worker, ok := workers[cmd.group]
+		if !ok {
+			worker = len(workers) + 1
+			workers[cmd.group] = worker
+		}
+
+		// Stream the disk from the Worker of the previous command.
+		if cmd.Disk() != "" && i > 0 {
+			if last, ok := workers[cmds[i-1].(*command).group]; ok && last != worker {
+				if err = local.Transfer(last, worker, cmd.Disk()); err != nil {
+					status = def.FAILURE
+					finish(cmd, status, err.Error())
+					continue
+				}
+			}
+		}
+
+		status, e = local.Execute(cmd, worker, e)
+		cmd.publish(e)
+		finish(cmd, status, "")
+	}
+
+	return cmds, r.commandsStatus(), nil
+}
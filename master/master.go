@@ -7,14 +7,20 @@ package master
 import (
 	"bubble/def"
 	"bubble/env"
+	"bubble/store"
+	"bubble/trace"
 	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/cihub/seelog"
 	"github.com/giant-tech/go-service/framework/idata"
@@ -24,23 +30,74 @@ import (
 const (
 	// MasterConfigFile defines the configure file full path.
 	MasterConfigFile string = "./master.yml"
+	// CONFIGENV defines the OS env of the configure file path.
+	CONFIGENV string = "BUBBLE_MASTER_CONFIG"
+	// DATAENV defines the OS env of the data folder.
+	DATAENV string = "BUBBLE_MASTER_DATA"
+	// GRACE defines how long a disconnected Worker keeps its running
+	// Actions by default.
+	GRACE time.Duration = 30 * time.Second
 )
 
+// jobNameExp defines the valid Job names, which are parts of the folder
+// names and store keys, so they can't contain "/".
+var jobNameExp = regexp.MustCompile(`^[\w\-.@]+$`)
+
 // Master type.
 type Master struct {
 	service.BaseService
-	workers map[uint64]IWorker
-	jobs    map[string]IJob
-	web     IWeb
+
+	// ConfigFile is the configure file path, which overrides CONFIGENV and
+	// MasterConfigFile.
+	ConfigFile string
+	// DataDir is the folder of Jobs, templates and other Master data, which
+	// overrides DATAENV and `data` in configure file. It's the executable
+	// folder by default.
+	DataDir string
+
+	dir        string
+	locker     sync.Mutex // guards workers, connected, enrolled and lost
+	workers    map[uint64]IWorker
+	connected  map[uint64]IWorker // connected Workers not registered yet
+	jobsLocker sync.RWMutex       // guards jobs
+	jobs       map[string]IJob
+	secrets    ISecrets
+	templates  ITemplates
+	store      store.IStore
+	mirror     IMirror
+	retention  *retention
+	web        IWeb
+
+	enrollments IEnrollments
+	enroll      bool
+	enrolled    map[uint64]string
+
+	grace time.Duration
+	lost  map[uint64]*lost
+
+	conf    map[string]env.IAny
+	base    string
+	leader  *leader
+	elected int32
+	active  bool
+}
+
+// lost is a disconnected Worker in the grace period.
+type lost struct {
+	worker IWorker
+	since  time.Time
 }
 
 // OnInit method.
 func (m *Master) OnInit() error {
 	m.workers = make(map[uint64]IWorker)
-	m.loadJobs()
+	m.connected = make(map[uint64]IWorker)
+	m.enrolled = make(map[uint64]string)
+	m.lost = make(map[uint64]*lost)
 
 	// Load configure file.
-	conf, err := env.Load(MasterConfigFile)
+	file := def.FirstOf(m.ConfigFile, os.Getenv(CONFIGENV), MasterConfigFile)
+	conf, err := env.Load(file)
 	if err != nil {
 		return err
 	}
@@ -51,29 +108,95 @@ func (m *Master) OnInit() error {
 
 	all := conf.Map()
 
-	conf, ok := all["web"]
-	if !ok {
-		return errors.New("not setting \"web\" for Master configure")
+	// Relative paths in configure file are based on its folder.
+	base, _ := filepath.Abs(filepath.Dir(file))
+	data := ""
+	if d, ok := all["data"]; ok {
+		data = def.Abs(base, d.ToString())
+	}
+	m.dir = def.FirstOf(m.DataDir, os.Getenv(DATAENV), data, def.ExeDir())
+	if err = os.MkdirAll(m.dir, os.ModePerm); err != nil {
+		return err
 	}
+	log.Infof("Master data folder is [%s].", m.dir)
 
-	// Run http service.
-	m.web = NewWeb(m, conf)
-	return m.web.Serve()
+	m.templates = NewTemplates(path.Join(m.dir, "templates"))
+	m.mirror = NewMirror(path.Join(m.dir, "repos"))
+
+	// Secrets master key could be set in configure file or OS env.
+	key := os.Getenv(SECRETKEYENV)
+	if sc, ok := all["secret"]; ok && sc.IsMap() {
+		if k, ok := sc.Map()["key"]; ok {
+			key = k.ToString()
+		}
+	}
+	m.secrets = NewSecrets(path.Join(m.dir, SECRETSFILE), key)
+
+	// Only enrolled Workers could register if it's enabled.
+	m.enrollments = NewEnrollments(path.Join(m.dir, ENROLLFILE))
+	if e, ok := all["enroll"]; ok && e.Bool() {
+		m.enroll = true
+	} else {
+		log.Warn("Worker enrollment is not enabled, any Worker could register to Master.")
+	}
+
+	if err = trace.Setup("bubble-master", all[trace.CONFIGKEY]); err != nil {
+		return err
+	}
+
+	// Disconnected Workers keep running Actions in the grace period, and
+	// "0s" disables it.
+	m.grace = GRACE
+	if g, ok := all["grace"]; ok {
+		if m.grace, err = time.ParseDuration(g.ToString()); err != nil {
+			return fmt.Errorf("\"grace\" of Master configure is invalid: %s", err.Error())
+		}
+	}
+
+	m.conf, m.base = all, base
+	if m.leader, err = newLeader(all["ha"], strconv.FormatUint(m.GetSID(), 16)); err != nil {
+		return err
+	}
+	if m.leader == nil {
+		return m.activate()
+	}
+
+	// Standby until it's elected, and activate in OnTick.
+	log.Info("Master is standby until it's elected as the leader.")
+	go m.leader.campaign(func() {
+		atomic.StoreInt32(&m.elected, 1)
+	}, func() {
+		log.Critical("Master lost the leader lock, exit to avoid running with another leader.")
+		log.Flush()
+		os.Exit(1)
+	})
+
+	return nil
 }
 
 // OnDestroy method.
 func (m *Master) OnDestroy() {
-	m.web.Close()
+	if m.web != nil {
+		m.web.Close()
+	}
+	if m.store != nil {
+		m.store.Close()
+	}
+	if m.leader != nil {
+		m.leader.release()
+	}
+	trace.Close()
 }
 
-// OnConnected method.
+// OnConnected method. The Worker is available after its registration.
 func (m *Master) OnConnected(info []*idata.ServiceInfo) {
 	for _, i := range info {
 		if i.Type == def.WorkerService {
 			worker := NewWorker(m.GetSID(), i.ServiceID)
 			if worker != nil {
-				// TODO: Add lock
-				m.workers[i.ServiceID] = worker
+				m.locker.Lock()
+				m.connected[i.ServiceID] = worker
+				m.locker.Unlock()
 			}
 		}
 	}
@@ -83,42 +206,135 @@ func (m *Master) OnConnected(info []*idata.ServiceInfo) {
 func (m *Master) OnDisconnected(info []*idata.ServiceInfo) {
 	for _, i := range info {
 		if i.Type == def.WorkerService {
+			m.locker.Lock()
 			worker, ok := m.workers[i.ServiceID]
 			if ok {
-				worker.Destroy()
+				// Keep the Worker in grace period if it could reconnect.
+				if m.grace > 0 && worker.Session() != "" {
+					log.Warnf("Worker [%d] is disconnected, wait [%s] for reconnection.", i.ServiceID, m.grace)
+					m.lost[i.ServiceID] = &lost{worker: worker, since: time.Now()}
+				} else {
+					worker.Destroy()
+				}
 
-				// TODO: Add lock
 				delete(m.workers, i.ServiceID)
 			}
+			if worker, ok := m.connected[i.ServiceID]; ok {
+				worker.Destroy()
+				delete(m.connected, i.ServiceID)
+			}
+			delete(m.enrolled, i.ServiceID)
+			m.locker.Unlock()
 		}
 	}
 }
 
 // OnTick method.
 func (m *Master) OnTick() {
+	if !m.active && atomic.LoadInt32(&m.elected) == 1 {
+		if err := m.activate(); err != nil {
+			log.Criticalf("Master activation failed: %s", err.Error())
+			log.Flush()
+			os.Exit(1)
+		}
+	}
+
+	m.locker.Lock()
+	for id, l := range m.lost {
+		if time.Since(l.since) >= m.grace {
+			log.Warnf("Worker [%d] doesn't reconnect in [%s], its running Actions are interrupted.", id, m.grace)
+			l.worker.Destroy()
+			delete(m.lost, id)
+		}
+	}
+	m.locker.Unlock()
+
+	if m.retention != nil {
+		m.retention.tick(m.List())
+	}
 }
 
 // --- RPC ---
 
-// RPCRegister register a Worker to the Master.
-func (m *Master) RPCRegister(id uint64, supports map[string][]byte) {
-	log.Infof("Master receive Worker [%d] register.", id)
-	worker, ok := m.workers[id]
+// RPCRegister register a Worker to the Master with its enrolled name and
+// token.
+func (m *Master) RPCRegister(id uint64, supports map[string][]byte, name string, token string) {
+	log.Infof("Master receive Worker [%d] [%s] register.", id, name)
+	m.locker.Lock()
+	worker, ok := m.connected[id]
+	delete(m.connected, id)
+	m.locker.Unlock()
 	if !ok {
 		return
 	}
 
+	if m.enroll {
+		if err := m.enrollments.Verify(name, token, id); err != nil {
+			log.Errorf("Reject Worker [%d]: %v.", id, err)
+			worker.Destroy()
+			return
+		}
+	}
+
 	err := worker.Bind(supports)
 	if err != nil {
 		log.Error(err)
 	}
+
+	// Only the registered Worker could call the other RPCs.
+	m.locker.Lock()
+	m.workers[id] = worker
+	if m.enroll {
+		m.enrolled[id] = name
+	}
+	m.locker.Unlock()
+
+	// Let the Worker report to the leader.
+	if m.active {
+		worker.Lead()
+	}
 }
 
-// RPCOnFinish receive the finish status from Worker.
-func (m *Master) RPCOnFinish(worker uint64, action string, runner uint64, success bool, envData []byte) {
-	w, ok := m.workers[worker]
+// RPCSession receives the session id of the Worker process with its running
+// Runners of each Action. The Worker reconnected in the grace period with
+// the same session keeps the running Runners.
+func (m *Master) RPCSession(id uint64, session string, procs map[string][]uint64) {
+	log.Infof("Master receive Worker [%d] session [%s].", id, session)
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	worker, ok := m.workers[id]
+	if !ok {
+		log.Warnf("Reject Worker [%d] session since it's not registered.", id)
+		return
+	}
+
+	var lw IWorker
+	if l, ok := m.lost[id]; ok {
+		lw = l.worker
+		delete(m.lost, id)
+	}
+
+	m.workers[id] = worker.Resume(session, lw, procs)
+}
+
+// RPCRunning receives the running Runners of each Action on the Worker,
+// which could be adopted by the new leader.
+func (m *Master) RPCRunning(id uint64, procs map[string][]uint64) {
+	log.Infof("Master receive Worker [%d] running procs %v.", id, procs)
+	worker, ok := m.registered(id)
+	if !ok {
+		return
+	}
+
+	worker.Running(procs)
+}
+
+// RPCOnFinish receive the finish status from Worker, with the traceparent
+// of the Action span on Worker.
+func (m *Master) RPCOnFinish(worker uint64, action string, runner uint64, success bool, envData []byte, span string) {
+	w, ok := m.registered(worker)
 	if !ok {
-		// TODO: Log error
 		return
 	}
 
@@ -128,25 +344,24 @@ func (m *Master) RPCOnFinish(worker uint64, action string, runner uint64, succes
 		return
 	}
 
-	w.Finish(action, runner, success, e)
+	w.Finish(action, runner, success, e, span)
 }
 
-// RPCOnProgress receive the progress data from Worker.
-func (m *Master) RPCOnProgress(worker uint64, action string, runner uint64, payload []byte) {
-	w, ok := m.workers[worker]
+// RPCOnProgress receive the progress data from Worker, with the traceparent
+// of the Action span on Worker.
+func (m *Master) RPCOnProgress(worker uint64, action string, runner uint64, payload []byte, span string) {
+	w, ok := m.registered(worker)
 	if !ok {
-		// TODO: Log error
 		return
 	}
 
-	w.Progress(action, runner, payload)
+	w.Progress(action, runner, payload, span)
 }
 
 // RPCOnBroadcast receive data from Worker.
 func (m *Master) RPCOnBroadcast(worker uint64, t def.TYPE, payload []byte) {
-	w, ok := m.workers[worker]
+	w, ok := m.registered(worker)
 	if !ok {
-		// TODO: Log error
 		return
 	}
 
@@ -157,6 +372,13 @@ func (m *Master) RPCOnBroadcast(worker uint64, t def.TYPE, payload []byte) {
 
 // Create method.
 func (m *Master) Create(job string) error {
+	if err := checkJobName(job); err != nil {
+		return err
+	}
+
+	m.jobsLocker.Lock()
+	defer m.jobsLocker.Unlock()
+
 	_, ok := m.jobs[job]
 	if ok {
 		return fmt.Errorf("can't create Job [%s] since it's already exist", job)
@@ -179,22 +401,26 @@ func (m *Master) Create(job string) error {
 
 // Delete method.
 func (m *Master) Delete(job string) error {
+	m.jobsLocker.Lock()
 	j, ok := m.jobs[job]
+	delete(m.jobs, job)
+	m.jobsLocker.Unlock()
 	if !ok {
 		return fmt.Errorf("can't delete Job [%s] since it's not exist", job)
 	}
 
 	j.Destroy()
-	delete(m.jobs, job)
 
 	return nil
 }
 
 // Get method.
 func (m *Master) Get(job string) (IJob, error) {
+	m.jobsLocker.RLock()
 	j, ok := m.jobs[job]
+	m.jobsLocker.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("can't find Job [%s] since it's already exist", job)
+		return nil, fmt.Errorf("can't find Job [%s] since it's not exist", job)
 	}
 
 	return j, nil
@@ -202,10 +428,12 @@ func (m *Master) Get(job string) (IJob, error) {
 
 // List method.
 func (m *Master) List() []IJob {
-	jobs := make([]IJob, 0)
+	m.jobsLocker.RLock()
+	jobs := make([]IJob, 0, len(m.jobs))
 	for _, j := range m.jobs {
 		jobs = append(jobs, j)
 	}
+	m.jobsLocker.RUnlock()
 
 	sort.Slice(jobs, func(i, j int) bool {
 		return jobs[i].ID() < jobs[j].ID()
@@ -217,7 +445,7 @@ func (m *Master) List() []IJob {
 // Select method.
 func (m *Master) Select(cmds []ICommand) IWorker {
 	var worker IWorker
-	for _, w := range m.workers {
+	for _, w := range m.Workers() {
 		satisfy := true
 		for _, cmd := range cmds {
 			if !w.Satisfy(cmd) {
@@ -234,12 +462,70 @@ func (m *Master) Select(cmds []ICommand) IWorker {
 	return worker
 }
 
+// Secrets method.
+func (m *Master) Secrets() ISecrets {
+	return m.secrets
+}
+
+// Enrollments method.
+func (m *Master) Enrollments() IEnrollments {
+	return m.enrollments
+}
+
+// Revoke method.
+func (m *Master) Revoke(name string) error {
+	if err := m.enrollments.Revoke(name); err != nil {
+		return err
+	}
+
+	// Disconnect the Workers registered by the name.
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for id, n := range m.enrolled {
+		if n != name {
+			continue
+		}
+
+		if w, ok := m.workers[id]; ok {
+			log.Warnf("Disconnect Worker [%d] since [%s] is revoked.", id, name)
+			w.Destroy()
+			delete(m.workers, id)
+		}
+		delete(m.enrolled, id)
+	}
+
+	return nil
+}
+
+// Templates method.
+func (m *Master) Templates() ITemplates {
+	return m.templates
+}
+
+// Dir method.
+func (m *Master) Dir() string {
+	return m.dir
+}
+
+// Store method.
+func (m *Master) Store() store.IStore {
+	return m.store
+}
+
+// Mirror method.
+func (m *Master) Mirror() IMirror {
+	return m.mirror
+}
+
 // Workers method.
 func (m *Master) Workers() []IWorker {
-	workers := make([]IWorker, 0)
+	m.locker.Lock()
+	workers := make([]IWorker, 0, len(m.workers))
 	for _, w := range m.workers {
 		workers = append(workers, w)
 	}
+	m.locker.Unlock()
 
 	sort.Slice(workers, func(i, j int) bool {
 		return workers[i].ID() < workers[j].ID()
@@ -250,36 +536,106 @@ func (m *Master) Workers() []IWorker {
 
 // --- Inner ---
 
+// activate loads Jobs and serves web as the leader.
+func (m *Master) activate() error {
+	var err error
+	kind, file := StoreOf(m.dir, m.conf["store"])
+	if m.store, err = store.Open(kind, file); err != nil {
+		return err
+	}
+	if err = m.loadJobs(); err != nil {
+		return err
+	}
+
+	m.retention = newRetention(m.conf["retention"])
+
+	resume := false
+	if r, ok := m.conf["resume"]; ok && r.Bool() {
+		resume = true
+	}
+
+	if m.leader != nil {
+		// Continue the Runners left by the last leader.
+		deadline := time.Now().Add(ADOPTTIMEOUT)
+		for _, j := range m.List() {
+			go j.(*job).takeover(deadline, resume)
+		}
+	} else if resume {
+		// Re-run interrupted Runners if it's enabled.
+		for _, j := range m.List() {
+			go j.(*job).resume()
+		}
+	}
+
+	conf, ok := m.conf["web"]
+	if !ok {
+		return errors.New("not setting \"web\" for Master configure")
+	}
+
+	// Run http service.
+	m.web = NewWeb(m, conf, m.base)
+	if m.web == nil {
+		return errors.New("\"web\" of Master configure is incorrect")
+	}
+	if err = m.web.Serve(); err != nil {
+		return err
+	}
+
+	m.active = true
+	for _, w := range m.Workers() {
+		w.Lead()
+	}
+
+	return nil
+}
+
+// checkJobName returns an error if the Job name is invalid.
+func checkJobName(name string) error {
+	if !jobNameExp.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("job name [%s] is invalid", name)
+	}
+
+	return nil
+}
+
+// registered returns the registered Worker by id, the calls from others
+// are rejected.
+func (m *Master) registered(id uint64) (IWorker, bool) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	w, ok := m.workers[id]
+	if !ok {
+		log.Warnf("Reject Worker [%d] call since it's not registered.", id)
+	}
+	return w, ok
+}
+
 func (m *Master) loadJobs() error {
-	m.jobs = make(map[string]IJob)
+	jobs := make(map[string]IJob)
 
-	ext, _ := os.Executable()
-	dir, err := os.Open(path.Join(filepath.Dir(ext), "jobs"))
-	stat, err := dir.Stat()
+	names, err := m.store.List("")
 	if err != nil {
 		return err
 	}
 
-	if stat.IsDir() {
-		fs, err := dir.Readdir(-1)
+	for _, n := range names {
+		name, uid, ok := jobOf(n)
+		if !ok {
+			continue
+		}
+
+		j, err := NewJob(m, uid, name)
 		if err != nil {
 			return err
 		}
 
-		for _, f := range fs {
-			if f.IsDir() {
-				parts := strings.Split(f.Name(), "@")
-				name := parts[0]
-				uid, _ := strconv.ParseUint(parts[1], 16, 64)
-				j, err := NewJob(m, uid, name)
-				if err != nil {
-					return err
-				}
-
-				m.jobs[j.Name()] = j
-			}
-		}
+		jobs[j.Name()] = j
 	}
 
+	m.jobsLocker.Lock()
+	m.jobs = jobs
+	m.jobsLocker.Unlock()
+
 	return nil
 }
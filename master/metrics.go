@@ -0,0 +1,199 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// metrics renders the telemetry of Master and all Workers in Prometheus
+// text format for the "/metrics" endpoint. Durations are collected when
+// commands are completed, and the others are read when it's scraped.
+
+package master
+
+import (
+	"bubble/def"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BUCKETS defines the upper bounds (seconds) of the duration histograms.
+var BUCKETS = []float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// telemetry collects the durations of all Jobs.
+var telemetry = newMetrics()
+
+var statusNames = map[def.STATUS]string{
+	def.NOTSTART:  "notstart",
+	def.SUCCESS:   "success",
+	def.ONGOING:   "ongoing",
+	def.PENDING:   "pending",
+	def.FAILURE:   "failure",
+	def.CANCEL:    "cancel",
+	def.INTERRUPT: "interrupt",
+	def.SKIPPED:   "skipped",
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(BUCKETS))
+	}
+
+	for i, b := range BUCKETS {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func newMetrics() *metrics {
+	return &metrics{commands: make(map[string]*histogram), queue: &histogram{}}
+}
+
+type metrics struct {
+	locker   sync.Mutex
+	commands map[string]*histogram
+	queue    *histogram
+}
+
+// command observes the duration of a completed command by Action name.
+func (m *metrics) command(action string, d time.Duration) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	h, ok := m.commands[action]
+	if !ok {
+		h = &histogram{}
+		m.commands[action] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// wait observes the time of a command waiting for a Worker.
+func (m *metrics) wait(d time.Duration) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	m.queue.observe(d.Seconds())
+}
+
+// Metrics returns all metrics in Prometheus text format.
+func (m *Master) Metrics() []byte {
+	var buf bytes.Buffer
+
+	// Runners by status.
+	runners := make(map[def.STATUS]int)
+	for _, j := range m.List() {
+		for _, r := range j.Runners() {
+			runners[r.Status()]++
+		}
+	}
+	header(&buf, "bubble_runners", "gauge", "Runners by status.")
+	for _, s := range sortedStatuses() {
+		fmt.Fprintf(&buf, "bubble_runners{status=%q} %d\n", statusNames[s], runners[s])
+	}
+
+	telemetry.locker.Lock()
+	header(&buf, "bubble_command_duration_seconds", "histogram", "Command durations by Action.")
+	actions := make([]string, 0, len(telemetry.commands))
+	for a := range telemetry.commands {
+		actions = append(actions, a)
+	}
+	sort.Strings(actions)
+	for _, a := range actions {
+		writeHistogram(&buf, "bubble_command_duration_seconds", fmt.Sprintf("action=%q", a), telemetry.commands[a])
+	}
+
+	header(&buf, "bubble_queue_wait_seconds", "histogram", "Time of commands waiting for a Worker.")
+	writeHistogram(&buf, "bubble_queue_wait_seconds", "", telemetry.queue)
+	telemetry.locker.Unlock()
+
+	// Workers.
+	workers := m.Workers()
+	header(&buf, "bubble_workers", "gauge", "Connected Workers.")
+	fmt.Fprintf(&buf, "bubble_workers %d\n", len(workers))
+
+	header(&buf, "bubble_worker_workload", "gauge", "Executing commands of each Worker.")
+	for _, w := range workers {
+		fmt.Fprintf(&buf, "bubble_worker_workload{worker=%q} %d\n", strconv.FormatUint(w.ID(), 16), w.Workload())
+	}
+
+	header(&buf, "bubble_worker_actions", "gauge", "Executing count of each Action on each Worker.")
+	for _, w := range workers {
+		if wm := w.Metrics(); wm != nil {
+			names := make([]string, 0, len(wm.Actions))
+			for a := range wm.Actions {
+				names = append(names, a)
+			}
+			sort.Strings(names)
+			for _, a := range names {
+				fmt.Fprintf(&buf, "bubble_worker_actions{worker=%q,action=%q} %d\n", strconv.FormatUint(w.ID(), 16), a, wm.Actions[a])
+			}
+		}
+	}
+
+	header(&buf, "bubble_worker_disk_bytes", "gauge", "Bytes of the jobs folder on each Worker.")
+	for _, w := range workers {
+		if wm := w.Metrics(); wm != nil {
+			fmt.Fprintf(&buf, "bubble_worker_disk_bytes{worker=%q} %d\n", strconv.FormatUint(w.ID(), 16), wm.Disk)
+		}
+	}
+
+	header(&buf, "bubble_worker_transfer_bytes_total", "counter", "Bytes of disk transfer between Workers.")
+	for _, w := range workers {
+		if wm := w.Metrics(); wm != nil {
+			id := strconv.FormatUint(w.ID(), 16)
+			fmt.Fprintf(&buf, "bubble_worker_transfer_bytes_total{worker=%q,direction=\"sent\"} %d\n", id, wm.Sent)
+			fmt.Fprintf(&buf, "bubble_worker_transfer_bytes_total{worker=%q,direction=\"received\"} %d\n", id, wm.Received)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func header(buf *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(buf *bytes.Buffer, name string, labels string, h *histogram) {
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
+
+	for i, b := range BUCKETS {
+		var c uint64
+		if h.counts != nil {
+			c = h.counts[i]
+		}
+		fmt.Fprintf(buf, "%s_bucket{%sle=%q} %d\n", name, prefix, strconv.FormatFloat(b, 'g', -1, 64), c)
+	}
+	fmt.Fprintf(buf, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'f', -1, 64))
+	fmt.Fprintf(buf, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func sortedStatuses() []def.STATUS {
+	statuses := make([]def.STATUS, 0, len(statusNames))
+	for s := range statusNames {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i] < statuses[j]
+	})
+
+	return statuses
+}
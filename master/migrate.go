@@ -0,0 +1,133 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"bubble/store"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// STOREFILE defines the default database file name of the bolt store.
+	STOREFILE string = ".bubble.db"
+)
+
+var (
+	// jobStates are the store keys of Job states.
+	jobStates = []string{BUBBLEFILE, REPOFILE, CRONFILE}
+	// runnerStates are the store keys of Runner and Command states.
+	runnerStates = []string{BUBBLEFILE, REVISIONFILE, STATUSFILE, METAFILE}
+)
+
+// StoreOf returns the store type and path of the `store` configure, the
+// path is the "jobs" folder or STOREFILE in the data folder by default.
+func StoreOf(dir string, conf env.IAny) (string, string) {
+	kind, file := "", ""
+	if conf != nil && conf.IsMap() {
+		m := conf.Map()
+		if v, ok := m["type"]; ok {
+			kind = v.ToString()
+		}
+		if v, ok := m["path"]; ok {
+			file = v.ToString()
+		}
+	}
+
+	return kind, DefaultStorePath(dir, kind, file)
+}
+
+// DefaultStorePath returns the path based on the data folder if it's set,
+// or the default path of the store type.
+func DefaultStorePath(dir string, kind string, file string) string {
+	if file != "" {
+		return def.Abs(dir, file)
+	}
+
+	if kind == store.BOLT {
+		return path.Join(dir, STOREFILE)
+	}
+
+	return path.Join(dir, "jobs")
+}
+
+// Migrate copies all Job, Runner, Command and Cron states from src store to
+// dst store, and returns the count of migrated Jobs and Runners. Logs are
+// kept in the Job folders, so they don't need migration.
+func Migrate(src store.IStore, dst store.IStore) (int, int, error) {
+	names, err := src.List("")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	jobs, runners := 0, 0
+	for _, n := range names {
+		if _, _, ok := jobOf(n); !ok {
+			continue
+		}
+
+		if err = migrate(src, dst, n, jobStates); err != nil {
+			return jobs, runners, err
+		}
+		jobs++
+
+		children, err := src.List(n)
+		if err != nil {
+			return jobs, runners, err
+		}
+		for _, c := range children {
+			if _, err := strconv.ParseUint(c, 16, 64); err != nil {
+				continue
+			}
+
+			if err = migrate(src, dst, path.Join(n, c), runnerStates); err != nil {
+				return jobs, runners, err
+			}
+			runners++
+		}
+	}
+
+	return jobs, runners, nil
+}
+
+// migrate copies the existing states under prefix.
+func migrate(src store.IStore, dst store.IStore, prefix string, states []string) error {
+	for _, s := range states {
+		key := path.Join(prefix, s)
+		bytes, err := src.Get(key)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		if err = dst.Put(key, bytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jobOf parses the Job name and id from its folder name "<name>@<id>". The
+// name could contain "@", so it's split by the last one.
+func jobOf(folder string) (string, uint64, bool) {
+	i := strings.LastIndex(folder, "@")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	uid, err := strconv.ParseUint(folder[i+1:], 16, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return folder[:i], uid, true
+}
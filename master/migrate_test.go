@@ -0,0 +1,205 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/store"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestJobOf(t *testing.T) {
+	cases := []struct {
+		folder string
+		name   string
+		uid    uint64
+		ok     bool
+	}{
+		{"build@1f", "build", 0x1f, true},
+		{"ops@prod@2a", "ops@prod", 0x2a, true},
+		{"a.b-c@ff", "a.b-c", 0xff, true},
+		{"build", "", 0, false},
+		{"@1f", "", 0, false},
+		{"build@", "", 0, false},
+		{"build@xyz", "", 0, false},
+		{".bubble.db", "", 0, false},
+	}
+
+	for _, c := range cases {
+		name, uid, ok := jobOf(c.folder)
+		if name != c.name || uid != c.uid || ok != c.ok {
+			t.Errorf("jobOf [%s] expect [%s] [%x] [%t], but actual [%s] [%x] [%t]", c.folder, c.name, c.uid, c.ok, name, uid, ok)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := store.NewFileStore(path.Join(dir, "jobs"))
+	bolt, err := store.NewBoltStore(path.Join(dir, STOREFILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	states := map[string]string{
+		"build@1/" + BUBBLEFILE:       "script",
+		"build@1/" + CRONFILE:         "crons",
+		"build@1/a/" + STATUSFILE:     "status a",
+		"build@1/a/" + BUBBLEFILE:     "script a",
+		"build@1/b/" + METAFILE:       "meta b",
+		"ops@prod@2/" + BUBBLEFILE:    "script ops",
+		"ops@prod@2/c/" + STATUSFILE:  "status c",
+		"build@1/a/0/log":             "not a state",
+		"build@1/notes/" + STATUSFILE: "not a runner",
+		"templates/" + BUBBLEFILE:     "not a job",
+	}
+	for k, v := range states {
+		if err := files.Put(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, runners, err := Migrate(files, bolt)
+	if err != nil || jobs != 2 || runners != 3 {
+		t.Fatalf("Migrate expect [2] Jobs and [3] Runners, but actual [%d] [%d] [%v]", jobs, runners, err)
+	}
+
+	// Migrate back to an empty file store.
+	back := store.NewFileStore(path.Join(dir, "back"))
+	if jobs, runners, err = Migrate(bolt, back); err != nil || jobs != 2 || runners != 3 {
+		t.Fatalf("Migrate back expect [2] Jobs and [3] Runners, but actual [%d] [%d] [%v]", jobs, runners, err)
+	}
+
+	for k, v := range states {
+		migrated := k != "build@1/a/0/log" && k != "build@1/notes/"+STATUSFILE && k != "templates/"+BUBBLEFILE
+		for _, s := range []store.IStore{bolt, back} {
+			bytes, err := s.Get(k)
+			if migrated && (err != nil || string(bytes) != v) {
+				t.Errorf("Get [%s] expect [%s], but actual [%s] [%v]", k, v, bytes, err)
+			} else if !migrated && !os.IsNotExist(err) {
+				t.Errorf("Get [%s] expect not migrated, but actual [%s] [%v]", k, bytes, err)
+			}
+		}
+	}
+}
+
+func TestCheckJobName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"build", true},
+		{"ops@prod", true},
+		{"a.b-c_d", true},
+		{"", false},
+		{"a/b", false},
+		{"..", false},
+		{"a..b", false},
+		{"../etc", false},
+		{"a b", false},
+	}
+
+	for _, c := range cases {
+		err := checkJobName(c.name)
+		if (err == nil) != c.valid {
+			t.Errorf("checkJobName [%s] expect valid [%t], but actual error [%v]", c.name, c.valid, err)
+		}
+	}
+
+	m := &Master{jobs: make(map[string]IJob)}
+	if err := m.Create("../etc"); err == nil || len(m.jobs) != 0 {
+		t.Errorf("Create [../etc] expect failure, but actual [%v]", err)
+	}
+}
+
+func TestLoadJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{dir: dir, store: store.NewFileStore(path.Join(dir, "jobs"))}
+	names := []string{"build", "ops@prod", "a.b-c_d"}
+	for i, name := range names {
+		if _, err := NewJob(m, uint64(i+1), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Jobs are loaded with the same names and ids.
+	if err := m.loadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		if j, ok := m.jobs[name]; !ok || j.ID() != uint64(i+1) {
+			t.Errorf("loadJobs expect Job [%s] [%d], but actual [%v]", name, i+1, j)
+		}
+	}
+	if len(m.jobs) != 3 {
+		t.Errorf("loadJobs expect [3] Jobs, but actual [%d]", len(m.jobs))
+	}
+}
+
+func TestJobsConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{dir: dir, store: store.NewFileStore(path.Join(dir, "jobs"))}
+	names := []string{"a", "b", "c", "d"}
+	for i, name := range names {
+		if _, err := NewJob(m, uint64(i+1), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Jobs are deleted on web goroutines while others read them.
+	var wg sync.WaitGroup
+	wg.Add(2 + len(names))
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			m.loadJobs()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			m.List()
+			m.Create(names[i%len(names)])
+		}
+	}()
+	for _, name := range names {
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				m.Get(name)
+			}
+			m.Delete(name)
+		}(name)
+	}
+	wg.Wait()
+
+	if err := m.loadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range m.List() {
+		if _, err := m.Get(j.Name()); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// mirror keeps a bare mirror for each repository under dir, so every
+// Runner only needs to fetch the changes since last time. It depends on
+// the `git` command on Master.
+
+package master
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// schemes are the repository URL schemes allowed to clone, local and
+// helper transports like file:// and ext:: are not allowed.
+var schemes = []string{"https://", "ssh://", "git://"}
+
+// scpLike matches the scp-like ssh URL, e.g. git@github.com:bubble/bubble.git
+var scpLike = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^:]`)
+
+// checkURL makes sure the repository url is safe to pass to git.
+func checkURL(url string) error {
+	if url == "" {
+		return fmt.Errorf("repository url is empty")
+	}
+	if strings.HasPrefix(url, "-") {
+		return fmt.Errorf("repository url [%s] is invalid", url)
+	}
+
+	for _, s := range schemes {
+		if strings.HasPrefix(strings.ToLower(url), s) {
+			return nil
+		}
+	}
+	if scpLike.MatchString(url) {
+		return nil
+	}
+
+	return fmt.Errorf("repository url [%s] is not https, ssh or git", url)
+}
+
+// checkRef makes sure the ref won't be taken as git option.
+func checkRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("repository ref [%s] is invalid", ref)
+	}
+
+	return nil
+}
+
+// NewMirror method create an IMirror by cache directory.
+func NewMirror(dir string) IMirror {
+	return &mirror{dir: dir, lockers: make(map[string]*sync.Mutex)}
+}
+
+type mirror struct {
+	dir     string
+	locker  sync.Mutex
+	lockers map[string]*sync.Mutex
+}
+
+func (m *mirror) Checkout(url string, ref string, file string) (string, []byte, error) {
+	if err := checkURL(url); err != nil {
+		return "", nil, err
+	}
+	if err := checkRef(ref); err != nil {
+		return "", nil, err
+	}
+
+	l := m.lock(url)
+	l.Lock()
+	defer l.Unlock()
+
+	dir := m.path(url)
+	if err := m.fetch(url, dir); err != nil {
+		return "", nil, err
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := git(dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("repository [%s] ref [%s] is not exist", url, ref)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	content, err := git(dir, "show", commit+":"+strings.TrimPrefix(file, "/"))
+	if err != nil {
+		return commit, nil, fmt.Errorf("repository [%s] file [%s] is not exist at [%s]", url, file, commit)
+	}
+
+	return commit, content, nil
+}
+
+func (m *mirror) fetch(url string, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		if _, err = git(dir, "remote", "update", "--prune"); err != nil {
+			return fmt.Errorf("fetch repository [%s] failed: %s", url, err.Error())
+		}
+
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	log.Infof("Mirror repository [%s] into [%s].\n", url, dir)
+	if _, err := git(m.dir, "clone", "--mirror", "--", url, dir); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("clone repository [%s] failed: %s", url, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mirror) lock(url string) *sync.Mutex {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	l, ok := m.lockers[url]
+	if !ok {
+		l = &sync.Mutex{}
+		m.lockers[url] = l
+	}
+
+	return l
+}
+
+func (m *mirror) path(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return path.Join(m.dir, hex.EncodeToString(sum[:])+".git")
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	cases := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://github.com/bubble/bubble.git", true},
+		{"HTTPS://github.com/bubble/bubble.git", true},
+		{"ssh://git@github.com/bubble/bubble.git", true},
+		{"git://github.com/bubble/bubble.git", true},
+		{"git@github.com:bubble/bubble.git", true},
+		{"", false},
+		{"--upload-pack=touch /tmp/pwned", false},
+		{"-uhttps://github.com/bubble/bubble.git", false},
+		{"file:///etc", false},
+		{"/var/repos/bubble.git", false},
+		{"ext::sh -c touch% /tmp/pwned", false},
+		{"http://github.com/bubble/bubble.git", false},
+		{"fd::17", false},
+	}
+
+	for _, c := range cases {
+		err := checkURL(c.url)
+		if (err == nil) != c.valid {
+			t.Errorf("Check url [%s] expect valid [%t], but error is [%v]", c.url, c.valid, err)
+		}
+	}
+}
+
+func TestCheckRef(t *testing.T) {
+	cases := []struct {
+		ref   string
+		valid bool
+	}{
+		{"", true},
+		{"main", true},
+		{"refs/tags/v1.0", true},
+		{"feature/a-b", true},
+		{"--output=/tmp/pwned", false},
+		{"-h", false},
+	}
+
+	for _, c := range cases {
+		err := checkRef(c.ref)
+		if (err == nil) != c.valid {
+			t.Errorf("Check ref [%s] expect valid [%t], but error is [%v]", c.ref, c.valid, err)
+		}
+	}
+
+	repo := &Repo{URL: "https://github.com/bubble/bubble.git", Branch: "--output=/tmp/pwned"}
+	if repo.validate() == nil {
+		t.Errorf("Repo with branch [%s] should be invalid", repo.Branch)
+	}
+}
+
+func TestMirrorCheckout(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Prepare the mirror of a local repository, as if it's cloned from url.
+	src := path.Join(dir, "src")
+	run := func(dir string, args ...string) {
+		if _, err := git(dir, args...); err != nil {
+			t.Fatalf("git %v failed: %s", args, err)
+		}
+	}
+	os.MkdirAll(src, os.ModePerm)
+	run(src, "init", "-q")
+	ioutil.WriteFile(path.Join(src, BUBBLEFILE), []byte("name: test"), os.ModePerm)
+	run(src, "add", ".")
+	run(src, "-c", "user.name=bubble", "-c", "user.email=bubble@localhost", "commit", "-q", "-m", "init")
+
+	url := "https://example.com/bubble.git"
+	m := NewMirror(path.Join(dir, "repos")).(*mirror)
+	os.MkdirAll(m.dir, os.ModePerm)
+	run(m.dir, "clone", "-q", "--mirror", "--", src, m.path(url))
+
+	commit, content, err := m.Checkout(url, "", BUBBLEFILE)
+	if err != nil || commit == "" || string(content) != "name: test" {
+		t.Errorf("Checkout HEAD failed: [%s] [%s] %v", commit, content, err)
+	}
+
+	pwned := path.Join(dir, "pwned")
+	for _, ref := range []string{"--output=" + pwned, "-h"} {
+		if _, _, err = m.Checkout(url, ref, BUBBLEFILE); err == nil {
+			t.Errorf("Checkout ref [%s] should fail", ref)
+		}
+	}
+	if _, _, err = m.Checkout("--upload-pack=touch "+pwned, "", BUBBLEFILE); err == nil {
+		t.Error("Checkout option url should fail")
+	}
+	if _, err = os.Stat(pwned); err == nil {
+		t.Error("Option injection creates file")
+	}
+}
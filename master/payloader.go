@@ -2,82 +2,263 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 
+// payloader appends the log chunks of a command to disk as they arrive,
+// and records the byte offset, line number, timestamp and length of each
+// chunk in an index file. Completed logs are compressed with gzip in the
+// background, as a gzip member per BLOCKSIZE bytes, and the offsets of
+// members are kept in a block index file, so a range is read from the
+// member containing it.
+
 package master
 
 import (
+	"bubble/def"
 	gobytes "bytes"
-	"errors"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
 )
 
 // newPayloader method create a new payloader by path.
 func newPayloader(path string) *payloader {
-	p := &payloader{path: path, flag: UNFLUSHED}
+	p := &payloader{path: path}
 
-	_, err := os.Stat(path)
-	if err == nil {
-		p.flag = FLUSHED
+	if stat, err := os.Stat(path); err == nil {
+		p.size = stat.Size()
+		p.lines = -1
+	} else if _, err := os.Stat(p.gzPath()); err == nil {
+		p.compressed = true
+		p.lines = -1
+		if c := p.last(); c != nil {
+			p.size = c.Offset + c.Length
+		}
 	}
 
 	return p
 }
 
 const (
-	// UNFLUSHED state.
-	UNFLUSHED byte = 0
-	// FLUSHING state.
-	FLUSHING byte = 1
-	// FLUSHED state.
-	FLUSHED byte = 2
-	// SEGLENGTH state.
+	// SEGLENGTH defines the max length of log returned without full.
 	SEGLENGTH int = 10 * 1024
+	// GZEXT defines the compressed log file extension.
+	GZEXT string = ".gz"
+	// IDXEXT defines the chunk index file extension.
+	IDXEXT string = ".idx"
+	// BLOCKEXT defines the block index file extension of compressed log.
+	BLOCKEXT string = ".gzi"
+	// BLOCKSIZE defines the uncompressed bytes of a gzip member.
+	BLOCKSIZE int64 = 64 * 1024
+	// chunkSize is the bytes of a chunk record in the index file.
+	chunkSize int64 = 32
+	// blockSize is the bytes of a block record in the block index file.
+	blockSize int64 = 16
 )
 
+// Chunk presents a written log chunk.
+type Chunk struct {
+	Offset int64 `json:"offset"`
+	Line   int64 `json:"line"`
+	Time   int64 `json:"time"`
+	Length int64 `json:"length"`
+}
+
 type payloader struct {
-	path   string
-	buf    gobytes.Buffer
-	locker sync.Mutex
-	flag   byte
+	path        string
+	locker      sync.Mutex
+	file        *os.File
+	index       *os.File
+	size        int64
+	lines       int64
+	compressed  bool
+	masks       [][]byte
+	version     int64
+	compressing bool
 }
 
 func (p *payloader) Write(bytes []byte) (int, error) {
-	if bytes == nil || len(bytes) == 0 {
-		return 0, nil
+	p.append(bytes)
+	return len(bytes), nil
+}
+
+// append writes the masked bytes, and returns them with the byte offset
+// in the log.
+func (p *payloader) append(bytes []byte) ([]byte, int64) {
+	if len(bytes) == 0 {
+		return nil, 0
 	}
 
 	p.locker.Lock()
 	defer p.locker.Unlock()
 
-	return p.buf.Write(bytes)
+	bytes = p.hide(bytes)
+	if err := p.open(); err != nil {
+		return bytes, p.size
+	}
+
+	offset := p.size
+	n, _ := p.file.Write(bytes)
+
+	var record [chunkSize]byte
+	binary.LittleEndian.PutUint64(record[0:], uint64(offset))
+	binary.LittleEndian.PutUint64(record[8:], uint64(p.lines))
+	binary.LittleEndian.PutUint64(record[16:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	binary.LittleEndian.PutUint64(record[24:], uint64(n))
+	p.index.Write(record[:])
+
+	p.size += int64(n)
+	p.lines += int64(gobytes.Count(bytes[:n], []byte{'\n'}))
+
+	return bytes, offset
 }
 
-func (p *payloader) Bytes(full bool) ([]byte, bool, error) {
-	if p.flag == FLUSHED {
-		p.flag = FLUSHING
-		go func() {
-			bytes, err := ioutil.ReadFile(p.path)
-			if err != nil {
-				p.flag = FLUSHED
-				return
-			}
+// mask makes all values replaced in the written payloads.
+func (p *payloader) mask(values ...string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
 
-			p.Write(bytes)
-			p.flag = UNFLUSHED
-		}()
+	for _, m := range def.Masks(values...) {
+		p.masks = append(p.masks, []byte(m))
 	}
+}
 
-	if p.flag != UNFLUSHED {
-		return nil, full, errors.New("payload is not loaded")
+// masked returns the text with all mask values replaced.
+func (p *payloader) masked(text string) string {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return string(p.hide([]byte(text)))
+}
+
+// Size returns the total bytes of the log.
+func (p *payloader) Size() int64 {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.size
+}
+
+// Range returns at most limit bytes (no limit if it's not positive) of the
+// log from offset.
+func (p *payloader) Range(offset int64, limit int64) ([]byte, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.read(offset, limit)
+}
+
+func (p *payloader) read(offset int64, limit int64) ([]byte, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= p.size {
+		return nil, nil
 	}
 
-	all := p.buf.Bytes()
-	if full || len(all) <= SEGLENGTH {
-		return all, true, nil
+	length := p.size - offset
+	if limit > 0 && limit < length {
+		length = limit
+	}
+
+	if p.compressed {
+		f, err := os.Open(p.gzPath())
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		// Start from the member containing offset.
+		start, seek := p.block(offset)
+		if _, err = f.Seek(seek, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		if _, err = io.CopyN(ioutil.Discard, r, offset-start); err != nil {
+			return nil, err
+		}
+
+		bytes := make([]byte, length)
+		n, err := io.ReadFull(r, bytes)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		return bytes[:n], nil
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	bytes := make([]byte, length)
+	n, err := f.ReadAt(bytes, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return bytes[:n], nil
+}
+
+// Chunks returns all chunks overlapped with the range from offset.
+func (p *payloader) Chunks(offset int64, limit int64) ([]*Chunk, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	bytes, err := ioutil.ReadFile(p.idxPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Chunk{}, nil
+		}
+		return nil, err
+	}
+
+	end := p.size
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	chunks := make([]*Chunk, 0)
+	for i := int64(0); i+chunkSize <= int64(len(bytes)); i += chunkSize {
+		c := decodeChunk(bytes[i : i+chunkSize])
+		if c.Offset+c.Length > offset && c.Offset < end {
+			chunks = append(chunks, c)
+		}
+	}
+
+	return chunks, nil
+}
+
+// Bytes returns the whole log if full is true, or the last lines of at
+// most SEGLENGTH bytes, with whether it's the whole log.
+func (p *payloader) Bytes(full bool) ([]byte, bool, error) {
+	size := p.Size()
+	if full || size <= int64(SEGLENGTH) {
+		bytes, err := p.Range(0, 0)
+		return bytes, true, err
+	}
+
+	part, err := p.Range(size-int64(SEGLENGTH), 0)
+	if err != nil {
+		return nil, false, err
 	}
 
-	part := all[len(all)-SEGLENGTH:]
 	i := gobytes.IndexByte(part, '\n')
 	if i < 0 || i >= len(part)-1 {
 		return part, false, nil
@@ -86,17 +267,272 @@ func (p *payloader) Bytes(full bool) ([]byte, bool, error) {
 	return part[i+1:], false, nil
 }
 
+// Flush closes the log files and compresses the log in the background.
 func (p *payloader) Flush() {
-	if p.flag == UNFLUSHED {
-		p.flag = FLUSHING
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.close()
+	if p.compressed || p.compressing || p.size == 0 {
+		return
+	}
+
+	p.compressing = true
+	go func() {
+		if err := p.compress(); err != nil {
+			log.Errorf("Compress log [%s] failed: %s", p.path, err.Error())
+		}
+	}()
+}
 
-		go func() {
-			p.locker.Lock()
-			defer p.locker.Unlock()
+// --- Inner ---
+
+func (p *payloader) hide(bytes []byte) []byte {
+	for _, m := range p.masks {
+		bytes = gobytes.Replace(bytes, m, []byte(SECRETMASK), -1)
+	}
+
+	return bytes
+}
+
+func (p *payloader) open() error {
+	if p.file != nil {
+		return nil
+	}
+
+	// Continue writing a compressed log.
+	if p.compressed {
+		if err := p.decompress(); err != nil {
+			return err
+		}
+	}
+
+	// Count lines of the existing log.
+	if p.lines < 0 {
+		bytes, err := p.read(0, p.size)
+		if err != nil {
+			return err
+		}
+		p.lines = int64(gobytes.Count(bytes, []byte{'\n'}))
+	}
+
+	var err error
+	p.version++
+	if p.file, err = os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm); err != nil {
+		return err
+	}
+
+	if p.index, err = os.OpenFile(p.idxPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm); err != nil {
+		p.file.Close()
+		p.file = nil
+		return err
+	}
+
+	return nil
+}
+
+func (p *payloader) close() {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	if p.index != nil {
+		p.index.Close()
+		p.index = nil
+	}
+}
+
+// compress replaces the closed log with gzip members of BLOCKSIZE and the
+// block index. The result is dropped if the log is reopened meanwhile, and
+// it's compressed again after the next Flush.
+func (p *payloader) compress() error {
+	tmp := p.gzPath() + ".tmp"
+	blocks := p.blockPath() + ".tmp"
+	defer os.Remove(tmp)
+	defer os.Remove(blocks)
+	defer func() {
+		p.locker.Lock()
+		p.compressing = false
+		p.locker.Unlock()
+	}()
+
+	for {
+		p.locker.Lock()
+		version, done := p.version, p.compressed || p.file != nil
+		p.locker.Unlock()
+		if done {
+			return nil
+		}
+
+		if err := p.deflate(tmp, blocks); err != nil {
+			return err
+		}
+
+		p.locker.Lock()
+		if p.version != version {
+			p.locker.Unlock()
+			continue
+		}
+
+		err := os.Rename(blocks, p.blockPath())
+		if err == nil {
+			err = os.Rename(tmp, p.gzPath())
+		}
+		if err == nil {
+			p.compressed = true
+			err = os.Remove(p.path)
+		}
+		p.locker.Unlock()
+
+		return err
+	}
+}
+
+// deflate writes the log into file as gzip members of BLOCKSIZE, and the
+// uncompressed and compressed offsets of each member into blocks.
+func (p *payloader) deflate(file string, blocks string) error {
+	src, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	index := make([]byte, 0)
+	buf := make([]byte, BLOCKSIZE)
+	var offset, seek int64
+	for {
+		n, rerr := io.ReadFull(src, buf)
+		if n > 0 {
+			var record [blockSize]byte
+			binary.LittleEndian.PutUint64(record[0:], uint64(offset))
+			binary.LittleEndian.PutUint64(record[8:], uint64(seek))
+			index = append(index, record[:]...)
+
+			w := gzip.NewWriter(dst)
+			if _, err = w.Write(buf[:n]); err == nil {
+				err = w.Close()
+			}
+			if err != nil {
+				return err
+			}
+
+			offset += int64(n)
+			if seek, err = dst.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+
+	if err = dst.Sync(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(blocks, index, os.ModePerm)
+}
+
+// block returns the uncompressed and compressed offsets of the gzip member
+// containing offset. A log compressed without the block index is a single
+// member.
+func (p *payloader) block(offset int64) (int64, int64) {
+	bytes, err := ioutil.ReadFile(p.blockPath())
+	if err != nil {
+		return 0, 0
+	}
+
+	count := len(bytes) / int(blockSize)
+	i := sort.Search(count, func(i int) bool {
+		return int64(binary.LittleEndian.Uint64(bytes[int64(i)*blockSize:])) > offset
+	}) - 1
+	if i < 0 {
+		return 0, 0
+	}
+
+	record := bytes[int64(i)*blockSize:]
+	return int64(binary.LittleEndian.Uint64(record[0:])), int64(binary.LittleEndian.Uint64(record[8:]))
+}
+
+func (p *payloader) decompress() error {
+	src, err := os.Open(p.gzPath())
+	if err != nil {
+		return err
+	}
+
+	r, err := gzip.NewReader(src)
+	if err != nil {
+		src.Close()
+		return err
+	}
+
+	dst, err := os.Create(p.path)
+	if err == nil {
+		if _, err = io.Copy(dst, r); err == nil {
+			err = dst.Close()
+		} else {
+			dst.Close()
+		}
+	}
+	r.Close()
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	p.compressed = false
+	os.Remove(p.blockPath())
+	return os.Remove(p.gzPath())
+}
+
+// last returns the last chunk record in the index file.
+func (p *payloader) last() *Chunk {
+	f, err := os.Open(p.idxPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || stat.Size() < chunkSize {
+		return nil
+	}
+
+	var record [chunkSize]byte
+	if _, err = f.ReadAt(record[:], stat.Size()/chunkSize*chunkSize-chunkSize); err != nil {
+		return nil
+	}
+
+	return decodeChunk(record[:])
+}
+
+func (p *payloader) idxPath() string {
+	return p.path + IDXEXT
+}
+
+func (p *payloader) gzPath() string {
+	return p.path + GZEXT
+}
+
+func (p *payloader) blockPath() string {
+	return p.path + BLOCKEXT
+}
 
-			ioutil.WriteFile(p.path, p.buf.Bytes(), os.ModePerm)
-			p.buf.Reset()
-			p.flag = FLUSHED
-		}()
+func decodeChunk(record []byte) *Chunk {
+	return &Chunk{
+		Offset: int64(binary.LittleEndian.Uint64(record[0:])),
+		Line:   int64(binary.LittleEndian.Uint64(record[8:])),
+		Time:   int64(binary.LittleEndian.Uint64(record[16:])),
+		Length: int64(binary.LittleEndian.Uint64(record[24:])),
 	}
 }
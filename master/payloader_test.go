@@ -0,0 +1,146 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	gobytes "bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestPayloaderRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, ".0.log")
+	p := newPayloader(file)
+	var expect gobytes.Buffer
+	for i := 0; i < 20000; i++ {
+		line := fmt.Sprintf("line %d of the log\n", i)
+		p.Write([]byte(line))
+		expect.WriteString(line)
+	}
+	all := expect.Bytes()
+
+	check := func(name string, p *payloader) {
+		cases := []struct {
+			offset int64
+			limit  int64
+		}{
+			{0, 0},
+			{0, 100},
+			{BLOCKSIZE - 10, 20},
+			{BLOCKSIZE, 1},
+			{3*BLOCKSIZE + 7, 2 * BLOCKSIZE},
+			{int64(len(all)) - 5, 100},
+			{int64(len(all)), 10},
+			{-1, 10},
+		}
+
+		for _, c := range cases {
+			bytes, err := p.Range(c.offset, c.limit)
+			if err != nil {
+				t.Errorf("[%s] Range [%d] [%d] failed: %s", name, c.offset, c.limit, err)
+				continue
+			}
+
+			from := c.offset
+			if from < 0 {
+				from = 0
+			}
+			to := int64(len(all))
+			if c.limit > 0 && from+c.limit < to {
+				to = from + c.limit
+			}
+			if from > to {
+				from = to
+			}
+			if !gobytes.Equal(bytes, all[from:to]) {
+				t.Errorf("[%s] Range [%d] [%d] returns %d bytes, but expect %d", name, c.offset, c.limit, len(bytes), to-from)
+			}
+		}
+
+		if p.Size() != int64(len(all)) {
+			t.Errorf("[%s] Size is [%d], but expect [%d]", name, p.Size(), len(all))
+		}
+	}
+
+	check("plain", p)
+
+	p.close()
+	if err = p.compress(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Error("Plain log is not removed after compressed")
+	}
+	check("compressed", p)
+
+	// Ranges are read from the member containing them.
+	if start, seek := p.block(3*BLOCKSIZE + 7); start != 3*BLOCKSIZE || seek <= 0 {
+		t.Errorf("Block of offset is [%d] [%d]", start, seek)
+	}
+	check("reloaded", newPayloader(file))
+
+	// Append after compressed, and compress in background.
+	a := newPayloader(file)
+	a.Write([]byte("appended\n"))
+	expect.WriteString("appended\n")
+	all = expect.Bytes()
+	if a.compressed {
+		t.Error("Log is still compressed after appended")
+	}
+	a.Flush()
+	for i := 0; i < 100 && !compressed(a); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !compressed(a) {
+		t.Fatal("Log is not compressed in background")
+	}
+	check("appended", a)
+	check("appended reloaded", newPayloader(file))
+}
+
+func TestPayloaderSingleMember(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A log compressed without block index by old versions.
+	file := path.Join(dir, ".0.log")
+	p := newPayloader(file)
+	content := gobytes.Repeat([]byte("0123456789\n"), 20000)
+	p.Write(content)
+	p.close()
+
+	var gz gobytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(content)
+	w.Close()
+	ioutil.WriteFile(p.gzPath(), gz.Bytes(), os.ModePerm)
+	os.Remove(file)
+
+	bytes, err := newPayloader(file).Range(BLOCKSIZE+3, 50)
+	if err != nil || !gobytes.Equal(bytes, content[BLOCKSIZE+3:BLOCKSIZE+53]) {
+		t.Errorf("Range single member log failed: %v", err)
+	}
+}
+
+func compressed(p *payloader) bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.compressed && !p.compressing
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"strconv"
+)
+
+// Plan presents the dry-run result of a Job script.
+type Plan struct {
+	Valid  bool         `json:"valid"`
+	Issues []*Issue     `json:"issues"`
+	Groups []*planGroup `json:"groups"`
+}
+
+type planGroup struct {
+	Cmds       []*planCmd `json:"cmds"`
+	Selected   string     `json:"selected"`
+	Candidates []string   `json:"candidates"`
+}
+
+type planCmd struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Alias  string `json:"alias"`
+	When   string `json:"when"`
+	Target string `json:"target"`
+	Prefer string `json:"prefer"`
+}
+
+// NewPlan validates the script and resolves command groups with the
+// currently connected Workers which could satisfy them, without executing
+// anything.
+func NewPlan(master IMaster, bytes []byte) *Plan {
+	p := &Plan{Issues: Validate(master, bytes), Groups: make([]*planGroup, 0)}
+	p.Valid = issuesError(p.Issues) == nil
+	if !p.Valid {
+		return p
+	}
+
+	bytes, _ = Resolve(master.Templates(), bytes)
+	cmds, err := Parse(nil, bytes)
+	if err != nil {
+		p.Valid = false
+		p.Issues = append(p.Issues, &Issue{Index: -1, Level: ERROR, Message: err.Error()})
+		return p
+	}
+
+	groups := make(map[*group]*planGroup)
+	for _, c := range cmds {
+		cmd := c.(*command)
+		pg, ok := groups[cmd.group]
+		if !ok {
+			pg = &planGroup{Cmds: make([]*planCmd, 0), Candidates: make([]string, 0)}
+			if w := master.Select(cmd.group.cmds); w != nil {
+				pg.Selected = strconv.FormatUint(w.ID(), 16)
+			}
+
+			for _, w := range master.Workers() {
+				satisfy := true
+				for _, gc := range cmd.group.cmds {
+					if !w.Satisfy(gc) {
+						satisfy = false
+						break
+					}
+				}
+
+				if satisfy {
+					pg.Candidates = append(pg.Candidates, strconv.FormatUint(w.ID(), 16))
+				}
+			}
+
+			groups[cmd.group] = pg
+			p.Groups = append(p.Groups, pg)
+		}
+
+		pg.Cmds = append(pg.Cmds, &planCmd{
+			Index:  cmd.Index(),
+			Name:   cmd.Name(),
+			Alias:  cmd.Alias(),
+			When:   cmd.when,
+			Target: cmd.Target(),
+			Prefer: cmd.Prefer(),
+		})
+	}
+
+	return p
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// recorder appends the structured log records of a command to disk as
+// JSON lines. Each record keeps the byte offset of its text in the plain
+// log, and shell lines are grouped in sections with exit code and duration.
+
+package master
+
+import (
+	"bubble/def"
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+const (
+	// RECEXT defines the structured record file extension.
+	RECEXT string = ".rec"
+)
+
+// Section presents a collapsible part of the command log.
+type Section struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Offset   int64     `json:"offset"`
+	Begin    int64     `json:"begin"`
+	End      int64     `json:"end"`
+	Exit     int       `json:"exit"`
+	Duration int64     `json:"duration"`
+	Level    def.LEVEL `json:"level"`
+	Done     bool      `json:"done"`
+}
+
+// RecordFilter filters the records of a command. Section -1 matches all
+// sections, and 0 matches the records out of any section.
+type RecordFilter struct {
+	Level   def.LEVEL
+	Stream  string
+	Section int
+}
+
+func newRecorder(path string) *recorder {
+	return &recorder{path: path}
+}
+
+type recorder struct {
+	path   string
+	locker sync.Mutex
+}
+
+func (r *recorder) append(records ...*def.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, rec := range records {
+		bytes, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		w.Write(bytes)
+		w.WriteByte('\n')
+	}
+
+	return w.Flush()
+}
+
+func (r *recorder) read() ([]*def.Record, error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	records := make([]*def.Record, 0)
+	f, err := os.Open(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rec := &def.Record{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// Skip the broken line written by interruption.
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// Records returns the records matching filter, and all sections.
+func (r *recorder) Records(filter *RecordFilter) ([]*def.Record, []*Section, error) {
+	all, err := r.read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := make([]*def.Record, 0)
+	sections := make([]*Section, 0)
+	index := make(map[int]*Section)
+	for _, rec := range all {
+		if s, ok := index[rec.Section]; ok && rec.Level > s.Level {
+			s.Level = rec.Level
+		}
+
+		switch rec.Kind {
+		case def.BEGIN:
+			s := &Section{ID: rec.Section, Title: rec.Title, Offset: rec.Offset, Begin: rec.Time, Level: rec.Level}
+			index[s.ID] = s
+			sections = append(sections, s)
+		case def.END:
+			if s, ok := index[rec.Section]; ok {
+				s.End = rec.Time
+				s.Exit = rec.Exit
+				s.Duration = rec.Duration
+				s.Done = true
+			}
+		}
+
+		if rec.Level < filter.Level ||
+			(filter.Stream != "" && rec.Stream != filter.Stream) ||
+			(filter.Section >= 0 && rec.Section != filter.Section) {
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	return records, sections, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/store"
+	"encoding/json"
+	"os"
+)
+
+const (
+	// REPOFILE defines the Job repository config file name.
+	REPOFILE string = ".bubble.repo"
+	// REVISIONFILE defines the file name of the Runner script commit.
+	REVISIONFILE string = ".bubble.rev"
+)
+
+// Repo presents the Git repository which a Job loads script from.
+type Repo struct {
+	// URL of the repository.
+	URL string `json:"url"`
+	// Branch (or any ref) to use when triggering without ref, default is HEAD.
+	Branch string `json:"branch"`
+	// Path of the script file in the repository, default is BUBBLEFILE.
+	Path string `json:"path"`
+	// Fallback to the Job script when the file is missing or invalid.
+	Fallback bool `json:"fallback"`
+}
+
+func (r *Repo) validate() error {
+	if err := checkURL(r.URL); err != nil {
+		return err
+	}
+	if err := checkRef(r.Branch); err != nil {
+		return err
+	}
+
+	if r.Path == "" {
+		r.Path = BUBBLEFILE
+	}
+
+	return nil
+}
+
+func loadRepo(s store.IStore, key string) (*Repo, error) {
+	bytes, err := s.Get(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var r Repo
+	if err = json.Unmarshal(bytes, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func saveRepo(s store.IStore, key string, r *Repo) error {
+	if r == nil {
+		return s.Delete(key)
+	}
+
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(key, bytes)
+}
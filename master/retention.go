@@ -0,0 +1,178 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// retention deletes completed Runners from the jobs directory by policy,
+// which is set in master.yml:
+//
+// ```yaml
+// retention:
+//  runners: 100   # max Runners per Job.
+//  age: 720h      # max age of Runners.
+//  size: 10240    # max total size (MB) of all Runners.
+// ```
+//
+// All limits are optional, and the oldest Runners are deleted first.
+
+package master
+
+import (
+	"bubble/env"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// RETENTIONINTERVAL defines the interval to enforce the retention policy.
+	RETENTIONINTERVAL time.Duration = 10 * time.Minute
+)
+
+// newRetention creates a retention by configure, returns nil if nothing is limited.
+func newRetention(conf env.IAny) *retention {
+	if conf == nil || !conf.IsMap() {
+		return nil
+	}
+
+	r := &retention{}
+	m := conf.Map()
+	if v, ok := m["runners"]; ok {
+		r.runners = v.Int()
+	}
+	if v, ok := m["age"]; ok {
+		d, err := time.ParseDuration(v.ToString())
+		if err != nil {
+			log.Errorf("Retention age [%s] is invalid: %s", v.ToString(), err.Error())
+		}
+		r.age = d
+	}
+	if v, ok := m["size"]; ok {
+		r.size = int64(v.Int()) * 1024 * 1024
+	}
+
+	if r.runners <= 0 && r.age <= 0 && r.size <= 0 {
+		return nil
+	}
+
+	return r
+}
+
+type retention struct {
+	runners int
+	age     time.Duration
+	size    int64
+	last    time.Time
+	locker  sync.Mutex
+	removed map[*job]bool
+}
+
+type retained struct {
+	job     *job
+	runner  *runner
+	created time.Time
+	size    int64
+}
+
+// tick enforces the policy if the interval is passed.
+func (r *retention) tick(jobs []IJob) {
+	if time.Since(r.last) < RETENTIONINTERVAL {
+		return
+	}
+	r.last = time.Now()
+
+	go r.enforce(jobs)
+}
+
+func (r *retention) enforce(jobs []IJob) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.removed = make(map[*job]bool)
+	defer r.compact()
+
+	all := make([]*retained, 0)
+	var total int64
+	for _, ij := range jobs {
+		j := ij.(*job)
+
+		// Runners are sorted from the newest.
+		count := 0
+		for _, ir := range j.Runners() {
+			rr := ir.(*runner)
+			item := &retained{job: j, runner: rr, created: rr.created(), size: dirSize(rr.Dir())}
+			total += item.size
+
+			// Keep executing Runners.
+			if !rr.completed() {
+				continue
+			}
+
+			count++
+			if (r.runners > 0 && count > r.runners) || (r.age > 0 && time.Since(item.created) > r.age) {
+				if r.remove(item) {
+					total -= item.size
+				}
+				continue
+			}
+
+			all = append(all, item)
+		}
+	}
+
+	if r.size <= 0 || total <= r.size {
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].created.Before(all[j].created)
+	})
+	for _, item := range all {
+		if total <= r.size {
+			break
+		}
+
+		if r.remove(item) {
+			total -= item.size
+		}
+	}
+}
+
+func (r *retention) remove(item *retained) bool {
+	if err := item.job.remove(item.runner.id); err != nil {
+		log.Errorf("Retention removes Job [%s] Runner [%x] failed: %s", item.job.name, item.runner.id, err.Error())
+		return false
+	}
+
+	log.Infof("Retention removed Job [%s] Runner [%x].\n", item.job.name, item.runner.id)
+	r.removed[item.job] = true
+	return true
+}
+
+// compact removes the search index entries of the removed Runners.
+func (r *retention) compact() {
+	for j := range r.removed {
+		err := j.index.compact(func(id uint64) bool {
+			_, err := j.GetRunner(id)
+			return err == nil
+		})
+		if err != nil {
+			log.Errorf("Retention compacts Job [%s] search index failed: %s", j.name, err.Error())
+		}
+	}
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
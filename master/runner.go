@@ -8,19 +8,33 @@ package master
 
 import (
 	"bubble/def"
+	"bubble/env"
+	"bubble/trace"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/cihub/seelog"
 )
 
-// NewRunner create a new IRunner by id and job.
-func NewRunner(id uint64, job *job) IRunner {
-	r := &runner{id: id, job: job}
+// NewRunner create a new IRunner by id and job. The script bytes (or the
+// Job script if it's nil), revision and cause are only snapshotted for a
+// new Runner, and an existing Runner is loaded from its folder.
+func NewRunner(id uint64, job *job, script []byte, revision string, cause *Cause) IRunner {
+	r := &runner{
+		id:      id,
+		job:     job,
+		pending: make(map[int]chan *Approval),
+		events:  newBroadcaster(),
+		done:    make(chan struct{}),
+		adopt:   -1,
+	}
 
 	dir := r.Dir()
 	_, err := os.Stat(dir)
@@ -31,20 +45,51 @@ func NewRunner(id uint64, job *job) IRunner {
 		}
 	}
 
-	var bytes []byte
-	scriptFilePath := r.ScriptPath()
-	_, err = os.Stat(scriptFilePath)
+	st := job.store()
+	bytes, err := st.Get(r.key(BUBBLEFILE))
 	if err != nil && os.IsNotExist(err) {
-		bytes, err = job.script.ToBytes()
+		bytes = script
+		if bytes == nil {
+			if bytes, err = job.script.ToBytes(); err != nil {
+				return nil
+			}
+		}
+
+		// Snapshot the expanded script, so later template changes won't
+		// affect this Runner.
+		bytes, err = Resolve(job.master.Templates(), bytes)
 		if err != nil {
+			log.Errorf("Resolve Job [%s] templates failed: %s", job.name, err.Error())
 			return nil
 		}
 
-		if err = ioutil.WriteFile(scriptFilePath, bytes, os.ModePerm); err != nil {
+		if err = st.Put(r.key(BUBBLEFILE), bytes); err != nil {
 			return nil
 		}
-	} else if bytes, err = ioutil.ReadFile(scriptFilePath); err != nil {
+
+		if revision != "" {
+			if err = st.Put(r.key(REVISIONFILE), []byte(revision)); err != nil {
+				return nil
+			}
+		}
+		r.revision = revision
+
+		r.cause = cause
+		if cause != nil {
+			r.start = cause.From
+		}
+		r.save()
+	} else if err != nil {
 		return nil
+	} else {
+		if rev, err := st.Get(r.key(REVISIONFILE)); err == nil {
+			r.revision = strings.TrimSpace(string(rev))
+		}
+
+		r.load()
+
+		// Loaded Runner won't be executed again.
+		close(r.done)
 	}
 
 	r.cmds, err = Parse(r, bytes)
@@ -52,20 +97,25 @@ func NewRunner(id uint64, job *job) IRunner {
 		return nil
 	}
 
-	// Load status.
-	statusFilePath := r.StatusPath()
-	_, err = os.Stat(statusFilePath)
-	if err == nil {
-		bytes, err := ioutil.ReadFile(statusFilePath)
-		if err != nil {
-			log.Errorf("Read Job [%s] Runner [%s] status file failed!", r.job.name, r.id)
-			return nil
-		}
+	s := env.NewAny(nil)
+	if err = s.FromBytes(bytes); err != nil {
+		return nil
+	}
+	if r.completes, err = parseCompletes(s); err != nil {
+		log.Errorf("Job [%s] Runner [%x] on_complete is invalid: %s", r.job.name, r.id, err.Error())
+		return nil
+	}
 
+	// Load status.
+	bytes, err = st.Get(r.key(STATUSFILE))
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Read Job [%s] Runner [%x] status failed!", r.job.name, r.id)
+		return nil
+	} else if err == nil {
 		var stats []*commandStat
 		err = json.Unmarshal(bytes, &stats)
 		if err != nil {
-			log.Errorf("Unmarshal Job [%s] Runner [%s] status failed!", r.job.name, r.id)
+			log.Errorf("Unmarshal Job [%s] Runner [%x] status failed!", r.job.name, r.id)
 			return nil
 		}
 
@@ -74,6 +124,17 @@ func NewRunner(id uint64, job *job) IRunner {
 			cmd.status = s.Status
 			cmd.beginStamp = s.BeginTime
 			cmd.finishStamp = s.FinishTime
+			if s.Outputs != nil {
+				cmd.values = s.Outputs
+			}
+			cmd.worker = s.Worker
+
+			// The command is orphaned if Master stopped during executing.
+			switch cmd.status {
+			case def.ONGOING, def.PENDING:
+				cmd.status = def.INTERRUPT
+				r.interrupted = true
+			}
 
 			// Make sure finishStamp is valid.
 			if cmd.finishStamp == -1 {
@@ -85,18 +146,58 @@ func NewRunner(id uint64, job *job) IRunner {
 		}
 	}
 
+	// Waiting for downstream Runners.
+	if r.result == def.ONGOING {
+		r.result = def.INTERRUPT
+		r.interrupted = true
+	}
+
+	if r.interrupted {
+		log.Warnf("Job [%s] Runner [%x] is interrupted.\n", r.job.name, r.id)
+		r.saveStats()
+		r.save()
+	}
+
 	return r
 }
 
 const (
+	// ADOPTTIMEOUT defines how long to wait for the Workers to report after
+	// the Master is elected.
+	ADOPTTIMEOUT time.Duration = time.Minute
 	// STATUSFILE defines the file name.
 	STATUSFILE string = ".bubble.stat"
+	// METAFILE defines the file name of Runner cause and downstreams.
+	METAFILE string = ".bubble.meta"
 )
 
 type runner struct {
-	id   uint64
-	job  *job
-	cmds []ICommand
+	id          uint64
+	job         *job
+	revision    string
+	cmds        []ICommand
+	cause       *Cause
+	completes   []*complete
+	downstreams []*Downstream
+	waiting     []IRunner
+	approvals   []*Approval
+	pending     map[int]chan *Approval
+	events      *broadcaster
+	result      def.STATUS
+	start       int
+	interrupted bool
+	adopt       int
+	adopter     IWorker
+	locker      sync.Mutex
+	done        chan struct{}
+	span        *trace.Span
+}
+
+type runnerMeta struct {
+	Cause       *Cause        `json:"cause,omitempty"`
+	Downstreams []*Downstream `json:"downstreams,omitempty"`
+	Approvals   []*Approval   `json:"approvals,omitempty"`
+	Result      def.STATUS    `json:"result,omitempty"`
 }
 
 func (r *runner) ID() uint64 {
@@ -107,14 +208,79 @@ func (r *runner) Execute() error {
 	go func() {
 		log.Infof("Job [%s] is executing.\n", r.job.Name())
 
+		parent := ""
+		if r.cause != nil {
+			parent = r.cause.Trace
+		}
+		r.span = trace.Start(parent, "runner "+r.job.name)
+		r.span.Set("job", r.job.name).Set("runner", strconv.FormatUint(r.id, 16))
+
 		status := def.SUCCESS
 		ctx := NewCtx(r).(*ctx)
-		for i := 0; i < len(r.cmds) && status != def.INTERRUPT; i++ {
+
+		// Publish the outputs copied from the source Runner of re-run.
+		for i := 0; i < r.start && i < len(r.cmds); i++ {
+			cmd := r.cmds[i].(*command)
+			for k, v := range cmd.values {
+				ctx.Env().Set(cmd.Alias()+"."+k, env.NewAny(v))
+			}
+		}
+
+		for i := r.start; i < len(r.cmds) && status != def.INTERRUPT && status != def.CANCEL; i++ {
 			cmd := r.cmds[i].(*command)
 			ctx.Cmd = cmd
+
+			// Check the trigger condition before looking for Worker, so
+			// skipped command doesn't need a Worker.
+			run, err := r.evaluate(cmd, status, ctx.Env())
+			if err != nil {
+				log.Error(err)
+				status = def.FAILURE
+				cmd.Notify(def.FAILURE, []byte(err.Error()))
+				continue
+			} else if !run {
+				cmd.Notify(def.SKIPPED, nil)
+				continue
+			}
+
+			// Mark ongoing before executing, so it could be found
+			// interrupted after Master restarts.
+			cmd.Notify(def.ONGOING, nil)
+			r.saveStats()
+
+			// Master-side action doesn't need Worker.
+			if local(cmd.Name()) {
+				status = r.local(cmd, ctx.Env())
+				cmd.publish(ctx.Env())
+				continue
+			}
+
+			// Adopt the command still running on its Worker after taking
+			// over from the last leader.
+			if i == r.adopt {
+				worker := r.adopter
+				defer worker.Clean(r.id)
+				cmd.group.worker = worker
+				if action := worker.Get(cmd.Name()); action != nil && action.Adopt(ctx) {
+					log.Infof("Job [%s] Runner [%x] adopts Action [%s] on Worker [%d].\n", r.job.name, r.id, cmd.Name(), worker.ID())
+					status = <-ctx.Result
+					cmd.publish(ctx.Env())
+					continue
+				}
+
+				// It's gone since checked, don't execute it again.
+				log.Warnf("Job [%s] Runner [%x] Action [%s] is gone from Worker [%d].\n", r.job.name, r.id, cmd.Name(), worker.ID())
+				status = def.INTERRUPT
+				r.interrupted = true
+				cmd.Notify(def.INTERRUPT, nil)
+				continue
+			}
+
 			if cmd.group.worker == nil {
 				// Find proper Worker and wait 1 min for time out if can't find.
 				var worker IWorker
+				selection := cmd.span.Child("select worker")
+				queued := time.Now()
 				timeOut := 1 * time.Minute
 				for {
 					worker = r.job.master.Select(cmd.group.cmds)
@@ -124,6 +290,13 @@ func (r *runner) Execute() error {
 					time.Sleep(time.Second)
 					timeOut -= time.Second
 				}
+				telemetry.wait(time.Since(queued))
+				if worker != nil {
+					selection.Set("worker", strconv.FormatUint(worker.ID(), 16))
+				} else {
+					selection.Fail(errors.New("there is no suitable worker"))
+				}
+				selection.Finish()
 
 				// No proper Worker.
 				if worker == nil {
@@ -137,40 +310,35 @@ func (r *runner) Execute() error {
 				cmd.group.worker = worker
 			}
 
-			when := cmd.When()
-			if status != def.CANCEL &&
-				(when == ALWAYS || (when == SUCCESS && status == def.SUCCESS) || (when == FAILURE && status == def.FAILURE)) {
-				action := cmd.group.worker.Get(cmd.Name())
-				if action != nil {
-					log.Infof("Action [%s] start to execute.\n", cmd.Name())
-					action.Execute(ctx)
-					status = <-ctx.Result
-				} else {
-					log.Errorf("There is no Action [%s] in Worker!\n", cmd.Name())
-				}
-			}
-		}
+			// Record the Worker, so the command could be adopted by the
+			// next leader.
+			cmd.worker = cmd.group.worker.ID()
+			r.saveStats()
 
-		// Save status.
-		stats := make([]*commandStat, len(r.cmds))
-		for i, c := range r.cmds {
-			cmd := c.(*command)
-			stats[i] = &commandStat{
-				Status:     cmd.status,
-				BeginTime:  cmd.beginStamp,
-				FinishTime: cmd.finishStamp,
+			action := cmd.group.worker.Get(cmd.Name())
+			if action != nil {
+				log.Infof("Action [%s] start to execute.\n", cmd.Name())
+				action.Execute(ctx)
+				status = <-ctx.Result
+				cmd.publish(ctx.Env())
+			} else {
+				log.Errorf("There is no Action [%s] in Worker!\n", cmd.Name())
 			}
 		}
-		bytes, err := json.Marshal(stats)
-		if err != nil {
-			log.Errorf("Marshal Job [%s] Runner [%s] status failed!", r.job.name, r.id)
-			return
-		}
 
-		err = ioutil.WriteFile(r.StatusPath(), bytes, os.ModePerm)
-		if err != nil {
-			log.Errorf("Write Job [%s] Runner [%s] status file failed!", r.job.name, r.id)
+		// Trigger downstream Jobs, and mark the Runner ongoing while waiting.
+		if len(r.completes) > 0 && !r.interrupted {
+			r.result = def.ONGOING
+			if r.complete(r.commandsStatus(), ctx.Env()) == def.SUCCESS {
+				r.result = def.NOTSTART
+			} else {
+				r.result = def.FAILURE
+			}
 		}
+		r.save()
+		r.saveStats()
+		r.span.Set("status", statusNames[r.Status()]).Finish()
+		close(r.done)
 
 		log.Debugf("Job [%s] has been completed!\n", r.job.Name())
 	}()
@@ -179,6 +347,20 @@ func (r *runner) Execute() error {
 }
 
 func (r *runner) Cancel() error {
+	r.locker.Lock()
+	waiting := r.waiting
+	for _, ch := range r.pending {
+		select {
+		case ch <- nil:
+		default:
+		}
+	}
+	r.locker.Unlock()
+
+	for _, w := range waiting {
+		w.Cancel()
+	}
+
 	for _, c := range r.cmds {
 		cmd := c.(*command)
 		if cmd.group.worker != nil {
@@ -192,6 +374,51 @@ func (r *runner) Cancel() error {
 	return nil
 }
 
+func (r *runner) Revision() string {
+	return r.revision
+}
+
+func (r *runner) Cause() *Cause {
+	return r.cause
+}
+
+func (r *runner) Status() def.STATUS {
+	status := r.commandsStatus()
+	if r.result > status {
+		status = r.result
+	}
+
+	return status
+}
+
+func (r *runner) Downstreams() []*Downstream {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	ds := make([]*Downstream, len(r.downstreams))
+	for i, d := range r.downstreams {
+		c := *d
+		ds[i] = &c
+	}
+
+	return ds
+}
+
+func (r *runner) Approvals() []*Approval {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	as := make([]*Approval, len(r.approvals))
+	copy(as, r.approvals)
+
+	return as
+}
+
+func (r *runner) Wait() def.STATUS {
+	<-r.done
+	return r.Status()
+}
+
 func (r *runner) Commands() []ICommand {
 	return r.cmds
 }
@@ -203,10 +430,225 @@ func (r *runner) Dir() string {
 	return path.Join(r.job.Dir(), strconv.FormatUint(r.id, 16))
 }
 
-func (r *runner) ScriptPath() string {
-	return path.Join(r.Dir(), BUBBLEFILE)
+// key returns the store key of the Runner state by name.
+func (r *runner) key(name string) string {
+	return path.Join(r.job.key(strconv.FormatUint(r.id, 16)), name)
+}
+
+// local returns whether the action is executed on Master.
+func local(action string) bool {
+	return action == TRIGGER || action == APPROVAL
+}
+
+// local executes the Master-side command and returns its status.
+func (r *runner) local(cmd *command, e env.IEnv) def.STATUS {
+	switch cmd.Name() {
+	case APPROVAL:
+		return r.approval(cmd, e)
+	default:
+		return r.trigger(cmd, e)
+	}
+}
+
+// commandsStatus returns the most serious status of all commands, and
+// skipped command counts as success.
+func (r *runner) commandsStatus() def.STATUS {
+	status := def.NOTSTART
+	for _, c := range r.cmds {
+		s := c.Status()
+		if s == def.SKIPPED {
+			s = def.SUCCESS
+		}
+		if s > status {
+			status = s
+		}
+	}
+
+	return status
+}
+
+// completed returns whether the Runner is not executing.
+func (r *runner) completed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
 }
 
-func (r *runner) StatusPath() string {
-	return path.Join(r.Dir(), STATUSFILE)
+// created returns the time when the Runner is created.
+func (r *runner) created() time.Time {
+	return def.UidTime(r.id)
+}
+
+// saveStats writes the status of all commands into STATUSFILE.
+func (r *runner) saveStats() {
+	stats := make([]*commandStat, len(r.cmds))
+	for i, c := range r.cmds {
+		cmd := c.(*command)
+		stats[i] = &commandStat{
+			Status:     cmd.status,
+			BeginTime:  cmd.beginStamp,
+			FinishTime: cmd.finishStamp,
+			Outputs:    cmd.values,
+			Worker:     cmd.worker,
+		}
+	}
+
+	bytes, err := json.Marshal(stats)
+	if err != nil {
+		log.Errorf("Marshal Job [%s] Runner [%x] status failed!", r.job.name, r.id)
+		return
+	}
+
+	if err = r.job.store().Put(r.key(STATUSFILE), bytes); err != nil {
+		log.Errorf("Write Job [%s] Runner [%x] status failed!", r.job.name, r.id)
+	}
+}
+
+// resumable returns the first interrupted command index which the Runner
+// could be re-run from, or -1.
+func (r *runner) resumable() int {
+	for i, c := range r.cmds {
+		switch c.Status() {
+		case def.SUCCESS, def.SKIPPED:
+		case def.INTERRUPT:
+			return i
+		default:
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// rerunnable returns an error if the Runner can't re-run from the command
+// at index from, which needs all commands before it succeeded.
+func (r *runner) rerunnable(from int) error {
+	if from < 0 || from >= len(r.cmds) {
+		return fmt.Errorf("runner index [%d] is out of range", from)
+	}
+
+	for i := 0; i < from; i++ {
+		if s := r.cmds[i].Status(); s != def.SUCCESS && s != def.SKIPPED {
+			return fmt.Errorf("command [%d] is not success, can't re-run from [%d]", i, from)
+		}
+	}
+
+	return nil
+}
+
+// inherit copies the statuses, outputs and logs of the commands before
+// index from of the source Runner.
+func (r *runner) inherit(src *runner, from int) {
+	for i := 0; i < from; i++ {
+		sc := src.cmds[i].(*command)
+		dc := r.cmds[i].(*command)
+		dc.status = sc.status
+		dc.beginStamp = sc.beginStamp
+		dc.finishStamp = sc.finishStamp
+		for k, v := range sc.values {
+			dc.values[k] = v
+		}
+
+		if logs, err := sc.payloader.Range(0, 0); err == nil && len(logs) > 0 {
+			dc.payloader.Write(logs)
+			dc.payloader.Flush()
+		}
+		if records, err := sc.recorder.read(); err == nil {
+			dc.recorder.append(records...)
+		}
+	}
+	r.saveStats()
+}
+
+// takeover continues the interrupted Runner from the command at index from,
+// which is adopted from the Worker it's still running on.
+func (r *runner) takeover(from int, worker IWorker) error {
+	for i := from; i < len(r.cmds); i++ {
+		cmd := r.cmds[i].(*command)
+		cmd.status = def.NOTSTART
+	}
+
+	r.start = from
+	r.adopt = from
+	r.adopter = worker
+	r.interrupted = false
+	r.done = make(chan struct{})
+
+	return r.Execute()
+}
+
+// adoptable returns the Worker which the command at index from is still
+// running on, it waits until deadline for the Worker to report.
+func (r *runner) adoptable(from int, deadline time.Time) IWorker {
+	cmd := r.cmds[from].(*command)
+	if cmd.worker == 0 || local(cmd.Name()) {
+		return nil
+	}
+
+	worker := r.reported(cmd.worker, deadline)
+	if worker == nil {
+		return nil
+	}
+
+	if a, ok := worker.Get(cmd.Name()).(*action); ok && a.adoptable(r.id) {
+		return worker
+	}
+
+	return nil
+}
+
+// reported waits until deadline for the Worker by id to report its running
+// Runners, and returns nil if it doesn't.
+func (r *runner) reported(id uint64, deadline time.Time) IWorker {
+	for {
+		for _, w := range r.job.master.Workers() {
+			if w.ID() == id && w.Reported() {
+				return w
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	log.Warnf("Job [%s] Runner [%x] Worker [%d] doesn't report in time.\n", r.job.name, r.id, id)
+	return nil
+}
+
+func (r *runner) load() {
+	bytes, err := r.job.store().Get(r.key(METAFILE))
+	if err != nil {
+		return
+	}
+
+	var meta runnerMeta
+	if err = json.Unmarshal(bytes, &meta); err != nil {
+		log.Errorf("Unmarshal Job [%s] Runner [%x] meta failed!", r.job.name, r.id)
+		return
+	}
+
+	r.cause = meta.Cause
+	r.downstreams = meta.Downstreams
+	r.approvals = meta.Approvals
+	r.result = meta.Result
+}
+
+func (r *runner) save() {
+	r.locker.Lock()
+	meta := &runnerMeta{Cause: r.cause, Downstreams: r.downstreams, Approvals: r.approvals, Result: r.result}
+	bytes, err := json.Marshal(meta)
+	r.locker.Unlock()
+	if err != nil {
+		log.Errorf("Marshal Job [%s] Runner [%x] meta failed!", r.job.name, r.id)
+		return
+	}
+
+	if err = r.job.store().Put(r.key(METAFILE), bytes); err != nil {
+		log.Errorf("Write Job [%s] Runner [%x] meta failed!", r.job.name, r.id)
+	}
 }
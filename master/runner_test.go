@@ -0,0 +1,206 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"bubble/store"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// executing is an ILocal which succeeds all commands.
+type executing struct {
+	executed int
+}
+
+func (l *executing) Execute(cmd ICommand, worker int, e env.IEnv) (def.STATUS, env.IEnv) {
+	l.executed++
+	return def.SUCCESS, e
+}
+
+func (l *executing) Transfer(from, to int, disk string) error {
+	return nil
+}
+
+func (l *executing) Notify(cmd ICommand, status def.STATUS, message string) {}
+
+func TestCommandsStatus(t *testing.T) {
+	cases := []struct {
+		statuses []def.STATUS
+		expect   def.STATUS
+	}{
+		{[]def.STATUS{}, def.NOTSTART},
+		{[]def.STATUS{def.NOTSTART, def.NOTSTART}, def.NOTSTART},
+		{[]def.STATUS{def.SKIPPED}, def.SUCCESS},
+		{[]def.STATUS{def.SKIPPED, def.SKIPPED}, def.SUCCESS},
+		{[]def.STATUS{def.SUCCESS, def.SKIPPED}, def.SUCCESS},
+		{[]def.STATUS{def.SKIPPED, def.ONGOING}, def.ONGOING},
+		{[]def.STATUS{def.FAILURE, def.SKIPPED}, def.FAILURE},
+		{[]def.STATUS{def.SKIPPED, def.CANCEL, def.SUCCESS}, def.CANCEL},
+		{[]def.STATUS{def.SUCCESS, def.INTERRUPT, def.SKIPPED}, def.INTERRUPT},
+	}
+
+	for _, c := range cases {
+		r := &runner{}
+		for _, s := range c.statuses {
+			r.cmds = append(r.cmds, &command{status: s})
+		}
+
+		if status := r.commandsStatus(); status != c.expect {
+			t.Errorf("Commands %v expect status [%d], but actual [%d]", c.statuses, c.expect, status)
+		}
+		if status := r.Status(); status != c.expect {
+			t.Errorf("Runner of commands %v expect status [%d], but actual [%d]", c.statuses, c.expect, status)
+		}
+	}
+}
+
+func TestRunLocalSkipped(t *testing.T) {
+	script := []byte("- action: shell\n  when: $PLATFORM == \"ios\"\n- action: shell\n  when: \"false\"\n")
+	local := &executing{}
+	cmds, status, err := RunLocal(nil, script, map[string]string{"PLATFORM": "android"}, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.executed != 0 {
+		t.Errorf("Skipped commands are executed [%d] times", local.executed)
+	}
+
+	// All skipped Runner succeeds, so `on_complete` with `when: success` fires.
+	if status != def.SUCCESS {
+		t.Errorf("All skipped Runner expect status [%d], but actual [%d]", def.SUCCESS, status)
+	}
+	for i, c := range cmds {
+		if c.Status() != def.SKIPPED {
+			t.Errorf("Command [%d] expect skipped, but actual [%d]", i, c.Status())
+		}
+	}
+}
+
+func TestRunnerAdoptable(t *testing.T) {
+	newAction := func(running, finished bool) *action {
+		a := &action{name: "shell", procs: make(map[uint64]ICtx), running: make(map[uint64]bool), orphans: make(map[uint64]*orphan)}
+		if running {
+			a.running[9] = true
+		}
+		if finished {
+			a.orphans[9] = &orphan{status: def.SUCCESS}
+		}
+		return a
+	}
+
+	cases := []struct {
+		name     string
+		id       uint64
+		action   string
+		reported bool
+		running  bool
+		orphan   bool
+		adopt    bool
+	}{
+		{"running", 1, "shell", true, true, false, true},
+		{"finished", 1, "shell", true, false, true, true},
+		{"not running", 1, "shell", true, false, false, false},
+		{"not reported", 1, "shell", false, true, false, false},
+		{"other worker", 2, "shell", true, true, false, false},
+		{"no worker", 0, "shell", true, true, false, false},
+		{"master action", 1, APPROVAL, true, true, false, false},
+	}
+
+	for _, c := range cases {
+		w := &worker{proxy: &proxy{id: 1}, actions: map[string]IAction{"shell": newAction(c.running, c.orphan)}, reported: c.reported}
+		r := &runner{id: 9, job: &job{name: "job", master: &validating{workers: []IWorker{w}}}}
+		r.cmds = []ICommand{&command{name: c.action, worker: c.id}}
+
+		worker := r.adoptable(0, time.Now())
+		if (worker != nil) != c.adopt {
+			t.Errorf("Case [%s] expect adoptable [%t], but actual [%t]", c.name, c.adopt, worker != nil)
+		}
+	}
+}
+
+func TestRerunFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rerun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{dir: dir, store: store.NewFileStore(path.Join(dir, "jobs"))}
+	j, err := NewJob(m, 1, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := []byte("- action: shell\n- action: shell\n- action: shell\n- action: shell\n")
+	src := NewRunner(0x10, j.(*job), script, "", nil).(*runner)
+	statuses := []def.STATUS{def.SUCCESS, def.SKIPPED, def.FAILURE, def.NOTSTART}
+	for i, s := range statuses {
+		cmd := src.cmds[i].(*command)
+		cmd.status = s
+		cmd.values["OUT"] = string(rune('a' + i))
+		cmd.payloader.Write([]byte("log " + cmd.values["OUT"]))
+		cmd.payloader.Flush()
+		cmd.recorder.append(&def.Record{Text: "record " + cmd.values["OUT"]})
+	}
+
+	cases := []struct {
+		from  int
+		valid bool
+	}{
+		{-1, false},
+		{0, true},
+		{1, true},
+		{2, true},
+		{3, false},
+		{4, false},
+	}
+
+	for _, c := range cases {
+		err := src.rerunnable(c.from)
+		if (err == nil) != c.valid {
+			t.Errorf("rerunnable [%d] expect valid [%t], but actual error [%v]", c.from, c.valid, err)
+		}
+	}
+
+	from := 2
+	dst := NewRunner(0x11, j.(*job), script, "", &Cause{Rerun: "10", From: from}).(*runner)
+	if dst.start != from {
+		t.Errorf("start expect [%d], but actual [%d]", from, dst.start)
+	}
+	dst.inherit(src, from)
+
+	// Reload the Runner to check the saved states.
+	dst = NewRunner(0x11, j.(*job), nil, "", nil).(*runner)
+	for i, cmd := range dst.cmds {
+		c := cmd.(*command)
+		status, out, logs, records := def.NOTSTART, "", "", 0
+		if i < from {
+			status, out = statuses[i], string(rune('a'+i))
+			logs, records = "log "+out, 1
+		}
+
+		if c.status != status {
+			t.Errorf("command [%d] status expect [%d], but actual [%d]", i, status, c.status)
+		}
+		if c.values["OUT"] != out {
+			t.Errorf("command [%d] output expect [%s], but actual [%s]", i, out, c.values["OUT"])
+		}
+		if bytes, _ := c.payloader.Range(0, 0); string(bytes) != logs {
+			t.Errorf("command [%d] log expect [%s], but actual [%s]", i, logs, bytes)
+		}
+		if rs, _ := c.recorder.read(); len(rs) != records {
+			t.Errorf("command [%d] records expect [%d], but actual [%d]", i, records, len(rs))
+		}
+	}
+	if dst.cause == nil || dst.cause.Rerun != "10" || dst.cause.From != from {
+		t.Errorf("cause expect re-run [10] from [%d], but actual [%v]", from, dst.cause)
+	}
+}
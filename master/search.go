@@ -0,0 +1,517 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// search finds lines in the stored command logs of all Jobs. Each Job
+// keeps an index file, which holds one entry per completed command with
+// a bloom filter of the lower case trigrams in its log. The entry is added
+// when the log is flushed, so a query only scans the logs which could
+// contain the text (or the literal prefix of a regular expression).
+
+package master
+
+import (
+	"bubble/def"
+	"bufio"
+	gobytes "bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// INDEXFILE defines the log search index file name of a Job.
+	INDEXFILE string = ".bubble.index"
+	// SEARCHLIMIT defines the default max results of a search.
+	SEARCHLIMIT int = 100
+	// SNIPPETLENGTH defines the max length of a result snippet.
+	SNIPPETLENGTH int = 200
+	// entryHeader is the bytes of the entry header in the index file.
+	entryHeader int = 25
+	// bloomMin and bloomMax limit the bytes of a bloom filter.
+	bloomMin int = 128
+	bloomMax int = 16 * 1024
+)
+
+// SearchQuery presents the text and filters of a search.
+type SearchQuery struct {
+	// Text is the literal text (case insensitive) or regular expression.
+	Text  string
+	Regex bool
+	// Job limits the search in one Job if it's set.
+	Job string
+	// Statuses limits the command statuses if it's not empty.
+	Statuses []def.STATUS
+	// Since and Until limit the command finish time if they're not zero.
+	Since time.Time
+	Until time.Time
+	// Limit is the max results, SEARCHLIMIT if it's not positive.
+	Limit int
+	// Allow limits the Jobs which could be searched if it's set.
+	Allow func(job string) bool
+}
+
+// SearchResult presents a matched log line.
+type SearchResult struct {
+	Job     string     `json:"job"`
+	Runner  string     `json:"runner"`
+	Index   int        `json:"index"`
+	Line    int        `json:"line"`
+	Snippet string     `json:"snippet"`
+	Status  def.STATUS `json:"status"`
+	Time    int64      `json:"time"`
+}
+
+// Search returns the matched log lines from the latest commands.
+func (m *Master) Search(query *SearchQuery) ([]*SearchResult, error) {
+	match, grams, err := matcher(query)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := m.List()
+	if query.Job != "" {
+		j, err := m.Get(query.Job)
+		if err != nil {
+			return nil, err
+		}
+		jobs = []IJob{j}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = SEARCHLIMIT
+	}
+
+	type candidate struct {
+		job   *job
+		entry *indexEntry
+	}
+
+	candidates := make([]*candidate, 0)
+	for _, ij := range jobs {
+		j := ij.(*job)
+		if query.Allow != nil && !query.Allow(j.name) {
+			continue
+		}
+
+		entries, err := j.index.entries()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		for _, e := range entries {
+			if query.accept(e) && e.contains(grams) {
+				candidates = append(candidates, &candidate{job: j, entry: e})
+			}
+		}
+	}
+
+	// Latest first.
+	sort.Slice(candidates, func(i, k int) bool {
+		return candidates[i].entry.Time > candidates[k].entry.Time
+	})
+
+	results := make([]*SearchResult, 0)
+	for _, c := range candidates {
+		r, err := c.job.GetRunner(c.entry.Runner)
+		if err != nil {
+			// Removed by retention.
+			continue
+		}
+
+		cmds := r.Commands()
+		if c.entry.Index >= len(cmds) {
+			continue
+		}
+
+		bytes, err := cmds[c.entry.Index].(*command).payloader.Range(0, 0)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		for i, line := range strings.Split(string(bytes), "\n") {
+			start, end := match(line)
+			if start < 0 {
+				continue
+			}
+
+			results = append(results, &SearchResult{
+				Job:     c.job.name,
+				Runner:  strconv.FormatUint(c.entry.Runner, 16),
+				Index:   c.entry.Index,
+				Line:    i + 1,
+				Snippet: snippet(line, start, end),
+				Status:  c.entry.Status,
+				Time:    c.entry.Time,
+			})
+			if len(results) >= limit {
+				return results, nil
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// matcher returns the line matcher and the trigrams which must be in the
+// log to match the query.
+func matcher(query *SearchQuery) (func(string) (int, int), []string, error) {
+	if query.Regex {
+		re, err := regexp.Compile(query.Text)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		prefix, _ := re.LiteralPrefix()
+		return func(line string) (int, int) {
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				return -1, -1
+			}
+			return loc[0], loc[1]
+		}, trigrams(prefix), nil
+	}
+
+	text := strings.ToLower(query.Text)
+	if text == "" {
+		return nil, nil, errors.New("search text is empty")
+	}
+
+	return func(line string) (int, int) {
+		i := strings.Index(strings.ToLower(line), text)
+		if i < 0 {
+			return -1, -1
+		}
+		return i, i + len(text)
+	}, trigrams(text), nil
+}
+
+func (q *SearchQuery) accept(e *indexEntry) bool {
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, s := range q.Statuses {
+			if s == e.Status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !q.Since.IsZero() && e.Time < q.Since.Unix() {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time > q.Until.Unix() {
+		return false
+	}
+
+	return true
+}
+
+// snippet returns the part of line around the match in SNIPPETLENGTH.
+func snippet(line string, start int, end int) string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) <= SNIPPETLENGTH {
+		return line
+	}
+
+	from := start - (SNIPPETLENGTH-(end-start))/2
+	if from < 0 {
+		from = 0
+	}
+	to := from + SNIPPETLENGTH
+	if to > len(line) {
+		to = len(line)
+		from = to - SNIPPETLENGTH
+	}
+
+	// Keep runes complete.
+	for from > 0 && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	for to < len(line) && !utf8.RuneStart(line[to]) {
+		to++
+	}
+
+	s := line[from:to]
+	if from > 0 {
+		s = "..." + s
+	}
+	if to < len(line) {
+		s += "..."
+	}
+
+	return s
+}
+
+// trigrams returns all unique lower case trigrams of text.
+func trigrams(text string) []string {
+	text = strings.ToLower(text)
+	set := make(map[string]bool)
+	for i := 0; i+3 <= len(text); i++ {
+		set[text[i:i+3]] = true
+	}
+
+	grams := make([]string, 0, len(set))
+	for g := range set {
+		grams = append(grams, g)
+	}
+
+	return grams
+}
+
+// --- Index ---
+
+type indexEntry struct {
+	Runner uint64
+	Index  int
+	Status def.STATUS
+	Time   int64
+	Bloom  []byte
+}
+
+// contains returns false only if some trigram is not in the log.
+func (e *indexEntry) contains(grams []string) bool {
+	if len(e.Bloom) == 0 {
+		return true
+	}
+
+	for _, g := range grams {
+		if !bloomHas(e.Bloom, g) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newIndexer(path string) *indexer {
+	return &indexer{path: path}
+}
+
+type indexer struct {
+	path   string
+	locker sync.Mutex
+}
+
+// add indexes the log of the completed command.
+func (x *indexer) add(c *command) {
+	bytes, err := c.payloader.Range(0, 0)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	grams := trigrams(string(bytes))
+	e := &indexEntry{
+		Runner: c.runner.id,
+		Index:  c.index,
+		Status: c.Status(),
+		Time:   c.finishStamp,
+		Bloom:  make([]byte, bloomSize(len(grams))),
+	}
+	if e.Time <= 0 {
+		e.Time = time.Now().Unix()
+	}
+	for _, g := range grams {
+		bloomAdd(e.Bloom, g)
+	}
+
+	x.locker.Lock()
+	defer x.locker.Unlock()
+
+	f, err := os.OpenFile(x.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Write(e.encode()); err != nil {
+		log.Error(err)
+	}
+}
+
+// entries returns the latest entry of each command.
+func (x *indexer) entries() ([]*indexEntry, error) {
+	x.locker.Lock()
+	defer x.locker.Unlock()
+
+	all, err := x.read()
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		runner uint64
+		index  int
+	}
+
+	latest := make(map[key]int)
+	for i, e := range all {
+		latest[key{e.Runner, e.Index}] = i
+	}
+
+	entries := make([]*indexEntry, 0, len(latest))
+	for i, e := range all {
+		if latest[key{e.Runner, e.Index}] == i {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// compact removes the entries of the Runners which are not kept.
+func (x *indexer) compact(keep func(uint64) bool) error {
+	x.locker.Lock()
+	defer x.locker.Unlock()
+
+	all, err := x.read()
+	if err != nil {
+		return err
+	}
+
+	var buf gobytes.Buffer
+	for _, e := range all {
+		if keep(e.Runner) {
+			buf.Write(e.encode())
+		}
+	}
+
+	tmp := x.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, x.path)
+}
+
+// exist returns whether the index file is created.
+func (x *indexer) exist() bool {
+	_, err := os.Stat(x.path)
+	return err == nil
+}
+
+func (x *indexer) read() ([]*indexEntry, error) {
+	entries := make([]*indexEntry, 0)
+	f, err := os.Open(x.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, entryHeader)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			// A broken tail is written by interruption.
+			break
+		}
+
+		e := &indexEntry{
+			Runner: binary.LittleEndian.Uint64(header[0:]),
+			Index:  int(binary.LittleEndian.Uint32(header[8:])),
+			Status: def.STATUS(header[12]),
+			Time:   int64(binary.LittleEndian.Uint64(header[13:])),
+			Bloom:  make([]byte, binary.LittleEndian.Uint32(header[21:])),
+		}
+		if len(e.Bloom) > bloomMax {
+			break
+		}
+		if _, err := io.ReadFull(r, e.Bloom); err != nil {
+			break
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (e *indexEntry) encode() []byte {
+	bytes := make([]byte, entryHeader+len(e.Bloom))
+	binary.LittleEndian.PutUint64(bytes[0:], e.Runner)
+	binary.LittleEndian.PutUint32(bytes[8:], uint32(e.Index))
+	bytes[12] = byte(e.Status)
+	binary.LittleEndian.PutUint64(bytes[13:], uint64(e.Time))
+	binary.LittleEndian.PutUint32(bytes[21:], uint32(len(e.Bloom)))
+	copy(bytes[entryHeader:], e.Bloom)
+
+	return bytes
+}
+
+// --- Bloom ---
+
+// bloomSize returns the filter bytes for n items, about 10 bits each.
+func bloomSize(n int) int {
+	size := n * 10 / 8
+	if size < bloomMin {
+		return bloomMin
+	}
+	if size > bloomMax {
+		return bloomMax
+	}
+
+	return size
+}
+
+// bloomHashes returns 3 bit positions of item by double hashing.
+func bloomHashes(bloom []byte, item string) [3]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	bits := uint64(len(bloom)) * 8
+	var pos [3]uint64
+	for i := range pos {
+		pos[i] = (h1 + uint64(i)*h2) % bits
+	}
+
+	return pos
+}
+
+func bloomAdd(bloom []byte, item string) {
+	for _, p := range bloomHashes(bloom, item) {
+		bloom[p/8] |= 1 << (p % 8)
+	}
+}
+
+func bloomHas(bloom []byte, item string) bool {
+	for _, p := range bloomHashes(bloom, item) {
+		if bloom[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
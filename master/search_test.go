@@ -0,0 +1,297 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"bubble/store"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, INDEXFILE)
+	x := newIndexer(file)
+	if x.exist() {
+		t.Errorf("exist expect [false], but actual [true]")
+	}
+	if entries, err := x.entries(); err != nil || len(entries) != 0 {
+		t.Errorf("entries expect empty, but actual %v [%v]", entries, err)
+	}
+
+	all := []*indexEntry{
+		{Runner: 1, Index: 0, Status: def.SUCCESS, Time: 100, Bloom: make([]byte, bloomMin)},
+		{Runner: 1, Index: 1, Status: def.FAILURE, Time: 101, Bloom: make([]byte, bloomMin)},
+		{Runner: 2, Index: 0, Status: def.CANCEL, Time: 200, Bloom: []byte{}},
+		{Runner: 1, Index: 1, Status: def.SUCCESS, Time: 300, Bloom: make([]byte, bloomMin)},
+	}
+	bloomAdd(all[0].Bloom, "abc")
+
+	var bytes []byte
+	for _, e := range all {
+		bytes = append(bytes, e.encode()...)
+	}
+	// A broken tail is ignored.
+	bytes = append(bytes, all[0].encode()[:entryHeader+1]...)
+	if err := ioutil.WriteFile(file, bytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := x.read()
+	if err != nil || !reflect.DeepEqual(read, all) {
+		t.Errorf("read expect %v, but actual %v [%v]", all, read, err)
+	}
+
+	// The latest entry of each command is kept.
+	entries, err := x.entries()
+	if err != nil || !reflect.DeepEqual(entries, []*indexEntry{all[0], all[2], all[3]}) {
+		t.Errorf("entries expect %v, but actual %v [%v]", []*indexEntry{all[0], all[2], all[3]}, entries, err)
+	}
+
+	if err := x.compact(func(runner uint64) bool { return runner != 1 }); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := x.entries(); err != nil || !reflect.DeepEqual(entries, []*indexEntry{all[2]}) {
+		t.Errorf("entries after compact expect %v, but actual %v [%v]", []*indexEntry{all[2]}, entries, err)
+	}
+
+	// An invalid bloom size stops reading.
+	broken := all[0].encode()
+	broken[21], broken[22], broken[23] = 0xff, 0xff, 0xff
+	if err := ioutil.WriteFile(file, append(all[2].encode(), broken...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := x.read(); err != nil || !reflect.DeepEqual(read, []*indexEntry{all[2]}) {
+		t.Errorf("read expect %v, but actual %v [%v]", []*indexEntry{all[2]}, read, err)
+	}
+}
+
+func TestBloom(t *testing.T) {
+	sizes := []struct {
+		n    int
+		size int
+	}{
+		{0, bloomMin},
+		{100, bloomMin},
+		{1000, 1250},
+		{1000000, bloomMax},
+	}
+	for _, c := range sizes {
+		if size := bloomSize(c.n); size != c.size {
+			t.Errorf("bloomSize [%d] expect [%d], but actual [%d]", c.n, c.size, size)
+		}
+	}
+
+	text := "Build finished: 42 warnings, 0 errors in Assets/Scripts/Player.cs"
+	grams := trigrams(text)
+	e := &indexEntry{Bloom: make([]byte, bloomSize(len(grams)))}
+	for _, g := range grams {
+		bloomAdd(e.Bloom, g)
+	}
+
+	cases := []struct {
+		text     string
+		contains bool
+	}{
+		{"warnings", true},
+		{"PLAYER.CS", true},
+		{"Assets/Scripts", true},
+		{"ab", true},
+		{"exception", false},
+		{"fatal error", false},
+	}
+	for _, c := range cases {
+		if contains := e.contains(trigrams(c.text)); contains != c.contains {
+			t.Errorf("contains [%s] expect [%t], but actual [%t]", c.text, c.contains, contains)
+		}
+	}
+
+	// An empty bloom could contain anything.
+	if !(&indexEntry{}).contains(trigrams("anything")) {
+		t.Errorf("empty bloom expect contains, but actual not")
+	}
+
+	// About 10 bits per item keeps false positives low.
+	grams = make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		grams = append(grams, fmt.Sprintf("%03d", i%1000)+fmt.Sprint(i/1000))
+	}
+	bloom := make([]byte, bloomSize(1000))
+	for _, g := range grams[:1000] {
+		bloomAdd(bloom, g)
+	}
+	positives := 0
+	for _, g := range grams[1000:] {
+		if bloomHas(bloom, g) {
+			positives++
+		}
+	}
+	if positives > 100 {
+		t.Errorf("false positives expect at most [100], but actual [%d]", positives)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	cases := []struct {
+		query *SearchQuery
+		line  string
+		start int
+		end   int
+		grams []string
+		err   bool
+	}{
+		{&SearchQuery{Text: "Error"}, "fatal ERROR: x", 6, 11, []string{"err", "rro", "ror"}, false},
+		{&SearchQuery{Text: "error"}, "warning", -1, -1, []string{"err", "rro", "ror"}, false},
+		{&SearchQuery{Text: "ab"}, "cab", 1, 3, []string{}, false},
+		{&SearchQuery{Text: ""}, "", 0, 0, nil, true},
+		{&SearchQuery{Text: `exit code \d+`, Regex: true}, "exit code 12.", 0, 12, []string{"exi", "xit", "it ", "t c", " co", "cod", "ode", "de "}, false},
+		{&SearchQuery{Text: `\d+ warnings`, Regex: true}, "3 warnings", 0, 10, []string{}, false},
+		{&SearchQuery{Text: `(`, Regex: true}, "", 0, 0, nil, true},
+	}
+
+	for _, c := range cases {
+		match, grams, err := matcher(c.query)
+		if c.err {
+			if err == nil {
+				t.Errorf("matcher [%s] expect failure, but actual success", c.query.Text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("matcher [%s] expect success, but actual [%s]", c.query.Text, err)
+			continue
+		}
+
+		if start, end := match(c.line); start != c.start || end != c.end {
+			t.Errorf("matcher [%s] [%s] expect [%d, %d], but actual [%d, %d]", c.query.Text, c.line, c.start, c.end, start, end)
+		}
+		sort.Strings(grams)
+		sort.Strings(c.grams)
+		if !reflect.DeepEqual(grams, c.grams) {
+			t.Errorf("matcher [%s] trigrams expect %v, but actual %v", c.query.Text, c.grams, grams)
+		}
+	}
+}
+
+func TestSearchAccept(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cases := []struct {
+		query  *SearchQuery
+		entry  *indexEntry
+		accept bool
+	}{
+		{&SearchQuery{}, &indexEntry{Status: def.FAILURE, Time: 1}, true},
+		{&SearchQuery{Statuses: []def.STATUS{def.FAILURE, def.CANCEL}}, &indexEntry{Status: def.CANCEL}, true},
+		{&SearchQuery{Statuses: []def.STATUS{def.FAILURE}}, &indexEntry{Status: def.SUCCESS}, false},
+		{&SearchQuery{Since: now}, &indexEntry{Time: 1000}, true},
+		{&SearchQuery{Since: now}, &indexEntry{Time: 999}, false},
+		{&SearchQuery{Until: now}, &indexEntry{Time: 1000}, true},
+		{&SearchQuery{Until: now}, &indexEntry{Time: 1001}, false},
+	}
+
+	for i, c := range cases {
+		if accept := c.query.accept(c.entry); accept != c.accept {
+			t.Errorf("Case [%d] expect accept [%t], but actual [%t]", i, c.accept, accept)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", 300) + "MATCH" + strings.Repeat("b", 300)
+	cases := []struct {
+		line    string
+		start   int
+		end     int
+		snippet string
+	}{
+		{"short line\r", 0, 5, "short line"},
+		{long, 300, 305, "..." + strings.Repeat("a", 97) + "MATCH" + strings.Repeat("b", 98) + "..."},
+		{long, 0, 3, strings.Repeat("a", SNIPPETLENGTH) + "..."},
+		{long, 600, 605, "..." + strings.Repeat("b", SNIPPETLENGTH)},
+		{strings.Repeat("é", 150), 2, 4, strings.Repeat("é", SNIPPETLENGTH/2) + "..."},
+	}
+
+	for i, c := range cases {
+		if s := snippet(c.line, c.start, c.end); s != c.snippet {
+			t.Errorf("Case [%d] expect [%s], but actual [%s]", i, c.snippet, s)
+		}
+	}
+}
+
+func TestSearchAllow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{dir: dir, store: store.NewFileStore(path.Join(dir, "jobs")), jobs: make(map[string]IJob)}
+	for i, name := range []string{"build", "prod"} {
+		j, err := NewJob(m, uint64(i+1), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.jobs[name] = j
+
+		r := NewRunner(uint64(0x10+i), j.(*job), []byte("- action: shell\n"), "", nil)
+		j.(*job).runners[r.ID()] = r
+		cmd := r.Commands()[0].(*command)
+		cmd.status = def.SUCCESS
+		cmd.payloader.Write([]byte("deploy token in " + name + "\n"))
+		cmd.payloader.Flush()
+		j.(*job).index.add(cmd)
+	}
+
+	a := newAuth(env.NewAny(map[interface{}]interface{}{"password": "secret"}), dir)
+	if err := a.users.Set("alice", "alice-pw", VIEWER, map[string]ROLE{"prod": NOROLE}); err != nil {
+		t.Fatal(err)
+	}
+	w := &web{master: m, auth: a}
+
+	cases := []struct {
+		user string
+		job  string
+		jobs []string
+	}{
+		{"", "", []string{"build", "prod"}},
+		{"admin", "", []string{"build", "prod"}},
+		{"alice", "", []string{"build"}},
+		{"alice", "prod", []string{}},
+	}
+
+	for _, c := range cases {
+		data, err := w.Search("deploy token", false, c.job, nil, "", "", 0, c.user)
+		if err != nil {
+			t.Errorf("Search by [%s] failed: %s", c.user, err)
+			continue
+		}
+
+		var results []*SearchResult
+		json.Unmarshal(data, &results)
+		jobs := make([]string, 0)
+		for _, r := range results {
+			jobs = append(jobs, r.Job)
+		}
+		sort.Strings(jobs)
+		if !reflect.DeepEqual(jobs, c.jobs) {
+			t.Errorf("Search by [%s] in [%s] expect %v, but actual %v", c.user, c.job, c.jobs, jobs)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Secrets are encrypted by AES-GCM with the master key and saved in
+// SECRETSFILE. They are referenced in job scripts as `$secret.NAME`,
+// delivered only to the commands which reference them, and masked in
+// all logs. The name must be literal in the script or variables, e.g.
+// `$secret.$NAME` with NAME from params is not delivered.
+
+package master
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	log "github.com/cihub/seelog"
+)
+
+// NewSecrets method create an ISecrets by file path and master key.
+func NewSecrets(file string, key string) ISecrets {
+	s := &secrets{file: file, values: make(map[string][]byte)}
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		s.key = sum[:]
+	}
+
+	if err := s.load(); err != nil {
+		log.Error(err)
+	}
+
+	return s
+}
+
+const (
+	// SECRETSFILE defines the encrypted secrets file name.
+	SECRETSFILE string = ".bubble.secrets"
+	// SECRETKEYENV defines the OS env name of the master key.
+	SECRETKEYENV string = "BUBBLE_MASTER_KEY"
+	// SECRETPREFIX defines the variable namespace of secrets.
+	SECRETPREFIX string = "secret."
+	// SECRETMASK defines the text to replace secret values in logs.
+	SECRETMASK string = "******"
+)
+
+var (
+	secretNameExp = regexp.MustCompile(`^\w+$`)
+	secretRefExp  = regexp.MustCompile(`\$secret\.(\w+)`)
+)
+
+type secrets struct {
+	file   string
+	key    []byte
+	locker sync.Mutex
+	values map[string][]byte
+}
+
+func (s *secrets) Names() []string {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	names := make([]string, 0, len(s.values))
+	for k := range s.values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *secrets) Get(name string) (string, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	data, ok := s.values[name]
+	if !ok {
+		return "", fmt.Errorf("secret [%s] is not exist", name)
+	}
+
+	gcm, err := s.cipher()
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret [%s] data is broken", name)
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func (s *secrets) Set(name string, value string) error {
+	if !secretNameExp.MatchString(name) {
+		return fmt.Errorf("secret name [%s] is invalid", name)
+	}
+
+	gcm, err := s.cipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.values[name] = gcm.Seal(nonce, nonce, []byte(value), nil)
+	return s.flush()
+}
+
+func (s *secrets) Delete(name string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if _, ok := s.values[name]; !ok {
+		return fmt.Errorf("secret [%s] is not exist", name)
+	}
+
+	delete(s.values, name)
+	return s.flush()
+}
+
+// --- Inner ---
+
+func (s *secrets) cipher() (cipher.AEAD, error) {
+	if s.key == nil {
+		return nil, errors.New("master key for secrets is not configured")
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (s *secrets) load() error {
+	_, err := os.Stat(s.file)
+	if err != nil {
+		return nil
+	}
+
+	bytes, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, &s.values)
+}
+
+func (s *secrets) flush() error {
+	bytes, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.file, bytes, 0600)
+}
+
+// references returns all secret names referenced literally in data, names
+// composed from params or variables at runtime are not resolved.
+func references(data ...[]byte) []string {
+	names := make([]string, 0)
+	exists := make(map[string]bool)
+	for _, d := range data {
+		for _, m := range secretRefExp.FindAllSubmatch(d, -1) {
+			name := string(m[1])
+			if !exists[name] {
+				exists[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
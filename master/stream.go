@@ -0,0 +1,213 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// stream pushes the logs and status changes of all commands of a Runner
+// to viewers. Commands are executed one by one, so the stream sends them
+// in index order, and each event id "index:offset" is enough to resume
+// the stream after reconnecting.
+
+package master
+
+import (
+	"bubble/def"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// LOGEVENT defines the event of a log chunk.
+	LOGEVENT string = "log"
+	// STATUSEVENT defines the event of a command status change.
+	STATUSEVENT string = "status"
+	// ENDEVENT defines the event of the Runner completion.
+	ENDEVENT string = "end"
+	// EVENTBUFFER defines the event channel buffer size of each viewer.
+	EVENTBUFFER int = 256
+)
+
+// Event presents a log chunk or status change of a command.
+type Event struct {
+	Type   string     `json:"type"`
+	Index  int        `json:"index"`
+	Offset int64      `json:"offset"`
+	Status def.STATUS `json:"status"`
+	Data   string     `json:"data,omitempty"`
+
+	bytes []byte
+}
+
+// ID returns the event id, which is the resume point of the stream.
+func (e *Event) ID() string {
+	return fmt.Sprintf("%d:%d", e.Index, e.Offset+int64(len(e.bytes)))
+}
+
+// ParseEventID returns the command index and byte offset of event id.
+func ParseEventID(id string) (int, int64) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+
+	index, err := strconv.Atoi(parts[0])
+	if err != nil || index < 0 {
+		return 0, 0
+	}
+
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || offset < 0 {
+		return index, 0
+	}
+
+	return index, offset
+}
+
+type broadcaster struct {
+	locker sync.Mutex
+	subs   map[chan *Event]bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan *Event]bool)}
+}
+
+func (b *broadcaster) subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, EVENTBUFFER)
+
+	b.locker.Lock()
+	b.subs[ch] = true
+	b.locker.Unlock()
+
+	return ch, func() {
+		b.locker.Lock()
+		delete(b.subs, ch)
+		b.locker.Unlock()
+	}
+}
+
+// publish sends the event to all viewers. The event is dropped for slow
+// viewers, and they will fetch the missed logs by offset.
+func (b *broadcaster) publish(e *Event) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Stream sends events of the Runner from index and offset to send, until
+// the Runner is completed, done is closed or send fails.
+func (r *runner) Stream(index int, offset int64, done <-chan struct{}, send func(*Event) error) error {
+	// Subscribe before reading history, so nothing is missed.
+	events, cancel := r.events.subscribe()
+	defer cancel()
+
+	sent := make([]int64, len(r.cmds))
+	for i := range r.cmds {
+		if i < index {
+			sent[i] = -1
+		} else if i == index {
+			sent[i] = offset
+		}
+	}
+
+	// catchUp sends the logs of command i which are not sent yet.
+	catchUp := func(i int) error {
+		if sent[i] < 0 {
+			return nil
+		}
+
+		cmd := r.cmds[i].(*command)
+		bytes, err := cmd.payloader.Range(sent[i], 0)
+		if err != nil || len(bytes) == 0 {
+			return nil
+		}
+
+		e := &Event{Type: LOGEVENT, Index: i, Offset: sent[i], Status: cmd.Status(), bytes: bytes}
+		e.Data = base64.StdEncoding.EncodeToString(bytes)
+		sent[i] += int64(len(bytes))
+
+		return send(e)
+	}
+
+	for i, c := range r.cmds {
+		if sent[i] < 0 {
+			continue
+		}
+
+		if err := send(&Event{Type: STATUSEVENT, Index: i, Offset: sent[i], Status: c.Status()}); err != nil {
+			return err
+		}
+		if err := catchUp(i); err != nil {
+			return err
+		}
+	}
+
+	handle := func(e *Event) error {
+		if e.Index < 0 || e.Index >= len(sent) || sent[e.Index] < 0 {
+			return nil
+		}
+
+		if e.Type == STATUSEVENT {
+			return send(e)
+		}
+
+		end := e.Offset + int64(len(e.bytes))
+		switch {
+		case end <= sent[e.Index]:
+			// Sent already.
+			return nil
+		case e.Offset == sent[e.Index]:
+			sent[e.Index] = end
+			return send(e)
+		default:
+			// Overlapped or missed some chunks.
+			return catchUp(e.Index)
+		}
+	}
+
+	for {
+		select {
+		case e := <-events:
+			if err := handle(e); err != nil {
+				return err
+			}
+		case <-r.done:
+			// Send the rest events and the final status of all commands.
+			for drained := false; !drained; {
+				select {
+				case e := <-events:
+					if err := handle(e); err != nil {
+						return err
+					}
+				default:
+					drained = true
+				}
+			}
+
+			for i, c := range r.cmds {
+				if sent[i] < 0 {
+					continue
+				}
+
+				if err := catchUp(i); err != nil {
+					return err
+				}
+				if err := send(&Event{Type: STATUSEVENT, Index: i, Offset: sent[i], Status: c.Status()}); err != nil {
+					return err
+				}
+			}
+
+			return send(&Event{Type: ENDEVENT, Index: len(r.cmds), Status: r.Status()})
+		case <-done:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Templates are shared scripts saved on Master, which could be a command
+// array, or a map with `params` (name and default value, nil means
+// required) and `commands`:
+//
+// ```yaml
+// params:
+//  platform: android
+//  method:
+// commands:
+//  -
+//   action: unity
+//   script:
+//    - -batchmode -buildTarget ${platform} -executeMethod ${method}
+// ```
+//
+// Job scripts could splice templates with `include`, or use a template
+// with arguments and override keys with `uses`. Map values (like
+// `variables`) are merged and other keys are replaced. Only templates with
+// a single command could be overridden:
+//
+// ```yaml
+// - include: prepare
+// -
+//  uses: unity-build
+//  with:
+//   method: Builder.Build
+//  alias: build-android
+// ```
+
+package master
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// NewTemplates method create an ITemplates by directory.
+func NewTemplates(dir string) ITemplates {
+	return &templates{dir: dir}
+}
+
+const (
+	// TEMPLATEEXT defines the template file extension.
+	TEMPLATEEXT string = ".yml"
+	// TEMPLATEDEPTH defines the max nested depth of templates.
+	TEMPLATEDEPTH int = 8
+)
+
+var (
+	templateNameExp  = regexp.MustCompile(`^[\w.-]+$`)
+	templateParamExp = regexp.MustCompile(`\$\{\s*(\w+)\s*\}`)
+)
+
+type templates struct {
+	dir    string
+	locker sync.Mutex
+}
+
+func (t *templates) Names() []string {
+	names := make([]string, 0)
+	fs, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return names
+	}
+
+	for _, f := range fs {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), TEMPLATEEXT) {
+			names = append(names, strings.TrimSuffix(f.Name(), TEMPLATEEXT))
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (t *templates) Get(name string) ([]byte, error) {
+	if !templateNameExp.MatchString(name) {
+		return nil, fmt.Errorf("template name [%s] is invalid", name)
+	}
+
+	bytes, err := ioutil.ReadFile(t.path(name))
+	if err != nil {
+		return nil, fmt.Errorf("template [%s] is not exist", name)
+	}
+
+	return bytes, nil
+}
+
+func (t *templates) Set(name string, bytes []byte) error {
+	if !templateNameExp.MatchString(name) {
+		return fmt.Errorf("template name [%s] is invalid", name)
+	}
+
+	if _, _, err := parseTemplate(bytes); err != nil {
+		return err
+	}
+
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	if err := os.MkdirAll(t.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(t.path(name), bytes, os.ModePerm)
+}
+
+func (t *templates) Delete(name string) error {
+	if !templateNameExp.MatchString(name) {
+		return fmt.Errorf("template name [%s] is invalid", name)
+	}
+
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	if err := os.Remove(t.path(name)); err != nil {
+		return fmt.Errorf("can't delete template [%s] since it's not exist", name)
+	}
+
+	return nil
+}
+
+func (t *templates) path(name string) string {
+	return path.Join(t.dir, name+TEMPLATEEXT)
+}
+
+// --- Resolve ---
+
+// Resolve expands all `include` and `uses` items in the script bytes with
+// templates. The bytes are returned directly if there is nothing to expand.
+func Resolve(store ITemplates, bytes []byte) ([]byte, error) {
+	var script interface{}
+	if err := yaml.Unmarshal(bytes, &script); err != nil {
+		// Let Parse report the format error.
+		return bytes, nil
+	}
+
+	// The script could be a map with `commands`.
+	root, isMap := script.(map[interface{}]interface{})
+	if isMap {
+		script = root["commands"]
+	}
+
+	items, ok := script.([]interface{})
+	if !ok {
+		return bytes, nil
+	}
+
+	r := &resolver{store: store, stack: make([]string, 0)}
+	cmds, err := r.expand(items)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.changed {
+		return bytes, nil
+	}
+
+	if isMap {
+		root["commands"] = cmds
+		return yaml.Marshal(root)
+	}
+
+	return yaml.Marshal(cmds)
+}
+
+type resolver struct {
+	store   ITemplates
+	stack   []string
+	changed bool
+}
+
+// expand splices templates into items. Since the expanded items have new
+// indexes, all `where` indexes are remapped to the last command expanded
+// from the original target item.
+func (r *resolver) expand(items []interface{}) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(items))
+	last := make([]int, len(items))
+	for i, it := range items {
+		m, ok := it.(map[interface{}]interface{})
+		if !ok {
+			out = append(out, it)
+			last[i] = len(out)
+			continue
+		}
+
+		include, isInclude := m["include"]
+		uses, isUses := m["uses"]
+		if !isInclude && !isUses {
+			if w, ok := whereOf(m); ok && w > 0 && w <= i {
+				m["where"] = last[w-1]
+			}
+			out = append(out, m)
+			last[i] = len(out)
+			continue
+		}
+
+		if isInclude && isUses {
+			return nil, fmt.Errorf("command [%d] can't set both \"include\" and \"uses\"", i)
+		}
+
+		r.changed = true
+		args := make(map[string]string)
+		if with, ok := m["with"]; ok && with != nil {
+			wm, ok := with.(map[interface{}]interface{})
+			if !ok {
+				return nil, fmt.Errorf("command [%d] \"with\" should be a map", i)
+			}
+			for k, v := range wm {
+				args[fmt.Sprint(k)] = fmt.Sprint(v)
+			}
+		}
+
+		var cmds []interface{}
+		if isInclude {
+			names := make([]string, 0)
+			switch v := include.(type) {
+			case []interface{}:
+				for _, n := range v {
+					names = append(names, fmt.Sprint(n))
+				}
+			default:
+				names = append(names, fmt.Sprint(v))
+			}
+
+			for k := range m {
+				if k != "include" && k != "with" {
+					return nil, fmt.Errorf("command [%d] \"include\" can't override [%v], please use \"uses\"", i, k)
+				}
+			}
+
+			for _, n := range names {
+				sub, err := r.load(n, args)
+				if err != nil {
+					return nil, err
+				}
+				cmds = append(cmds, r.shift(sub, len(cmds))...)
+			}
+		} else {
+			sub, err := r.load(fmt.Sprint(uses), args)
+			if err != nil {
+				return nil, err
+			}
+			cmds = sub
+		}
+
+		cmds = r.shift(cmds, len(out))
+		if isUses && len(cmds) > 1 {
+			for k := range m {
+				if k != "uses" && k != "with" {
+					return nil, fmt.Errorf("command [%d] \"uses\" can't override [%v] since template [%v] has [%d] commands, please use \"include\"", i, k, uses, len(cmds))
+				}
+			}
+		}
+		if isUses {
+			// Override keys are applied after shifting, so `where` refers
+			// to the items at this level.
+			for _, c := range cmds {
+				cm, ok := c.(map[interface{}]interface{})
+				if !ok {
+					continue
+				}
+
+				for k, v := range m {
+					if k != "uses" && k != "with" {
+						cm[k] = merge(cm[k], v)
+					}
+				}
+
+				if w, ok := whereOf(m); ok && w > 0 && w <= i {
+					cm["where"] = last[w-1]
+				}
+			}
+		}
+
+		out = append(out, cmds...)
+		last[i] = len(out)
+	}
+
+	return out, nil
+}
+
+// load reads the template, substitutes the arguments and expands nested templates.
+func (r *resolver) load(name string, args map[string]string) ([]interface{}, error) {
+	if r.store == nil {
+		return nil, errors.New("templates are not available")
+	}
+
+	for _, s := range r.stack {
+		if s == name {
+			return nil, fmt.Errorf("template [%s] is included recursively", name)
+		}
+	}
+
+	if len(r.stack) >= TEMPLATEDEPTH {
+		return nil, fmt.Errorf("template [%s] is nested too deep", name)
+	}
+
+	bytes, err := r.store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	params, cmds, err := parseTemplate(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("template [%s]: %s", name, err.Error())
+	}
+
+	values := make(map[string]string)
+	if params != nil {
+		for k, v := range params {
+			key := fmt.Sprint(k)
+			if v != nil {
+				values[key] = fmt.Sprint(v)
+			}
+		}
+
+		for k := range args {
+			if _, ok := params[k]; !ok {
+				return nil, fmt.Errorf("template [%s] has no param [%s]", name, k)
+			}
+		}
+	}
+	for k, v := range args {
+		values[k] = v
+	}
+
+	sub, err := substitute(cmds, values)
+	if err != nil {
+		return nil, fmt.Errorf("template [%s]: %s", name, err.Error())
+	}
+
+	r.stack = append(r.stack, name)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	return r.expand(sub.([]interface{}))
+}
+
+// shift moves all `where` indexes of commands with offset.
+func (r *resolver) shift(cmds []interface{}, offset int) []interface{} {
+	for _, c := range cmds {
+		if m, ok := c.(map[interface{}]interface{}); ok {
+			if w, ok := whereOf(m); ok && w > 0 {
+				m["where"] = w + offset
+			}
+		}
+	}
+
+	return cmds
+}
+
+// parseTemplate returns the params (nil if not declared) and commands of template bytes.
+func parseTemplate(bytes []byte) (map[string]interface{}, []interface{}, error) {
+	var t interface{}
+	if err := yaml.Unmarshal(bytes, &t); err != nil {
+		return nil, nil, err
+	}
+
+	switch v := t.(type) {
+	case []interface{}:
+		return nil, v, nil
+	case map[interface{}]interface{}:
+		cmds, ok := v["commands"].([]interface{})
+		if !ok {
+			return nil, nil, errors.New("template \"commands\" should be an array")
+		}
+
+		params := make(map[string]interface{})
+		if p, ok := v["params"]; ok && p != nil {
+			pm, ok := p.(map[interface{}]interface{})
+			if !ok {
+				return nil, nil, errors.New("template \"params\" should be a map")
+			}
+			for k, pv := range pm {
+				params[fmt.Sprint(k)] = pv
+			}
+		}
+
+		return params, cmds, nil
+	}
+
+	return nil, nil, errors.New("template should be an array or a map")
+}
+
+// substitute replaces all "${name}" in strings of v with values.
+func substitute(v interface{}, values map[string]string) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		var err error
+		s := templateParamExp.ReplaceAllStringFunc(t, func(m string) string {
+			name := templateParamExp.FindStringSubmatch(m)[1]
+			value, ok := values[name]
+			if !ok {
+				err = fmt.Errorf("param [%s] is not set", name)
+			}
+			return value
+		})
+		return s, err
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, x := range t {
+			sub, err := substitute(x, values)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = sub
+		}
+		return arr, nil
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{})
+		for k, x := range t {
+			sub, err := substitute(x, values)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = sub
+		}
+		return m, nil
+	}
+
+	return v, nil
+}
+
+// merge returns the map merged with override, or override itself if any of them is not a map.
+func merge(origin, override interface{}) interface{} {
+	om, ok := origin.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+
+	vm, ok := override.(map[interface{}]interface{})
+	if !ok {
+		return override
+	}
+
+	m := make(map[interface{}]interface{})
+	for k, v := range om {
+		m[k] = v
+	}
+	for k, v := range vm {
+		m[k] = v
+	}
+
+	return m
+}
+
+func whereOf(m map[interface{}]interface{}) (int, bool) {
+	w, ok := m["where"]
+	if !ok || w == nil {
+		return 0, false
+	}
+
+	i, err := strconv.Atoi(fmt.Sprint(w))
+	return i, err == nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewTemplates(dir)
+	cases := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"prepare", "- action: shell", true},
+		{"unity-build", "params:\n method:\ncommands:\n - action: unity", true},
+		{"v1.0", "[]", true},
+		{"", "[]", false},
+		{"a/b", "[]", false},
+		{"../x", "[]", false},
+		{"scalar", "text", false},
+		{"no-commands", "params:\n a: 1", false},
+		{"bad-params", "params: [a]\ncommands: []", false},
+	}
+
+	for _, c := range cases {
+		err := s.Set(c.name, []byte(c.content))
+		if (err == nil) != c.valid {
+			t.Errorf("Set [%s] expect valid [%t], but actual error [%v]", c.name, c.valid, err)
+		}
+		if !c.valid {
+			continue
+		}
+
+		if bytes, err := s.Get(c.name); err != nil || string(bytes) != c.content {
+			t.Errorf("Get [%s] expect [%s], but actual [%s] [%v]", c.name, c.content, bytes, err)
+		}
+	}
+
+	if names := s.Names(); !reflect.DeepEqual(names, []string{"prepare", "unity-build", "v1.0"}) {
+		t.Errorf("Names expect [prepare unity-build v1.0], but actual %v", names)
+	}
+
+	if err := s.Delete("v1.0"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Delete("v1.0"); err == nil {
+		t.Errorf("Delete twice expect failure, but actual success")
+	}
+	if _, err := s.Get("v1.0"); err == nil {
+		t.Errorf("Get deleted expect failure, but actual success")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewTemplates(dir)
+	templates := map[string]string{
+		"prepare": `
+- action: shell
+  script: [git clean -fd]
+- action: shell
+  script: [git pull]
+  where: 1
+`,
+		"notify": `
+- action: shell
+  script: [echo done]
+`,
+		"unity-build": `
+params:
+  platform: android
+  method:
+commands:
+- action: unity
+  script:
+  - -buildTarget ${platform} -executeMethod ${method}
+  variables:
+    A: "1"
+    B: "2"
+`,
+		"loop-a": "- include: loop-b",
+		"loop-b": "- include: loop-a",
+		"nested": "- include: prepare\n- include: notify",
+	}
+	for k, v := range templates {
+		if err := s.Set(k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		script   string
+		expected string
+		err      string
+	}{
+		{"plain", "- action: shell", "- action: shell", ""},
+		{"include", "- include: notify\n- action: shell", `
+- action: shell
+  script: [echo done]
+- action: shell
+`, ""},
+		{"include list", "- action: zip\n- include: [notify, prepare]", `
+- action: zip
+- action: shell
+  script: [echo done]
+- action: shell
+  script: [git clean -fd]
+- action: shell
+  script: [git pull]
+  where: 3
+`, ""},
+		{"nested", "- include: nested", `
+- action: shell
+  script: [git clean -fd]
+- action: shell
+  script: [git pull]
+  where: 1
+- action: shell
+  script: [echo done]
+`, ""},
+		{"uses", `
+- uses: unity-build
+  with:
+    method: Builder.Build
+  alias: build
+  variables:
+    B: "3"
+`, `
+- action: unity
+  script: [-buildTarget android -executeMethod Builder.Build]
+  alias: build
+  variables:
+    A: "1"
+    B: "3"
+`, ""},
+		{"where remapped", `
+- action: zip
+- include: prepare
+- action: shell
+  where: 2
+- uses: notify
+  where: 1
+`, `
+- action: zip
+- action: shell
+  script: [git clean -fd]
+- action: shell
+  script: [git pull]
+  where: 2
+- action: shell
+  where: 3
+- action: shell
+  script: [echo done]
+  where: 1
+`, ""},
+		{"map script", "variables:\n X: 1\ncommands:\n- include: notify", `
+variables:
+  X: 1
+commands:
+- action: shell
+  script: [echo done]
+`, ""},
+		{"required param", "- uses: unity-build", "", "param [method] is not set"},
+		{"unknown param", "- uses: unity-build\n  with: {method: M, target: x}", "", "has no param [target]"},
+		{"recursive", "- include: loop-a", "", "included recursively"},
+		{"not exist", "- include: none", "", "template [none] is not exist"},
+		{"uses multiple", "- action: zip\n- uses: prepare", `
+- action: zip
+- action: shell
+  script: [git clean -fd]
+- action: shell
+  script: [git pull]
+  where: 2
+`, ""},
+		{"include override", "- include: notify\n  alias: x", "", "please use \"uses\""},
+		{"uses multiple override", "- uses: prepare\n  alias: x", "", "template [prepare] has [2] commands"},
+		{"uses multiple where", "- action: zip\n- uses: nested\n  where: 1", "", "can't override [where]"},
+		{"both", "- include: notify\n  uses: notify", "", "can't set both"},
+	}
+
+	for _, c := range cases {
+		bytes, err := Resolve(s, []byte(c.script))
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("Resolve [%s] expect error [%s], but actual [%v]", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve [%s] expect success, but actual [%s]", c.name, err)
+			continue
+		}
+
+		var expected, actual interface{}
+		yaml.Unmarshal([]byte(c.expected), &expected)
+		yaml.Unmarshal(bytes, &actual)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Resolve [%s] expect %v, but actual %v", c.name, expected, actual)
+		}
+	}
+
+	if _, err := Resolve(nil, []byte("- include: notify")); err == nil {
+		t.Errorf("Resolve without templates expect failure, but actual success")
+	}
+
+	// Scripts without templates are returned as they are.
+	script := "# comment\n- action: shell\n"
+	if bytes, err := Resolve(nil, []byte(script)); err != nil || string(bytes) != script {
+		t.Errorf("Resolve expect [%s], but actual [%s] [%v]", script, bytes, err)
+	}
+}
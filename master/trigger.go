@@ -0,0 +1,335 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Jobs could start other Jobs in two ways. The `trigger` action runs on
+// Master without Worker, triggers the Jobs in `script` with `variables`
+// as params, and optionally waits for them:
+//
+// ```yaml
+// -
+//  action: trigger
+//  script:
+//   - deploy
+//  variables:
+//   VERSION: $build.version
+//  wait: true
+// ```
+//
+// The script could also be a map with `commands` and job-level
+// `on_complete`, which starts other Jobs when the Runner is completed
+// with the `when` status (success, failure or always):
+//
+// ```yaml
+// commands:
+//  - ...
+// on_complete:
+//  -
+//   jobs: [deploy, notify]
+//   when: success
+//   params:
+//    VERSION: $build.version
+//   wait: true
+//   propagate: true
+// ```
+//
+// Params are set as variables of downstream Runners. The upstream chain
+// is carried along to reject any loop.
+
+package master
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// TRIGGER defines the action name to trigger other Jobs on Master.
+	TRIGGER string = "trigger"
+	// TRIGGERDEPTH defines the max length of the upstream chain.
+	TRIGGERDEPTH int = 16
+	// UPSTREAMVAR defines the variable of the upstream Job and Runner.
+	UPSTREAMVAR string = "_UPSTREAM"
+)
+
+// Cause presents why a Runner is triggered.
+type Cause struct {
+	// Ref is the repository commit, branch or tag.
+	Ref string `json:"ref,omitempty"`
+	// Params are set as variables of the Runner.
+	Params map[string]string `json:"params,omitempty"`
+	// Chain is all upstream Job names, the nearest is the last.
+	Chain []string `json:"chain,omitempty"`
+	// Upstream is the upstream Job and Runner, like "build/5e2a9b1c".
+	Upstream string `json:"upstream,omitempty"`
+	// Rerun is the source Runner if it's a re-run.
+	Rerun string `json:"rerun,omitempty"`
+	// From is the command index which the re-run starts from.
+	From int `json:"from,omitempty"`
+	// Trace is the traceparent of the upstream Runner span.
+	Trace string `json:"trace,omitempty"`
+}
+
+// Downstream presents a Runner triggered by another Runner.
+type Downstream struct {
+	Job    string     `json:"job"`
+	Runner string     `json:"runner"`
+	Status def.STATUS `json:"status"`
+}
+
+type complete struct {
+	jobs      []string
+	when      WHEN
+	params    map[string]env.IAny
+	wait      bool
+	propagate bool
+}
+
+// commandsOf returns the command array of the script, which could be an
+// array, or a map with `commands`.
+func commandsOf(script env.IAny) (env.IAny, error) {
+	if script.IsArr() {
+		return script, nil
+	}
+
+	if script.IsMap() {
+		if cmds, ok := script.Map()["commands"]; ok && cmds.IsArr() {
+			return cmds, nil
+		}
+
+		return nil, errors.New("job script \"commands\" is not an array")
+	}
+
+	return nil, errors.New("job script is not an array")
+}
+
+// parseCompletes parses the job-level `on_complete` of the script.
+func parseCompletes(script env.IAny) ([]*complete, error) {
+	completes := make([]*complete, 0)
+	if !script.IsMap() {
+		return completes, nil
+	}
+
+	oc, ok := script.Map()["on_complete"]
+	if !ok || oc.IsNil() {
+		return completes, nil
+	}
+
+	if !oc.IsArr() {
+		return nil, errors.New("\"on_complete\" should be an array")
+	}
+
+	for i, item := range oc.Array() {
+		if !item.IsMap() {
+			return nil, fmt.Errorf("on_complete [%d] format is incorrect", i)
+		}
+
+		c := &complete{when: SUCCESS, params: make(map[string]env.IAny)}
+		for k, v := range item.Map() {
+			switch k {
+			case "jobs":
+				if v.IsArr() {
+					for _, j := range v.Array() {
+						c.jobs = append(c.jobs, j.ToString())
+					}
+				} else {
+					c.jobs = append(c.jobs, v.ToString())
+				}
+			case "when":
+				switch w := strings.TrimSpace(v.ToString()); w {
+				case "", "success":
+					c.when = SUCCESS
+				case "failure":
+					c.when = FAILURE
+				case "always":
+					c.when = ALWAYS
+				default:
+					return nil, fmt.Errorf("on_complete [%d] when [%s] should be success, failure or always", i, w)
+				}
+			case "params":
+				if !v.IsNil() {
+					if !v.IsMap() {
+						return nil, fmt.Errorf("on_complete [%d] params should be a map", i)
+					}
+					c.params = v.Map()
+				}
+			case "wait":
+				c.wait = v.Bool()
+			case "propagate":
+				c.propagate = v.Bool()
+			default:
+				return nil, fmt.Errorf("on_complete [%d] has unknown key [%s]", i, k)
+			}
+		}
+
+		if len(c.jobs) == 0 {
+			return nil, fmt.Errorf("on_complete [%d] jobs is not set", i)
+		}
+
+		completes = append(completes, c)
+	}
+
+	return completes, nil
+}
+
+// trigger executes the `trigger` command and returns its status. It's
+// already marked ongoing by Execute.
+func (r *runner) trigger(cmd *command, e env.IEnv) def.STATUS {
+	jobs := make([]string, 0)
+	if s := cmd.Script(); s != nil && !s.IsNil() {
+		if s.IsArr() {
+			for _, j := range s.Array() {
+				jobs = append(jobs, e.Format(j))
+			}
+		} else {
+			jobs = append(jobs, e.Format(s))
+		}
+	}
+
+	params := make(map[string]env.IAny)
+	if v := cmd.Variables(); v.IsMap() {
+		params = v.Map()
+	}
+
+	runners, err := r.launch(jobs, params, e, func(msg string) { cmd.Notify(def.ONGOING, []byte(msg+"\n")) })
+	if err != nil {
+		cmd.Notify(def.FAILURE, []byte(err.Error()+"\n"))
+		return def.FAILURE
+	}
+
+	status := def.SUCCESS
+	if cmd.wait {
+		status = r.wait(runners, func(msg string) { cmd.Notify(def.ONGOING, []byte(msg+"\n")) })
+	}
+
+	cmd.Notify(status, nil)
+	return status
+}
+
+// complete triggers all `on_complete` Jobs matching the Runner status, and
+// returns the propagated status of waited downstream Runners.
+func (r *runner) complete(status def.STATUS, e env.IEnv) def.STATUS {
+	result := def.SUCCESS
+	for _, c := range r.completes {
+		switch c.when {
+		case SUCCESS:
+			if status != def.SUCCESS {
+				continue
+			}
+		case FAILURE:
+			if status != def.FAILURE {
+				continue
+			}
+		}
+
+		runners, err := r.launch(c.jobs, c.params, e, func(msg string) { log.Info(msg) })
+		if err != nil {
+			log.Errorf("Job [%s] Runner [%x] on_complete failed: %s", r.job.name, r.id, err.Error())
+			if c.propagate {
+				result = def.FAILURE
+			}
+			continue
+		}
+
+		if c.wait {
+			if s := r.wait(runners, func(msg string) { log.Info(msg) }); s != def.SUCCESS && c.propagate {
+				result = def.FAILURE
+			}
+		}
+	}
+
+	return result
+}
+
+// launch triggers all Jobs with params formatted by env. It checks all
+// Jobs before triggering any of them.
+func (r *runner) launch(jobs []string, params map[string]env.IAny, e env.IEnv, report func(string)) ([]IRunner, error) {
+	chain := make([]string, 0)
+	if r.cause != nil {
+		chain = append(chain, r.cause.Chain...)
+	}
+	chain = append(chain, r.job.name)
+	if len(chain) > TRIGGERDEPTH {
+		return nil, fmt.Errorf("trigger chain [%s] is too deep", strings.Join(chain, " -> "))
+	}
+
+	targets := make([]IJob, len(jobs))
+	for i, name := range jobs {
+		for _, c := range chain {
+			if c == name {
+				return nil, fmt.Errorf("trigger loop detected: %s -> %s", strings.Join(chain, " -> "), name)
+			}
+		}
+
+		j, err := r.job.master.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		targets[i] = j
+	}
+
+	values := make(map[string]string)
+	for k, v := range params {
+		values[k] = e.Format(v)
+	}
+
+	runners := make([]IRunner, 0, len(targets))
+	for _, j := range targets {
+		dr, err := j.Trigger(&Cause{
+			Params:   values,
+			Chain:    chain,
+			Upstream: r.job.name + "/" + strconv.FormatUint(r.id, 16),
+			Trace:    r.span.Context(),
+		})
+		if err != nil {
+			return runners, err
+		}
+
+		report(fmt.Sprintf("Triggered Job [%s] Runner [%x].", j.Name(), dr.ID()))
+		runners = append(runners, dr)
+		r.record(&Downstream{Job: j.Name(), Runner: strconv.FormatUint(dr.ID(), 16), Status: def.PENDING})
+	}
+
+	return runners, nil
+}
+
+// wait blocks until all Runners are completed, and returns SUCCESS only if
+// all of them are success.
+func (r *runner) wait(runners []IRunner, report func(string)) def.STATUS {
+	r.locker.Lock()
+	r.waiting = append(r.waiting, runners...)
+	r.locker.Unlock()
+
+	status := def.SUCCESS
+	for _, dr := range runners {
+		s := dr.Wait()
+		report(fmt.Sprintf("Downstream Runner [%x] is completed with status [%d].", dr.ID(), s))
+		r.record(&Downstream{Runner: strconv.FormatUint(dr.ID(), 16), Status: s})
+		if s != def.SUCCESS {
+			status = def.FAILURE
+		}
+	}
+
+	return status
+}
+
+// record adds or updates the downstream by Runner id.
+func (r *runner) record(d *Downstream) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	for _, ds := range r.downstreams {
+		if ds.Runner == d.Runner {
+			ds.Status = d.Status
+			return
+		}
+	}
+
+	r.downstreams = append(r.downstreams, d)
+}
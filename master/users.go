@@ -0,0 +1,325 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Users are saved in USERSFILE with PBKDF2-SHA256 password hashes, and
+// API tokens are saved by SHA-256 hash, so none of them could be read
+// back from the file.
+
+package master
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// NewUsers method create an IUsers by file path.
+func NewUsers(file string) IUsers {
+	u := &users{file: file, values: make(map[string]*User)}
+	if err := u.load(); err != nil {
+		log.Error(err)
+	}
+
+	return u
+}
+
+const (
+	// USERSFILE defines the user accounts file name.
+	USERSFILE string = ".bubble.users"
+	// TOKENPREFIX defines the prefix of API tokens.
+	TOKENPREFIX string = "bbl_"
+	// HASHITERATIONS defines the PBKDF2 iterations of password hashing.
+	HASHITERATIONS int = 50000
+)
+
+var userNameExp = regexp.MustCompile(`^[\w.@-]+$`)
+
+// User presents a user account.
+type User struct {
+	Name string `json:"name"`
+	Role ROLE   `json:"role"`
+	// Jobs overrides the role in the Jobs.
+	Jobs   map[string]ROLE `json:"jobs,omitempty"`
+	Salt   string          `json:"salt,omitempty"`
+	Hash   string          `json:"hash,omitempty"`
+	Tokens []*Token        `json:"tokens,omitempty"`
+}
+
+// Token presents an API token of a user.
+type Token struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Hash    string `json:"hash,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// RoleOf returns the role of the user in the Job, or the global role if
+// job is empty.
+func (u *User) RoleOf(job string) ROLE {
+	if job != "" {
+		if r, ok := u.Jobs[job]; ok {
+			return r
+		}
+	}
+
+	return u.Role
+}
+
+type users struct {
+	file   string
+	locker sync.Mutex
+	values map[string]*User
+}
+
+func (s *users) List() []*User {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	list := make([]*User, 0, len(s.values))
+	for _, u := range s.values {
+		list = append(list, u.public())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+func (s *users) Get(name string) (*User, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	u, ok := s.values[name]
+	if !ok {
+		return nil, fmt.Errorf("user [%s] is not exist", name)
+	}
+
+	return u.public(), nil
+}
+
+func (s *users) Set(name string, password string, role ROLE, jobs map[string]ROLE) error {
+	if !userNameExp.MatchString(name) {
+		return fmt.Errorf("user name [%s] is invalid", name)
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	u, ok := s.values[name]
+	if !ok {
+		if password == "" {
+			return fmt.Errorf("password of new user [%s] is not set", name)
+		}
+		u = &User{Name: name}
+	}
+
+	if password != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		u.Salt = hex.EncodeToString(salt)
+		u.Hash = hex.EncodeToString(pbkdf2([]byte(password), salt, HASHITERATIONS, 32))
+	}
+	u.Role = role
+	u.Jobs = jobs
+
+	s.values[name] = u
+	return s.flush()
+}
+
+func (s *users) Delete(name string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if _, ok := s.values[name]; !ok {
+		return fmt.Errorf("user [%s] is not exist", name)
+	}
+
+	delete(s.values, name)
+	return s.flush()
+}
+
+func (s *users) Verify(name string, password string) (*User, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	u, ok := s.values[name]
+	if !ok {
+		return nil, errors.New("user name or password is incorrect")
+	}
+
+	salt, _ := hex.DecodeString(u.Salt)
+	hash, _ := hex.DecodeString(u.Hash)
+	if subtle.ConstantTimeCompare(pbkdf2([]byte(password), salt, HASHITERATIONS, 32), hash) != 1 {
+		return nil, errors.New("user name or password is incorrect")
+	}
+
+	return u.public(), nil
+}
+
+func (s *users) CreateToken(name string, label string) (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	u, ok := s.values[name]
+	if !ok {
+		return "", fmt.Errorf("user [%s] is not exist", name)
+	}
+
+	token := TOKENPREFIX + hex.EncodeToString(secret)
+	u.Tokens = append(u.Tokens, &Token{
+		ID:      hex.EncodeToString(id),
+		Label:   label,
+		Hash:    tokenHash(token),
+		Created: time.Now().Unix(),
+	})
+
+	return token, s.flush()
+}
+
+func (s *users) RevokeToken(name string, id string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	u, ok := s.values[name]
+	if !ok {
+		return fmt.Errorf("user [%s] is not exist", name)
+	}
+
+	for i, t := range u.Tokens {
+		if t.ID == id {
+			u.Tokens = append(u.Tokens[:i], u.Tokens[i+1:]...)
+			return s.flush()
+		}
+	}
+
+	return fmt.Errorf("token [%s] is not exist", id)
+}
+
+func (s *users) Resolve(token string) (*User, error) {
+	if !strings.HasPrefix(token, TOKENPREFIX) {
+		return nil, errors.New("token is invalid")
+	}
+
+	hash := tokenHash(token)
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	for _, u := range s.values {
+		for _, t := range u.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+				return u.public(), nil
+			}
+		}
+	}
+
+	return nil, errors.New("token is invalid")
+}
+
+// --- Inner ---
+
+// public returns a copy of the user without hashes.
+func (u *User) public() *User {
+	c := &User{Name: u.Name, Role: u.Role, Jobs: make(map[string]ROLE)}
+	for k, v := range u.Jobs {
+		c.Jobs[k] = v
+	}
+	for _, t := range u.Tokens {
+		c.Tokens = append(c.Tokens, &Token{ID: t.ID, Label: t.Label, Created: t.Created})
+	}
+
+	return c
+}
+
+func (s *users) empty() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return len(s.values) == 0
+}
+
+func (s *users) load() error {
+	_, err := os.Stat(s.file)
+	if err != nil {
+		return nil
+	}
+
+	bytes, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, &s.values)
+}
+
+func (s *users) flush() error {
+	bytes, err := json.Marshal(s.values)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.file, bytes, 0600)
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// pbkdf2 derives the key of password by HMAC-SHA256.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, size)
+
+	var counter [4]byte
+	for block := uint32(1); len(key) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:size]
+}
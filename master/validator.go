@@ -0,0 +1,342 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// validator checks .bubble.yml with the script schema, like known keys
+// of each action, valid `where` indexes, expression syntax and undefined
+// variables. Actions are only checked against connected Workers, so an
+// unknown action is a warning.
+
+package master
+
+import (
+	"bubble/env"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ERROR level issue makes the script invalid.
+	ERROR string = "error"
+	// WARNING level issue is only a hint.
+	WARNING string = "warning"
+
+	// WORKERACTIONS presents all actions running on Worker in actionKeys.
+	WORKERACTIONS string = "*"
+)
+
+// Issue presents a problem found in the script.
+type Issue struct {
+	Index   int    `json:"index"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+var (
+	// commandKeys defines all known keys of a command.
+	commandKeys = map[string]bool{
+		"action":    true,
+		"alias":     true,
+		"disk":      true,
+		"script":    true,
+		"variables": true,
+		"outputs":   true,
+		"when":      true,
+		"where":     true,
+		"wait":      true,
+		"approvers": true,
+		"timeout":   true,
+		"target":    true,
+		"prefer":    true,
+	}
+
+	// actionKeys defines keys only used by some actions.
+	actionKeys = map[string][]string{
+		"wait":      {TRIGGER},
+		"approvers": {APPROVAL},
+		"timeout":   {APPROVAL},
+		"disk":      {WORKERACTIONS},
+		"outputs":   {WORKERACTIONS},
+		"target":    {WORKERACTIONS},
+		"prefer":    {WORKERACTIONS},
+	}
+
+	// stringKeys defines all keys which value should be a string.
+	stringKeys = []string{"action", "alias", "disk", "target", "prefer"}
+
+	// knownVars defines all variables set by the system.
+	knownVars = []string{"_instance", "_output", "_upstream"}
+
+	refExp = regexp.MustCompile(`\$([A-Za-z_][\w.]*)(\()?`)
+)
+
+// Validate checks the script bytes and returns all issues found. Templates
+// are expanded first, so command indexes refer to the expanded script.
+func Validate(master IMaster, bytes []byte) []*Issue {
+	issues := make([]*Issue, 0)
+	report := func(index int, level string, format string, args ...interface{}) {
+		issues = append(issues, &Issue{Index: index, Level: level, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var store ITemplates
+	if master != nil {
+		store = master.Templates()
+	}
+	bytes, err := Resolve(store, bytes)
+	if err != nil {
+		report(-1, ERROR, "resolve templates failed: %s", err.Error())
+		return issues
+	}
+
+	script := env.NewAny(nil)
+	if err := script.FromBytes(bytes); err != nil {
+		report(-1, ERROR, "script is not valid yaml: %s", err.Error())
+		return issues
+	}
+
+	completes, err := parseCompletes(script)
+	if err != nil {
+		report(-1, ERROR, "%s", err.Error())
+	} else if master != nil {
+		for _, c := range completes {
+			for _, j := range c.jobs {
+				if _, err := master.Get(j); err != nil {
+					report(-1, WARNING, "on_complete job [%s] is not exist", j)
+				}
+			}
+		}
+	}
+
+	if script, err = commandsOf(script); err != nil {
+		report(-1, ERROR, "%s", err.Error())
+		return issues
+	}
+
+	vars := make(map[string]bool)
+	for _, v := range knownVars {
+		vars[v] = true
+	}
+
+	secrets := make(map[string]bool)
+	if master != nil && master.Secrets() != nil {
+		for _, n := range master.Secrets().Names() {
+			secrets[strings.ToLower(n)] = true
+		}
+	}
+
+	aliases := make(map[string]bool)
+	for i, c := range script.Array() {
+		if !c.IsMap() {
+			report(i, ERROR, "command [%d] format is incorrect", i)
+			continue
+		}
+
+		detail := c.Map()
+		for k := range detail {
+			if !commandKeys[k] {
+				report(i, ERROR, "unknown key [%s]", k)
+			}
+		}
+
+		for _, k := range stringKeys {
+			if v, ok := detail[k]; ok && !v.IsString() {
+				report(i, ERROR, "[%s] should be a string", k)
+			}
+		}
+
+		// Action.
+		name := ""
+		if a, ok := detail["action"]; !ok {
+			report(i, ERROR, "[action] is not set")
+		} else if a.IsString() {
+			name = a.String()
+			if master != nil && !local(name) && !supported(master, name) {
+				report(i, WARNING, "unknown action [%s], no connected Worker supports it", name)
+			}
+
+			for k := range detail {
+				if commandKeys[k] && !accepted(k, name) {
+					report(i, ERROR, "key [%s] is not supported by action [%s]", k, name)
+				}
+			}
+		}
+
+		alias := name
+		if a, ok := detail["alias"]; ok && a.IsString() {
+			alias = a.String()
+		}
+		if aliases[alias] {
+			report(i, WARNING, "alias [%s] is duplicated", alias)
+		}
+		aliases[alias] = true
+
+		// Where.
+		if w, ok := detail["where"]; ok && !w.IsNil() {
+			if where, err := strconv.Atoi(w.ToString()); err != nil {
+				report(i, ERROR, "[where] should be an integer")
+			} else if i > 0 && (where < -1 || where > i) {
+				report(i, ERROR, "[where] index [%d] should be -1 or in range [0, %d]", where, i)
+			}
+		}
+
+		// Timeout.
+		if t, ok := detail["timeout"]; ok && !t.IsNil() {
+			if _, err := time.ParseDuration(t.ToString()); err != nil {
+				report(i, ERROR, "[timeout] should be a duration like 30m or 24h")
+			}
+		}
+
+		// When.
+		when := ""
+		if w, ok := detail["when"]; ok {
+			when = strings.TrimSpace(w.ToString())
+			switch when {
+			case "", "always", "success", "failure":
+			default:
+				if err := env.CheckExpr(when); err != nil {
+					report(i, ERROR, "[when] expression is invalid: %s", err.Error())
+				}
+			}
+		}
+
+		// Variables.
+		var varsBytes []byte
+		if v, ok := detail["variables"]; ok && !v.IsNil() {
+			if !v.IsMap() {
+				report(i, ERROR, "[variables] should be a map")
+			} else {
+				varsBytes, _ = v.ToBytes()
+			}
+		}
+
+		// Check all references before the variables of this command are defined.
+		var scriptBytes []byte
+		if s, ok := detail["script"]; ok {
+			scriptBytes, _ = s.ToBytes()
+		}
+		var disk string
+		if d, ok := detail["disk"]; ok {
+			disk = d.ToString()
+		}
+		for _, m := range refExp.FindAllStringSubmatch(string(scriptBytes)+"\n"+string(varsBytes)+"\n"+when+"\n"+disk, -1) {
+			ref := strings.ToLower(strings.TrimRight(m[1], "."))
+			if m[2] != "" {
+				if _, err := env.GetSysfunc(ref); err != nil && !described(ref) {
+					report(i, WARNING, "method [$%s] may be undefined", m[1])
+				}
+			} else if strings.HasPrefix(ref, SECRETPREFIX) {
+				if !secrets[strings.TrimPrefix(ref, SECRETPREFIX)] {
+					report(i, WARNING, "secret [%s] is not exist", m[1][len(SECRETPREFIX):])
+				}
+			} else if !defined(vars, ref) {
+				report(i, WARNING, "variable [$%s] may be undefined", strings.TrimRight(m[1], "."))
+			}
+		}
+
+		// Variables and outputs are visible to following commands.
+		if v, ok := detail["variables"]; ok && v.IsMap() {
+			for k := range v.Map() {
+				vars[strings.ToLower(k)] = true
+			}
+		}
+		if o, ok := detail["outputs"]; ok && !o.IsNil() {
+			names := make([]string, 0)
+			if o.IsMap() {
+				for k := range o.Map() {
+					names = append(names, k)
+				}
+			} else if o.IsArr() {
+				for _, n := range o.Array() {
+					names = append(names, n.ToString())
+					vars[strings.ToLower(n.ToString())] = true
+				}
+			} else {
+				report(i, ERROR, "[outputs] should be an array or a map")
+			}
+
+			for _, n := range names {
+				vars[strings.ToLower(alias+"."+n)] = true
+			}
+		}
+	}
+
+	return issues
+}
+
+// issuesError combines all error level issues into an error.
+func issuesError(issues []*Issue) error {
+	msgs := make([]string, 0)
+	for _, i := range issues {
+		if i.Level == ERROR {
+			if i.Index >= 0 {
+				msgs = append(msgs, fmt.Sprintf("command [%d]: %s", i.Index, i.Message))
+			} else {
+				msgs = append(msgs, i.Message)
+			}
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// defined checks whether the variable or any of its dot prefixes is defined,
+// since "$NAME.zip" is formatted with "$NAME".
+func defined(vars map[string]bool, name string) bool {
+	for {
+		if vars[name] {
+			return true
+		}
+
+		i := strings.LastIndexByte(name, '.')
+		if i <= 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// accepted checks whether the key is used by the action.
+func accepted(key string, action string) bool {
+	actions, ok := actionKeys[key]
+	if !ok {
+		return true
+	}
+
+	for _, a := range actions {
+		if a == action || (a == WORKERACTIONS && !local(action)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// described checks whether the method is listed, like those set by Actions.
+func described(name string) bool {
+	for _, f := range env.Sysfuncs() {
+		if strings.ToLower(f.Name) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// supported checks whether any connected Worker supports the action.
+func supported(master IMaster, action string) bool {
+	for _, w := range master.Workers() {
+		if w.Get(action) != nil {
+			return true
+		}
+	}
+
+	return false
+}
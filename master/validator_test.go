@@ -0,0 +1,157 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	"strings"
+	"testing"
+)
+
+// validating is a Master with the connected Workers only.
+type validating struct {
+	IMaster
+	workers []IWorker
+}
+
+func (m *validating) Workers() []IWorker {
+	return m.workers
+}
+
+func (m *validating) Templates() ITemplates {
+	return nil
+}
+
+func (m *validating) Secrets() ISecrets {
+	return nil
+}
+
+func TestValidateActions(t *testing.T) {
+	w := &worker{proxy: &proxy{id: 1}, actions: map[string]IAction{"shell": &action{}, "deploy": &action{}}}
+	master := &validating{workers: []IWorker{w}}
+
+	cases := []struct {
+		script  string
+		level   string
+		message string
+	}{
+		{"- action: shell", "", ""},
+		{"- action: deploy", "", ""},
+		{"- action: trigger\n  script: [other]\n  wait: true", "", ""},
+		{"- action: approval", "", ""},
+		{"- action: custom", WARNING, "unknown action [custom], no connected Worker supports it"},
+		{"- script: echo", ERROR, "[action] is not set"},
+	}
+
+	for _, c := range cases {
+		issues := Validate(master, []byte(c.script))
+		level, message := "", ""
+		for _, i := range issues {
+			if i.Message == c.message {
+				level, message = i.Level, i.Message
+			}
+		}
+		if level != c.level || message != c.message {
+			t.Errorf("Validate %q expect [%s] [%s], but issues are %v", c.script, c.level, c.message, describe(issues))
+		}
+
+		// Only errors make the script rejected.
+		if err := issuesError(issues); (err != nil) != (c.level == ERROR) {
+			t.Errorf("Validate %q returns error [%v]", c.script, err)
+		}
+	}
+
+	// Without Master, actions are not checked.
+	if issues := Validate(nil, []byte("- action: custom")); len(issues) != 0 {
+		t.Errorf("Validate without Master returns %v", describe(issues))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		script  string
+		index   int
+		level   string
+		message string
+	}{
+		{"valid", `
+- action: shell
+  alias: build
+  script: [echo $_instance]
+  variables: {VERSION: "1.0"}
+  outputs: [file]
+- action: shell
+  script: [echo $VERSION $build.file $file.zip]
+  where: 0
+- action: approval
+  approvers: [alice]
+  timeout: 24h
+  where: -1
+- action: trigger
+  script: [deploy]
+  wait: true
+  when: $VERSION == "1.0" && !failure()
+`, 0, "", ""},
+		{"not array", "shell", -1, ERROR, "job script is not an array"},
+		{"not map", "- shell", 0, ERROR, "command [0] format is incorrect"},
+		{"unknown key", "- action: shell\n  scripts: [echo]", 0, ERROR, "unknown key [scripts]"},
+		{"string key", "- action: shell\n  alias: [a]", 0, ERROR, "[alias] should be a string"},
+		{"duplicated alias", "- action: shell\n- action: shell", 1, WARNING, "alias [shell] is duplicated"},
+		{"wait on shell", "- action: shell\n  wait: true", 0, ERROR, "key [wait] is not supported by action [shell]"},
+		{"approvers on trigger", "- action: trigger\n  script: [deploy]\n  approvers: [alice]", 0, ERROR, "key [approvers] is not supported by action [trigger]"},
+		{"timeout on shell", "- action: shell\n  timeout: 1h", 0, ERROR, "key [timeout] is not supported by action [shell]"},
+		{"disk on approval", "- action: approval\n  disk: /tmp", 0, ERROR, "key [disk] is not supported by action [approval]"},
+		{"outputs on trigger", "- action: trigger\n  script: [deploy]\n  outputs: [a]", 0, ERROR, "key [outputs] is not supported by action [trigger]"},
+		{"where not integer", "- action: shell\n- action: shell\n  where: x", 1, ERROR, "[where] should be an integer"},
+		{"where after", "- action: shell\n- action: shell\n  where: 2", 1, ERROR, "[where] index [2] should be -1 or in range [0, 1]"},
+		{"where before", "- action: shell\n- action: shell\n  where: -2", 1, ERROR, "[where] index [-2] should be -1 or in range [0, 1]"},
+		{"where first", "- action: shell\n  where: 5", 0, "", ""},
+		{"timeout", "- action: approval\n  timeout: 1 day", 0, ERROR, "[timeout] should be a duration like 30m or 24h"},
+		{"when status", "- action: shell\n  when: failure", 0, "", ""},
+		{"when assign", "- action: shell\n  when: $_instance = 1", 0, ERROR, "[when] expression is invalid: "},
+		{"when unclosed", "- action: shell\n  when: ($_instance == 1", 0, ERROR, "[when] expression is invalid: "},
+		{"undefined variable", "- action: shell\n  script: [echo $VERSION]", 0, WARNING, "variable [$VERSION] may be undefined"},
+		{"variable defined later", "- action: shell\n  script: [echo $V]\n  variables: {V: 1}", 0, WARNING, "variable [$V] may be undefined"},
+		{"undefined output", "- action: shell\n  alias: build\n  outputs: [file]\n- action: shell\n  script: [echo $build.dir]", 1, WARNING, "variable [$build.dir] may be undefined"},
+		{"undefined in when", "- action: shell\n  when: $BRANCH == main", 0, WARNING, "variable [$BRANCH] may be undefined"},
+		{"undefined in disk", "- action: shell\n  disk: $DISK", 0, WARNING, "variable [$DISK] may be undefined"},
+		{"undefined method", "- action: shell\n  script: [echo $nothing(1)]", 0, WARNING, "method [$nothing] may be undefined"},
+		{"undefined secret", "- action: shell\n  script: [echo $secret.token]", 0, WARNING, "secret [token] is not exist"},
+	}
+
+	for _, c := range cases {
+		issues := Validate(nil, []byte(c.script))
+		if c.message == "" {
+			if len(issues) != 0 {
+				t.Errorf("Validate [%s] expect no issues, but actual %v", c.name, describe(issues))
+			}
+			continue
+		}
+
+		found := false
+		for _, i := range issues {
+			if i.Index == c.index && i.Level == c.level && strings.HasPrefix(i.Message, c.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Validate [%s] expect [%d] [%s] [%s], but issues are %v", c.name, c.index, c.level, c.message, describe(issues))
+		}
+
+		// Only errors make the script rejected.
+		if err := issuesError(issues); (err != nil) != (c.level == ERROR) {
+			t.Errorf("Validate [%s] returns error [%v]", c.name, err)
+		}
+	}
+}
+
+func describe(issues []*Issue) []string {
+	msgs := make([]string, 0, len(issues))
+	for _, i := range issues {
+		msgs = append(msgs, i.Level+": "+i.Message)
+	}
+
+	return msgs
+}
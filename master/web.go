@@ -9,17 +9,28 @@ import (
 	"bubble/def"
 	"bubble/env"
 	mweb "bubble/master/web"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	log "github.com/cihub/seelog"
 	"github.com/gorilla/mux"
 )
 
-// NewWeb method create a new IWeb by master and configure.
-func NewWeb(master IMaster, conf env.IAny) IWeb {
+// NewWeb method create a new IWeb by master and configure, relative paths
+// in the configure are based on the base folder.
+func NewWeb(master IMaster, conf env.IAny, base string) IWeb {
 	if !conf.IsMap() {
 		return nil
 	}
@@ -41,9 +52,27 @@ func NewWeb(master IMaster, conf env.IAny) IWeb {
 		return nil
 	}
 
-	w := &web{master: master, port: port.Int()}
+	w := &web{master: master, port: port.Int(), auth: newAuth(m["auth"], master.Dir())}
+
+	// Serve HTTPS with the certificate, and verify client certificates by
+	// the CA if it's set.
+	if t, ok := m["tls"]; ok && t.IsMap() {
+		tm := t.Map()
+		cert, ok1 := tm["cert"]
+		key, ok2 := tm["key"]
+		if !ok1 || !ok2 {
+			log.Error("Both \"cert\" and \"key\" should be set in web tls configure.")
+			return nil
+		}
+		w.cert, w.key = def.Abs(base, cert.ToString()), def.Abs(base, key.ToString())
+		if ca, ok := tm["ca"]; ok {
+			w.ca = def.Abs(base, ca.ToString())
+		}
+	}
 	w.bind(mweb.NewWebApi())
-	w.bind(mweb.NewPortal(root.String(), index.String()))
+	w.bind(mweb.NewWebApiV2())
+	w.bind(mweb.NewAuthApi())
+	w.bind(mweb.NewPortal(def.Abs(base, root.String()), index.String()))
 
 	return w
 }
@@ -52,11 +81,21 @@ const (
 	runnersPerPage int = 20
 )
 
+var errAuthDisabled = errors.New("authentication is not enabled")
+
 type web struct {
 	master   IMaster
 	port     int
+	cert     string
+	key      string
+	ca       string
+	server   *http.Server
+	auth     *auth
 	controls []mweb.IWebControl
 	router   *mux.Router
+
+	// scripting serializes the conditional script updates.
+	scripting sync.Mutex
 }
 
 func (w *web) bind(control mweb.IWebControl) {
@@ -69,16 +108,49 @@ func (w *web) Serve() error {
 		c.Init(w)
 	}
 
-	go http.ListenAndServe(fmt.Sprintf(":%d", w.port), w.router)
+	w.server = &http.Server{Addr: fmt.Sprintf(":%d", w.port), Handler: w.router}
+	if w.cert == "" {
+		go w.server.ListenAndServe()
+		return nil
+	}
+
+	if w.ca != "" {
+		pem, err := ioutil.ReadFile(w.ca)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate is found in CA file [%s]", w.ca)
+		}
+		w.server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+
+	// Load the key pair before serving to report errors early.
+	if _, err := tls.LoadX509KeyPair(w.cert, w.key); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := w.server.ListenAndServeTLS(w.cert, w.key); err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
 
 	return nil
 }
 
 func (w *web) Close() {
-
+	if w.server != nil {
+		w.server.Close()
+	}
 }
 
 func (w *web) HandleFunc(path string, f func(http.ResponseWriter, *http.Request), method string) {
+	if w.auth != nil {
+		f = w.auth.guard(path, method, f)
+	}
 	w.router.Path(path).HandlerFunc(f).Methods(method)
 }
 
@@ -132,6 +204,53 @@ func (w *web) JobSetScript(job string, script string) error {
 	return j.SetScript(bytes)
 }
 
+func (w *web) JobRepo(job string) (json.RawMessage, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(j.Repo())
+}
+
+func (w *web) JobSetRepo(job string, data []byte) error {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return err
+	}
+
+	var repo *Repo
+	if len(data) > 0 {
+		repo = &Repo{}
+		if err = json.Unmarshal(data, repo); err != nil {
+			return err
+		}
+	}
+
+	return j.SetRepo(repo)
+}
+
+func (w *web) JobPlan(job string, script string) (json.RawMessage, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var bytes []byte
+	if script != "" {
+		if bytes, err = base64.StdEncoding.DecodeString(script); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := j.Plan(bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(p)
+}
+
 func (w *web) JobAddCron(job string, cronType int) (json.RawMessage, error) {
 	j, err := w.master.Get(job)
 	if err != nil {
@@ -180,13 +299,46 @@ func (w *web) JobListCrons(job string) (json.RawMessage, error) {
 	return json.Marshal(types)
 }
 
-func (w *web) JobTrigger(job string) error {
+func (w *web) JobTrigger(job string, ref string, params map[string]string) (string, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := j.Trigger(&Cause{Ref: ref, Params: params})
+	if r == nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(r.ID(), 16), err
+}
+
+func (w *web) JobRerun(job string, runner uint64, from int) (string, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := j.Rerun(runner, from)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(r.ID(), 16), nil
+}
+
+func (w *web) JobApprove(job string, runner uint64, index int, user string, approved bool, comment string) error {
 	j, err := w.master.Get(job)
 	if err != nil {
 		return err
 	}
 
-	return j.Trigger()
+	r, err := j.GetRunner(runner)
+	if err != nil {
+		return err
+	}
+
+	return r.Approve(index, user, approved, comment)
 }
 
 func (w *web) JobCancel(job string, runner uint64) error {
@@ -213,29 +365,100 @@ func (w *web) JobList(job string, index int) (json.RawMessage, error) {
 		PerPage: runnersPerPage,
 	}
 	for i := index * runnersPerPage; i < len(runners) && i < (index+1)*runnersPerPage; i++ {
-		r := runners[i]
-		rs := &runnerStatus{ID: strconv.FormatUint(r.ID(), 16), Status: def.NOTSTART}
-
-		commands := r.Commands()
-		rs.Cmds = make([]*cmdStatus, len(commands))
-		for j, c := range commands {
-			rs.Cmds[j] = &cmdStatus{
-				Index:   c.Index(),
-				Name:    c.Name(),
-				Alias:   c.Alias(),
-				Status:  c.Status(),
-				Measure: c.Measure(),
-			}
-
-			if c.Status() > rs.Status {
-				rs.Status = c.Status()
-			}
+		jobStat.Runners = append(jobStat.Runners, newRunnerStatus(runners[i]))
+	}
+
+	return json.Marshal(jobStat)
+}
+
+func (w *web) JobRunners(job string, cursor uint64, limit int) (json.RawMessage, uint64, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = runnersPerPage
+	}
+
+	// Runners are sorted from the newest, the cursor is the last returned.
+	list := make([]*runnerStatus, 0, limit)
+	var next uint64
+	for _, r := range j.Runners() {
+		if cursor != 0 && r.ID() >= cursor {
+			continue
+		}
+		if len(list) == limit {
+			next = list[len(list)-1].id
+			break
 		}
+		list = append(list, newRunnerStatus(r))
+	}
+
+	bytes, err := json.Marshal(list)
+	return bytes, next, err
+}
 
-		jobStat.Runners = append(jobStat.Runners, rs)
+func (w *web) JobRunner(job string, runner uint64) (json.RawMessage, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, err
 	}
 
-	return json.Marshal(jobStat)
+	r, err := j.GetRunner(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(newRunnerStatus(r))
+}
+
+func (w *web) JobScriptTag(job string) ([]byte, string, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, "", err
+	}
+
+	script, err := j.Script()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return script, scriptTag(script), nil
+}
+
+func (w *web) JobSetScriptIf(job string, script []byte, match string) (string, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return "", err
+	}
+
+	w.scripting.Lock()
+	defer w.scripting.Unlock()
+
+	if match != "" && match != "*" {
+		current, err := j.Script()
+		if err != nil {
+			return "", err
+		}
+		if tag := scriptTag(current); tag != match {
+			return "", mweb.NewAPIError(http.StatusPreconditionFailed, "etag_mismatch",
+				fmt.Sprintf("script of Job [%s] is changed, the current ETag is [%s]", job, tag))
+		}
+	}
+
+	if err = j.SetScript(script); err != nil {
+		return "", err
+	}
+
+	// The saved script may be formatted differently, so the tag matches
+	// the one of the next read.
+	current, err := j.Script()
+	if err != nil {
+		return "", err
+	}
+
+	return scriptTag(current), nil
 }
 
 func (w *web) JobLogRunnerIndex(job string, runner uint64, index int, full bool) (json.RawMessage, error) {
@@ -266,6 +489,128 @@ func (w *web) JobLogRunnerIndex(job string, runner uint64, index int, full bool)
 	})
 }
 
+func (w *web) JobStream(job string, runner uint64, from string, done <-chan struct{}, send func(id string, event string, data []byte) error) error {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return err
+	}
+
+	r, err := j.GetRunner(runner)
+	if err != nil {
+		return err
+	}
+
+	index, offset := ParseEventID(from)
+	return r.Stream(index, offset, done, func(e *Event) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return send(e.ID(), e.Type, data)
+	})
+}
+
+func (w *web) JobLogRange(job string, runner uint64, index int, offset int64, limit int64) (json.RawMessage, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := j.GetRunner(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := r.Commands()
+	if index < 0 || index >= len(cmds) {
+		return nil, fmt.Errorf("runner index [%d] is out of range", index)
+	}
+
+	c := cmds[index]
+	bytes, chunks, size, err := c.LogRange(offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&logRange{
+		Offset:   offset,
+		Size:     size,
+		Complete: offset+int64(len(bytes)) >= size && def.IsCompleted(c.Status()),
+		Log:      base64.StdEncoding.EncodeToString(bytes),
+		Chunks:   chunks,
+		Status:   c.Status(),
+	})
+}
+
+func (w *web) JobRecords(job string, runner uint64, index int, level string, stream string, section int) (json.RawMessage, error) {
+	j, err := w.master.Get(job)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := j.GetRunner(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := r.Commands()
+	if index < 0 || index >= len(cmds) {
+		return nil, fmt.Errorf("runner index [%d] is out of range", index)
+	}
+
+	c := cmds[index]
+	records, sections, err := c.Records(&RecordFilter{Level: def.ParseLevel(level), Stream: stream, Section: section})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&recordList{
+		Records:  records,
+		Sections: sections,
+		Status:   c.Status(),
+	})
+}
+
+func (w *web) Search(text string, regex bool, job string, statuses []string, since string, until string, limit int, user string) (json.RawMessage, error) {
+	query := &SearchQuery{Text: text, Regex: regex, Job: job, Limit: limit}
+	if w.auth != nil && user != "" {
+		u, err := w.auth.users.Get(user)
+		if err != nil {
+			return nil, err
+		}
+		query.Allow = func(job string) bool {
+			return u.RoleOf(job) >= VIEWER
+		}
+	}
+	for _, s := range statuses {
+		status, err := parseStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		query.Statuses = append(query.Statuses, status)
+	}
+
+	var err error
+	if query.Since, err = parseTime(since, false); err != nil {
+		return nil, err
+	}
+	if query.Until, err = parseTime(until, true); err != nil {
+		return nil, err
+	}
+
+	results, err := w.master.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(results)
+}
+
+func (w *web) Metrics() []byte {
+	return w.master.Metrics()
+}
+
 func (w *web) Monitor() (json.RawMessage, error) {
 	workers := w.master.Workers()
 
@@ -280,18 +625,203 @@ func (w *web) Monitor() (json.RawMessage, error) {
 	return json.Marshal(stats)
 }
 
+func (w *web) EnrollList() (json.RawMessage, error) {
+	return json.Marshal(w.master.Enrollments().List())
+}
+
+func (w *web) Enroll(name string) (string, error) {
+	return w.master.Enrollments().Enroll(name)
+}
+
+func (w *web) EnrollRevoke(name string) error {
+	return w.master.Revoke(name)
+}
+
+func (w *web) Funcs() (json.RawMessage, error) {
+	return json.Marshal(env.Sysfuncs())
+}
+
+func (w *web) SecretList() ([]string, error) {
+	return w.master.Secrets().Names(), nil
+}
+
+func (w *web) SecretSet(name string, value string) error {
+	return w.master.Secrets().Set(name, value)
+}
+
+func (w *web) SecretDelete(name string) error {
+	return w.master.Secrets().Delete(name)
+}
+
+func (w *web) TemplateList() ([]string, error) {
+	return w.master.Templates().Names(), nil
+}
+
+func (w *web) Template(name string) (string, error) {
+	bytes, err := w.master.Templates().Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(bytes), nil
+}
+
+func (w *web) TemplateSet(name string, content string) error {
+	bytes, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return err
+	}
+
+	return w.master.Templates().Set(name, bytes)
+}
+
+func (w *web) TemplateDelete(name string) error {
+	return w.master.Templates().Delete(name)
+}
+
+func (w *web) Login(name string, password string, remote string) (string, error) {
+	if w.auth == nil {
+		return "", errAuthDisabled
+	}
+
+	return w.auth.login(name, password, remote)
+}
+
+func (w *web) Logout(token string) {
+	if w.auth != nil {
+		w.auth.logout(token)
+	}
+}
+
+func (w *web) Me(user string) (json.RawMessage, error) {
+	if w.auth == nil {
+		return nil, errAuthDisabled
+	}
+
+	u, err := w.auth.users.Get(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(u)
+}
+
+func (w *web) TokenCreate(user string, label string) (string, error) {
+	if w.auth == nil {
+		return "", errAuthDisabled
+	}
+
+	return w.auth.users.CreateToken(user, label)
+}
+
+func (w *web) TokenRevoke(user string, id string) error {
+	if w.auth == nil {
+		return errAuthDisabled
+	}
+
+	return w.auth.users.RevokeToken(user, id)
+}
+
+func (w *web) UserList() (json.RawMessage, error) {
+	if w.auth == nil {
+		return nil, errAuthDisabled
+	}
+
+	return json.Marshal(w.auth.users.List())
+}
+
+func (w *web) UserSet(name string, password string, role string, jobs map[string]string) error {
+	if w.auth == nil {
+		return errAuthDisabled
+	}
+
+	r, err := ParseRole(role)
+	if err != nil {
+		return err
+	}
+
+	roles := make(map[string]ROLE)
+	for j, n := range jobs {
+		if roles[j], err = ParseRole(n); err != nil {
+			return err
+		}
+	}
+
+	return w.auth.users.Set(name, password, r, roles)
+}
+
+func (w *web) UserDelete(name string) error {
+	if w.auth == nil {
+		return errAuthDisabled
+	}
+
+	return w.auth.users.Delete(name)
+}
+
+func (w *web) AuditList(limit int) (json.RawMessage, error) {
+	if w.auth == nil {
+		return nil, errAuthDisabled
+	}
+
+	entries, err := w.auth.entries(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(entries)
+}
+
 type cmdStatus struct {
-	Index   int        `json:"index"`
-	Name    string     `json:"name"`
-	Alias   string     `json:"alias"`
-	Status  def.STATUS `json:"status"`
-	Measure int64      `json:"measure"`
+	Index   int               `json:"index"`
+	Name    string            `json:"name"`
+	Alias   string            `json:"alias"`
+	Status  def.STATUS        `json:"status"`
+	Measure int64             `json:"measure"`
+	Outputs map[string]string `json:"outputs,omitempty"`
 }
 
 type runnerStatus struct {
-	ID     string       `json:"id"`
-	Status def.STATUS   `json:"status"`
-	Cmds   []*cmdStatus `json:"cmds"`
+	id          uint64
+	ID          string        `json:"id"`
+	Status      def.STATUS    `json:"status"`
+	Revision    string        `json:"revision,omitempty"`
+	Cause       *Cause        `json:"cause,omitempty"`
+	Downstreams []*Downstream `json:"downstreams,omitempty"`
+	Approvals   []*Approval   `json:"approvals,omitempty"`
+	Cmds        []*cmdStatus  `json:"cmds"`
+}
+
+func newRunnerStatus(r IRunner) *runnerStatus {
+	rs := &runnerStatus{
+		id:          r.ID(),
+		ID:          strconv.FormatUint(r.ID(), 16),
+		Status:      r.Status(),
+		Revision:    r.Revision(),
+		Cause:       r.Cause(),
+		Downstreams: r.Downstreams(),
+		Approvals:   r.Approvals(),
+	}
+
+	commands := r.Commands()
+	rs.Cmds = make([]*cmdStatus, len(commands))
+	for j, c := range commands {
+		rs.Cmds[j] = &cmdStatus{
+			Index:   c.Index(),
+			Name:    c.Name(),
+			Alias:   c.Alias(),
+			Status:  c.Status(),
+			Measure: c.Measure(),
+			Outputs: c.Outputs(),
+		}
+	}
+
+	return rs
+}
+
+// scriptTag returns the strong ETag of the script.
+func scriptTag(script []byte) string {
+	sum := sha256.Sum256(script)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
 }
 
 type jobStatus struct {
@@ -315,3 +845,57 @@ type logData struct {
 	Full bool   `json:"full"`
 	Log  string `json:"log"`
 }
+
+// parseStatus returns the command status by name.
+func parseStatus(name string) (def.STATUS, error) {
+	switch strings.ToLower(name) {
+	case "success":
+		return def.SUCCESS, nil
+	case "failure":
+		return def.FAILURE, nil
+	case "cancel":
+		return def.CANCEL, nil
+	case "interrupt":
+		return def.INTERRUPT, nil
+	}
+
+	return def.NOTSTART, fmt.Errorf("status [%s] should be success, failure, cancel or interrupt", name)
+}
+
+// parseTime returns the time of "2006-01-02", RFC3339 or unix seconds. The
+// end of the day is returned for a date if end is true.
+func parseTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if end {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("time [%s] should be a date, RFC3339 or unix seconds", value)
+}
+
+type recordList struct {
+	Records  []*def.Record `json:"records"`
+	Sections []*Section    `json:"sections"`
+	Status   def.STATUS    `json:"status"`
+}
+
+type logRange struct {
+	Offset   int64      `json:"offset"`
+	Size     int64      `json:"size"`
+	Complete bool       `json:"complete"`
+	Log      string     `json:"log"`
+	Chunks   []*Chunk   `json:"chunks"`
+	Status   def.STATUS `json:"status"`
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIError is the error object of API v2 with HTTP status and code.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewAPIError creates an APIError.
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// toAPIError keeps the APIError, or classifies the plain error by its
+// message, which follows "[name] is not exist" style in Master.
+func toAPIError(err error) *APIError {
+	if e, ok := err.(*APIError); ok {
+		return e
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not exist"), strings.Contains(msg, "not enrolled"):
+		return NewAPIError(http.StatusNotFound, "not_found", msg)
+	case strings.Contains(msg, "already exist"):
+		return NewAPIError(http.StatusConflict, "already_exists", msg)
+	case strings.Contains(msg, "invalid"), strings.Contains(msg, "out of range"),
+		strings.Contains(msg, "should be"), strings.Contains(msg, "is not set"):
+		return NewAPIError(http.StatusBadRequest, "invalid_argument", msg)
+	case strings.Contains(msg, "not enabled"):
+		return NewAPIError(http.StatusNotImplemented, "not_enabled", msg)
+	}
+
+	return NewAPIError(http.StatusUnprocessableEntity, "failed_precondition", msg)
+}
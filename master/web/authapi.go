@@ -0,0 +1,225 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/cihub/seelog"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// SESSIONCOOKIE defines the portal session cookie name.
+	SESSIONCOOKIE string = "bubble_session"
+)
+
+type userKey struct{}
+
+// WithUser returns the request carrying the authenticated user name.
+func WithUser(req *http.Request, user string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userKey{}, user))
+}
+
+// UserOf returns the authenticated user name of the request, empty if the
+// authentication is not enabled.
+func UserOf(req *http.Request) string {
+	user, _ := req.Context().Value(userKey{}).(string)
+	return user
+}
+
+// Credential returns the bearer token or the session cookie of the request.
+func Credential(req *http.Request) string {
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+
+	if c, err := req.Cookie(SESSIONCOOKIE); err == nil {
+		return c.Value
+	}
+
+	return ""
+}
+
+func NewAuthApi() IWebControl {
+	return &authapi{}
+}
+
+type authapi struct {
+	handler IWebHandler
+}
+
+type login struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type account struct {
+	Password string            `json:"password"`
+	Role     string            `json:"role"`
+	Jobs     map[string]string `json:"jobs"`
+}
+
+func (c *authapi) Init(handler IWebHandler) {
+	c.handler = handler
+
+	c.handler.HandleFunc(BASEURL+"auth/login", c.handleLogin, "POST")
+	c.handler.HandleFunc(BASEURL+"auth/logout", c.handleLogout, "POST")
+	c.handler.HandleFunc(BASEURL+"auth/me", c.handleMe, "GET")
+	c.handler.HandleFunc(BASEURL+"auth/tokens", c.handleTokensCreate, "POST")
+	c.handler.HandleFunc(BASEURL+"auth/tokens/{id}", c.handleTokensRevoke, "DELETE")
+	c.handler.HandleFunc(BASEURL+"users/list", c.handleUsersList, "GET")
+	c.handler.HandleFunc(BASEURL+"users/delete/{name}", c.handleUsersDelete, "DELETE")
+	c.handler.HandleFunc(BASEURL+"users/{name}", c.handleUsersSet, "POST")
+	c.handler.HandleFunc(BASEURL+"audit", c.handleAudit, "GET")
+}
+
+func (c *authapi) handleLogin(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer func() {
+		if ret.Status != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		json.NewEncoder(w).Encode(&ret)
+	}()
+
+	var l login
+	if err := json.NewDecoder(req.Body).Decode(&l); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+		return
+	}
+	log.Infof("Handle login [%s] from [%s].\n", l.Name, req.RemoteAddr)
+
+	token, err := c.handler.Login(l.Name, l.Password, req.RemoteAddr)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSIONCOOKIE,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	ret.Data = token
+}
+
+func (c *authapi) handleLogout(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	c.handler.Logout(Credential(req))
+	http.SetCookie(w, &http.Cookie{Name: SESSIONCOOKIE, Value: "", Path: "/", MaxAge: -1})
+}
+
+func (c *authapi) handleMe(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	data, err := c.handler.Me(UserOf(req))
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
+func (c *authapi) handleTokensCreate(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	user := UserOf(req)
+	label := req.URL.Query().Get("label")
+	log.Infof("Handle creating token [%s] of [%s].\n", label, user)
+
+	token, err := c.handler.TokenCreate(user, label)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = token
+	}
+}
+
+func (c *authapi) handleTokensRevoke(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	user := UserOf(req)
+	id := mux.Vars(req)["id"]
+	log.Infof("Handle revoking token [%s] of [%s].\n", id, user)
+
+	if err := c.handler.TokenRevoke(user, id); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *authapi) handleUsersList(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	data, err := c.handler.UserList()
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
+func (c *authapi) handleUsersSet(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	name := mux.Vars(req)["name"]
+	log.Infof("Handle setting user [%s].\n", name)
+
+	var a account
+	if err := json.NewDecoder(req.Body).Decode(&a); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else if err = c.handler.UserSet(name, a.Password, a.Role, a.Jobs); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *authapi) handleUsersDelete(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	name := mux.Vars(req)["name"]
+	log.Infof("Handle deleting user [%s].\n", name)
+
+	if err := c.handler.UserDelete(name); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *authapi) handleAudit(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+	data, err := c.handler.AuditList(limit)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
@@ -32,6 +32,23 @@ type IWebHandler interface {
 	// JobSetScript update target Job script code.
 	JobSetScript(job string, script string) error
 
+	// JobScriptTag returns the Job script code and its ETag.
+	JobScriptTag(job string) ([]byte, string, error)
+
+	// JobSetScriptIf updates the Job script if the current ETag matches
+	// (empty or "*" matches any), and returns the new ETag.
+	JobSetScriptIf(job string, script []byte, match string) (string, error)
+
+	// JobRepo returns the repository config of the Job.
+	JobRepo(job string) (json.RawMessage, error)
+
+	// JobSetRepo updates the repository config with JSON data, empty data
+	// means using the Job script.
+	JobSetRepo(job string, data []byte) error
+
+	// JobPlan dry-runs the script (or the Job script if it's empty) of the Job.
+	JobPlan(job string, script string) (json.RawMessage, error)
+
 	// JobAddCron add a cron with type.
 	JobAddCron(job string, cronType int) (json.RawMessage, error)
 
@@ -41,8 +58,17 @@ type IWebHandler interface {
 	// JobListCrons list all crons of the Job.
 	JobListCrons(job string) (json.RawMessage, error)
 
-	// JobTrigger to trigger the target Job with script data.
-	JobTrigger(job string) error
+	// JobTrigger to trigger the target Job, ref is the repository commit
+	// (or branch, tag) and could be empty, params are set as variables. It
+	// returns the new runner id.
+	JobTrigger(job string, ref string, params map[string]string) (string, error)
+
+	// JobRerun re-runs the target Runner from command index, and returns
+	// the new Runner id.
+	JobRerun(job string, runner uint64, from int) (string, error)
+
+	// JobApprove approves or rejects the waiting approval command at index.
+	JobApprove(job string, runner uint64, index int, user string, approved bool, comment string) error
 
 	// JobCancel to cancel the target Job.
 	JobCancel(job string, runner uint64) error
@@ -50,9 +76,100 @@ type IWebHandler interface {
 	// JobList list runner info of page index of the target Job.
 	JobList(job string, index int) (json.RawMessage, error)
 
+	// JobRunners lists at most limit runners older than the cursor runner
+	// (0 means the newest), and returns the cursor of the next page, which
+	// is 0 at the end.
+	JobRunners(job string, cursor uint64, limit int) (json.RawMessage, uint64, error)
+
+	// JobRunner returns the runner info.
+	JobRunner(job string, runner uint64) (json.RawMessage, error)
+
 	// JobLogRunnerIndex quest target runner index detail log info.
 	JobLogRunnerIndex(job string, runner uint64, index int, full bool) (json.RawMessage, error)
 
+	// JobLogRange returns at most limit bytes (no limit if it's not positive)
+	// of the runner index log from byte offset, with chunk offsets and times.
+	JobLogRange(job string, runner uint64, index int, offset int64, limit int64) (json.RawMessage, error)
+
+	// JobRecords returns the structured log records of the runner index at
+	// or above level, filtered by stream and section (-1 means all), with
+	// all sections.
+	JobRecords(job string, runner uint64, index int, level string, stream string, section int) (json.RawMessage, error)
+
+	// JobStream pushes the log chunks and status changes of all commands of
+	// the runner by send, from the event id "index:offset" (empty means the
+	// beginning), until the runner is completed or done is closed.
+	JobStream(job string, runner uint64, from string, done <-chan struct{}, send func(id string, event string, data []byte) error) error
+
+	// Search finds the text (or regular expression) in the stored logs of
+	// the job (all jobs if it's empty), filtered by command statuses and
+	// the finish time range. Only the Jobs which the user could view are
+	// searched if the user is set.
+	Search(text string, regex bool, job string, statuses []string, since string, until string, limit int, user string) (json.RawMessage, error)
+
+	// Metrics returns the telemetry in Prometheus text format.
+	Metrics() []byte
+
 	// Monitor is tracking all Worker status.
 	Monitor() (json.RawMessage, error)
+
+	// EnrollList lists all enrolled Workers.
+	EnrollList() (json.RawMessage, error)
+
+	// Enroll enrolls a Worker name and returns its token.
+	Enroll(name string) (string, error)
+
+	// EnrollRevoke revokes the enrolled Worker and disconnects it.
+	EnrollRevoke(name string) error
+
+	// Funcs lists all methods which could be called in scripts.
+	Funcs() (json.RawMessage, error)
+
+	// SecretList lists all secret names without values.
+	SecretList() ([]string, error)
+
+	// SecretSet creates or updates a secret value.
+	SecretSet(name string, value string) error
+
+	// SecretDelete deletes the target secret.
+	SecretDelete(name string) error
+
+	// TemplateList lists all template names.
+	TemplateList() ([]string, error)
+
+	// Template returns the base64 content of the target template.
+	Template(name string) (string, error)
+
+	// TemplateSet creates or updates a template with base64 content.
+	TemplateSet(name string, content string) error
+
+	// TemplateDelete deletes the target template.
+	TemplateDelete(name string) error
+
+	// Login verifies the user password and returns a new session token.
+	Login(name string, password string, remote string) (string, error)
+
+	// Logout expires the session token.
+	Logout(token string)
+
+	// Me returns the user info with the token list.
+	Me(user string) (json.RawMessage, error)
+
+	// TokenCreate creates an API token of the user, it's only returned once.
+	TokenCreate(user string, label string) (string, error)
+
+	// TokenRevoke revokes the API token of the user by id.
+	TokenRevoke(user string, id string) error
+
+	// UserList lists all users without passwords.
+	UserList() (json.RawMessage, error)
+
+	// UserSet creates or updates a user, empty password keeps the old one.
+	UserSet(name string, password string, role string, jobs map[string]string) error
+
+	// UserDelete deletes the target user.
+	UserDelete(name string) error
+
+	// AuditList returns the latest limit audit entries.
+	AuditList(limit int) (json.RawMessage, error)
 }
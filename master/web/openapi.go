@@ -0,0 +1,106 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// schema is a JSON schema object of OpenAPI.
+type schema map[string]interface{}
+
+type props map[string]schema
+
+var (
+	str     = schema{"type": "string"}
+	integer = schema{"type": "integer"}
+	boolean = schema{"type": "boolean"}
+	dict    = schema{"type": "object", "additionalProperties": str}
+
+	pathParamExp = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+func object(p props, required ...string) schema {
+	s := schema{"type": "object", "properties": p}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+// openAPI generates the OpenAPI 3 document of the API v2 routes.
+func openAPI(routes []*route) schema {
+	paths := make(map[string]schema)
+	for _, r := range routes {
+		p := "/" + r.path
+		if _, ok := paths[p]; !ok {
+			paths[p] = schema{}
+		}
+
+		params := make([]schema, 0)
+		for _, m := range pathParamExp.FindAllStringSubmatch(r.path, -1) {
+			params = append(params, schema{"name": m[1], "in": "path", "required": true, "schema": str})
+		}
+		for _, q := range r.query {
+			s := str
+			if q == "limit" || q == "offset" || q == "section" {
+				s = integer
+			}
+			params = append(params, schema{"name": q, "in": "query", "schema": s})
+		}
+
+		op := schema{
+			"summary":     r.summary,
+			"operationId": operationID(r),
+			"parameters":  params,
+			"responses": schema{
+				strconv.Itoa(r.status): schema{"description": http.StatusText(r.status)},
+				"default": schema{
+					"description": "Error",
+					"content":     schema{"application/json": schema{"schema": schema{"$ref": "#/components/schemas/Error"}}},
+				},
+			},
+		}
+		if r.body != nil {
+			op["requestBody"] = schema{
+				"required": true,
+				"content":  schema{"application/json": schema{"schema": r.body}},
+			}
+		}
+		paths[p][strings.ToLower(r.method)] = op
+	}
+
+	return schema{
+		"openapi": "3.0.3",
+		"info":    schema{"title": "Bubble API", "version": VERSIONV2},
+		"servers": []schema{{"url": strings.TrimSuffix(BASEURLV2, "/")}},
+		"paths":   paths,
+		"components": schema{
+			"schemas": schema{
+				"Error": object(props{"error": object(props{"code": str, "message": str}, "code", "message")}, "error"),
+			},
+			"securitySchemes": schema{"bearer": schema{"type": "http", "scheme": "bearer"}},
+		},
+		"security": []schema{{"bearer": []string{}}},
+	}
+}
+
+// operationID returns the camel case id by method and path, such as
+// "getJobsByJobRunnersByRunner".
+func operationID(r *route) string {
+	id := strings.ToLower(r.method)
+	for _, s := range strings.Split(strings.TrimSuffix(r.path, ".json"), "/") {
+		if m := pathParamExp.FindStringSubmatch(s); m != nil {
+			s = "by" + strings.ToUpper(m[1][:1]) + m[1][1:]
+		}
+		id += strings.ToUpper(s[:1]) + s[1:]
+	}
+
+	return id
+}
@@ -6,9 +6,12 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	log "github.com/cihub/seelog"
 	"github.com/gorilla/mux"
@@ -39,14 +42,39 @@ func (c *webapi) Init(handler IWebHandler) {
 	c.handler.HandleFunc(BASEURL+"jobs/delete/{job}", c.handleJobsDelete, "DELETE")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/script", c.handleJobsJobScript, "GET")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/script", c.handleJobsJobScript, "POST")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/repo", c.handleJobsJobRepo, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/repo", c.handleJobsJobRepo, "POST")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/plan", c.handleJobsJobPlan, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/plan", c.handleJobsJobPlan, "POST")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/crons/add/{cron}", c.handleJobsJobAddCron, "GET")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/crons/remove/{id}", c.handleJobsJobRemoveCron, "DELETE")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/crons/list", c.handleJobsJobListCrons, "GET")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/trigger", c.handleJobsJobTrigger, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/trigger", c.handleJobsJobTrigger, "POST")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/list/{index}", c.handleJobsJobList, "GET")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/cancel/{runner}", c.handleJobsJobCancelRunner, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/rerun/{runner}", c.handleJobsJobRerun, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/rerun/{runner}/{index}", c.handleJobsJobRerun, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/approve/{runner}/{index}", c.handleJobsJobApprove, "POST")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/reject/{runner}/{index}", c.handleJobsJobReject, "POST")
 	c.handler.HandleFunc(BASEURL+"jobs/{job}/log/{runner}/{index}/{full}", c.handleJobsJobLogRunnerIndex, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/logs/{runner}/{index}", c.handleJobsJobLogRange, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/records/{runner}/{index}", c.handleJobsJobRecords, "GET")
+	c.handler.HandleFunc(BASEURL+"jobs/{job}/stream/{runner}", c.handleJobsJobStream, "GET")
+	c.handler.HandleFunc(BASEURL+"search", c.handleSearch, "GET")
+	c.handler.HandleFunc("/metrics", c.handleMetrics, "GET")
 	c.handler.HandleFunc(BASEURL+"workers/monitor", c.handleWorkersMonitor, "GET")
+	c.handler.HandleFunc(BASEURL+"workers/enrolled", c.handleWorkersEnrolled, "GET")
+	c.handler.HandleFunc(BASEURL+"workers/enroll/{name}", c.handleWorkersEnroll, "POST")
+	c.handler.HandleFunc(BASEURL+"workers/revoke/{name}", c.handleWorkersRevoke, "DELETE")
+	c.handler.HandleFunc(BASEURL+"env/funcs", c.handleEnvFuncs, "GET")
+	c.handler.HandleFunc(BASEURL+"secrets/list", c.handleSecretsList, "GET")
+	c.handler.HandleFunc(BASEURL+"secrets/set/{name}", c.handleSecretsSet, "POST")
+	c.handler.HandleFunc(BASEURL+"secrets/delete/{name}", c.handleSecretsDelete, "DELETE")
+	c.handler.HandleFunc(BASEURL+"templates/list", c.handleTemplatesList, "GET")
+	c.handler.HandleFunc(BASEURL+"templates/delete/{name}", c.handleTemplatesDelete, "DELETE")
+	c.handler.HandleFunc(BASEURL+"templates/{name}", c.handleTemplatesTemplate, "GET")
+	c.handler.HandleFunc(BASEURL+"templates/{name}", c.handleTemplatesTemplate, "POST")
 }
 
 func (c *webapi) handleJobsList(w http.ResponseWriter, req *http.Request) {
@@ -122,6 +150,63 @@ func (c *webapi) handleJobsJobScript(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (c *webapi) handleJobsJobRepo(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	log.Debugf("Handle Job [%s] repository.\n", job)
+
+	switch req.Method {
+	case "GET":
+		data, err := c.handler.JobRepo(job)
+		if err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		} else {
+			ret.Data = data
+		}
+	case "POST":
+		bytes, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		} else if err = c.handler.JobSetRepo(job, bytes); err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		}
+	}
+}
+
+func (c *webapi) handleJobsJobPlan(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	log.Debugf("Handle planning Job [%s].\n", job)
+
+	script := ""
+	if req.Method == "POST" {
+		bytes, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+			return
+		}
+		script = string(bytes)
+	}
+
+	data, err := c.handler.JobPlan(job, script)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
 func (c *webapi) handleJobsJobAddCron(w http.ResponseWriter, req *http.Request) {
 	ret := &result{Status: 0}
 	defer json.NewEncoder(w).Encode(&ret)
@@ -181,9 +266,22 @@ func (c *webapi) handleJobsJobTrigger(w http.ResponseWriter, req *http.Request)
 	job := params["job"]
 	log.Debugf("Handle scheduling Job [%s].\n", job)
 
-	if err := c.handler.JobTrigger(job); err != nil {
+	// Params could be posted as a JSON map.
+	var values map[string]string
+	if req.Method == "POST" {
+		if err := json.NewDecoder(req.Body).Decode(&values); err != nil && err != io.EOF {
+			ret.Status = -1
+			ret.Data = err.Error()
+			return
+		}
+	}
+
+	id, err := c.handler.JobTrigger(job, req.URL.Query().Get("ref"), values)
+	if err != nil {
 		ret.Status = -1
 		ret.Data = err.Error()
+	} else {
+		ret.Data = id
 	}
 }
 
@@ -220,6 +318,64 @@ func (c *webapi) handleJobsJobCancelRunner(w http.ResponseWriter, req *http.Requ
 	}
 }
 
+func (c *webapi) handleJobsJobRerun(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	runner, _ := strconv.ParseUint(params["runner"], 16, 64)
+	index, _ := strconv.Atoi(params["index"])
+	log.Infof("Handle re-running Job [%s] Runner [%d] from [%d].\n", job, runner, index)
+
+	id, err := c.handler.JobRerun(job, runner, index)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = id
+	}
+}
+
+type decision struct {
+	User    string `json:"user"`
+	Comment string `json:"comment"`
+}
+
+func (c *webapi) handleJobsJobApprove(w http.ResponseWriter, req *http.Request) {
+	c.decide(w, req, true)
+}
+
+func (c *webapi) handleJobsJobReject(w http.ResponseWriter, req *http.Request) {
+	c.decide(w, req, false)
+}
+
+func (c *webapi) decide(w http.ResponseWriter, req *http.Request, approved bool) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	runner, _ := strconv.ParseUint(params["runner"], 16, 64)
+	index, _ := strconv.Atoi(params["index"])
+
+	var d decision
+	if err := json.NewDecoder(req.Body).Decode(&d); err != nil && err != io.EOF {
+		ret.Status = -1
+		ret.Data = err.Error()
+		return
+	}
+	if user := UserOf(req); user != "" {
+		d.User = user
+	}
+	log.Infof("Handle deciding Job [%s] Runner [%d] index [%d] by [%s]: %v.\n", job, runner, index, d.User, approved)
+
+	if err := c.handler.JobApprove(job, runner, index, d.User, approved, d.Comment); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
 func (c *webapi) handleJobsJobLogRunnerIndex(w http.ResponseWriter, req *http.Request) {
 	ret := &result{Status: 0}
 	defer json.NewEncoder(w).Encode(&ret)
@@ -240,6 +396,124 @@ func (c *webapi) handleJobsJobLogRunnerIndex(w http.ResponseWriter, req *http.Re
 	}
 }
 
+func (c *webapi) handleJobsJobLogRange(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	runner, _ := strconv.ParseUint(params["runner"], 16, 64)
+	index, _ := strconv.Atoi(params["index"])
+	offset, _ := strconv.ParseInt(req.URL.Query().Get("offset"), 10, 64)
+	limit, _ := strconv.ParseInt(req.URL.Query().Get("limit"), 10, 64)
+	log.Debugf("Handle log range Job [%s] Runner [%d] Index [%d] from [%d].\n", job, runner, index, offset)
+
+	l, err := c.handler.JobLogRange(job, runner, index, offset, limit)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = l
+	}
+}
+
+// handleJobsJobRecords returns the structured log records. "level" (debug,
+// info, warn, error or critical) returns records at or above it, so the
+// portal could show errors only.
+func (c *webapi) handleJobsJobRecords(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	job := params["job"]
+	runner, _ := strconv.ParseUint(params["runner"], 16, 64)
+	index, _ := strconv.Atoi(params["index"])
+	query := req.URL.Query()
+	section := -1
+	if s := query.Get("section"); s != "" {
+		section, _ = strconv.Atoi(s)
+	}
+	log.Debugf("Handle records Job [%s] Runner [%d] Index [%d] with level [%s].\n", job, runner, index, query.Get("level"))
+
+	l, err := c.handler.JobRecords(job, runner, index, query.Get("level"), query.Get("stream"), section)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = l
+	}
+}
+
+// handleJobsJobStream pushes runner events by Server-Sent Events. The
+// browser EventSource resumes with "Last-Event-ID" header automatically,
+// and "from" query could be used for the first request.
+func (c *webapi) handleJobsJobStream(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	job := params["job"]
+	runner, _ := strconv.ParseUint(params["runner"], 16, 64)
+
+	from := req.Header.Get("Last-Event-ID")
+	if from == "" {
+		from = req.URL.Query().Get("from")
+	}
+	log.Debugf("Handle streaming Job [%s] Runner [%d] from [%s].\n", job, runner, from)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	err := c.handler.JobStream(job, runner, from, req.Context().Done(), func(id string, event string, data []byte) error {
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+		flusher.Flush()
+	}
+}
+
+// handleSearch finds "q" in the stored logs. "status" could be a comma
+// separated list, and "since" and "until" could be dates like 2019-10-01.
+func (c *webapi) handleSearch(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	query := req.URL.Query()
+	regex, _ := strconv.ParseBool(query.Get("regex"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	statuses := make([]string, 0)
+	for _, s := range strings.Split(query.Get("status"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			statuses = append(statuses, s)
+		}
+	}
+	log.Debugf("Handle search [%s] in Job [%s].\n", query.Get("q"), query.Get("job"))
+
+	data, err := c.handler.Search(query.Get("q"), regex, query.Get("job"), statuses, query.Get("since"), query.Get("until"), limit, UserOf(req))
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
+// handleMetrics serves the Prometheus scrape.
+func (c *webapi) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(c.handler.Metrics())
+}
+
 func (c *webapi) handleWorkersMonitor(w http.ResponseWriter, req *http.Request) {
 	ret := &result{Status: 0}
 	defer json.NewEncoder(w).Encode(&ret)
@@ -252,3 +526,161 @@ func (c *webapi) handleWorkersMonitor(w http.ResponseWriter, req *http.Request)
 		ret.Data = data
 	}
 }
+
+func (c *webapi) handleWorkersEnrolled(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	data, err := c.handler.EnrollList()
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
+func (c *webapi) handleWorkersEnroll(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Infof("Handle enrolling Worker [%s].\n", name)
+
+	token, err := c.handler.Enroll(name)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = token
+	}
+}
+
+func (c *webapi) handleWorkersRevoke(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Infof("Handle revoking Worker [%s].\n", name)
+
+	if err := c.handler.EnrollRevoke(name); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *webapi) handleEnvFuncs(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	data, err := c.handler.Funcs()
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = data
+	}
+}
+
+func (c *webapi) handleSecretsList(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	names, err := c.handler.SecretList()
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = names
+	}
+}
+
+func (c *webapi) handleSecretsSet(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Infof("Handle setting secret [%s].\n", name)
+
+	bytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else if err = c.handler.SecretSet(name, string(bytes)); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *webapi) handleSecretsDelete(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Infof("Handle deleting secret [%s].\n", name)
+
+	if err := c.handler.SecretDelete(name); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
+
+func (c *webapi) handleTemplatesList(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	names, err := c.handler.TemplateList()
+	if err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	} else {
+		ret.Data = names
+	}
+}
+
+func (c *webapi) handleTemplatesTemplate(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Debugf("Handle template [%s].\n", name)
+
+	switch req.Method {
+	case "GET":
+		content, err := c.handler.Template(name)
+		if err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		} else {
+			ret.Data = content
+		}
+	case "POST":
+		bytes, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		} else if err = c.handler.TemplateSet(name, string(bytes)); err != nil {
+			ret.Status = -1
+			ret.Data = err.Error()
+		}
+	}
+}
+
+func (c *webapi) handleTemplatesDelete(w http.ResponseWriter, req *http.Request) {
+	ret := &result{Status: 0}
+	defer json.NewEncoder(w).Encode(&ret)
+
+	params := mux.Vars(req)
+	name := params["name"]
+	log.Infof("Handle deleting template [%s].\n", name)
+
+	if err := c.handler.TemplateDelete(name); err != nil {
+		ret.Status = -1
+		ret.Data = err.Error()
+	}
+}
@@ -0,0 +1,478 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// API v2 is resource oriented with JSON bodies. Successful responses are
+// the resource itself, lists are `{"items": [...], "next": "cursor"}` and
+// the next page is requested with `?cursor=`. Errors are returned with the
+// HTTP status as `{"error": {"code": "not_found", "message": "..."}}`.
+//
+// Job scripts are returned with an ETag, and updated with "If-Match" to
+// avoid overwriting others' changes. All routes are listed in the table of
+// routes, which is also used to generate "openapi.json".
+
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	log "github.com/cihub/seelog"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// VERSIONV2 defines the version of API v2.
+	VERSIONV2 string = "v2"
+	// BASEURLV2 defines the base url of API v2.
+	BASEURLV2 string = "/api/" + VERSIONV2 + "/"
+	// PAGELIMIT defines the default items count of a page.
+	PAGELIMIT int = 20
+)
+
+func NewWebApiV2() IWebControl {
+	c := &webapiv2{}
+	c.routes = c.table()
+	return c
+}
+
+type webapiv2 struct {
+	handler IWebHandler
+	routes  []*route
+}
+
+// route presents an API v2 route and its OpenAPI description.
+type route struct {
+	method  string
+	path    string
+	summary string
+	query   []string
+	body    schema
+	status  int
+	handle  func(w http.ResponseWriter, req *http.Request) (interface{}, error)
+}
+
+type page struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+type failure struct {
+	Error *APIError `json:"error"`
+}
+
+func (c *webapiv2) table() []*route {
+	cursor := []string{"cursor", "limit"}
+
+	return []*route{
+		{"GET", "jobs", "List Job names.", cursor, nil, http.StatusOK, c.listJobs},
+		{"POST", "jobs", "Create a Job.", nil, object(props{"name": str}, "name"), http.StatusCreated, c.createJob},
+		{"DELETE", "jobs/{job}", "Delete a Job.", nil, nil, http.StatusNoContent, c.deleteJob},
+		{"GET", "jobs/{job}/script", "Get the Job script with ETag.", nil, nil, http.StatusOK, c.getScript},
+		{"PUT", "jobs/{job}/script", "Update the Job script, If-Match header is checked.", nil, object(props{"script": str}, "script"), http.StatusNoContent, c.putScript},
+		{"GET", "jobs/{job}/repo", "Get the Job repository.", nil, nil, http.StatusOK, c.getRepo},
+		{"PUT", "jobs/{job}/repo", "Update the Job repository, null means using the script.", nil, object(props{"url": str, "branch": str, "path": str, "fallback": boolean}), http.StatusNoContent, c.putRepo},
+		{"POST", "jobs/{job}/plan", "Validate the script (or the saved one) and return the plan.", nil, object(props{"script": str}), http.StatusOK, c.plan},
+		{"GET", "jobs/{job}/runners", "List Runners from the newest.", cursor, nil, http.StatusOK, c.listRunners},
+		{"POST", "jobs/{job}/runners", "Trigger the Job.", nil, object(props{"ref": str, "params": dict}), http.StatusAccepted, c.trigger},
+		{"GET", "jobs/{job}/runners/{runner}", "Get the Runner.", nil, nil, http.StatusOK, c.getRunner},
+		{"POST", "jobs/{job}/runners/{runner}/cancel", "Cancel the Runner.", nil, nil, http.StatusAccepted, c.cancel},
+		{"POST", "jobs/{job}/runners/{runner}/rerun", "Re-run the Runner from the command.", nil, object(props{"from": integer}), http.StatusCreated, c.rerun},
+		{"GET", "jobs/{job}/runners/{runner}/commands", "List commands of the Runner.", nil, nil, http.StatusOK, c.listCommands},
+		{"GET", "jobs/{job}/runners/{runner}/commands/{index}/log", "Get the command log text from offset.", []string{"offset", "limit"}, nil, http.StatusOK, c.getLog},
+		{"GET", "jobs/{job}/runners/{runner}/commands/{index}/records", "Get the structured log records.", []string{"level", "stream", "section"}, nil, http.StatusOK, c.getRecords},
+		{"POST", "jobs/{job}/runners/{runner}/commands/{index}/approval", "Approve or reject the command.", nil, object(props{"approved": boolean, "user": str, "comment": str}, "approved"), http.StatusNoContent, c.approve},
+		{"GET", "jobs/{job}/triggers", "List cron triggers.", nil, nil, http.StatusOK, c.listTriggers},
+		{"POST", "jobs/{job}/triggers", "Add a cron trigger.", nil, object(props{"type": integer}, "type"), http.StatusCreated, c.addTrigger},
+		{"DELETE", "jobs/{job}/triggers/{id}", "Remove the cron trigger.", nil, nil, http.StatusNoContent, c.removeTrigger},
+		{"GET", "workers", "List Worker status.", nil, nil, http.StatusOK, c.listWorkers},
+		{"GET", "openapi.json", "Get this OpenAPI document.", nil, nil, http.StatusOK, c.openapi},
+	}
+}
+
+func (c *webapiv2) Init(handler IWebHandler) {
+	c.handler = handler
+
+	for _, r := range c.routes {
+		c.handler.HandleFunc(BASEURLV2+r.path, c.serve(r), r.method)
+	}
+}
+
+// serve writes the result of route handle by status, or the error object.
+func (c *webapiv2) serve(r *route) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		data, err := r.handle(w, req)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			e := toAPIError(err)
+			log.Debugf("Handle [%s %s] failed: %s.\n", req.Method, req.URL.Path, e.Message)
+			w.WriteHeader(e.Status)
+			json.NewEncoder(w).Encode(&failure{Error: e})
+			return
+		}
+
+		w.WriteHeader(r.status)
+		if r.status != http.StatusNoContent {
+			json.NewEncoder(w).Encode(data)
+		}
+	}
+}
+
+// --- Jobs ---
+
+func (c *webapiv2) listJobs(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	names, err := c.handler.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	cursor := req.URL.Query().Get("cursor")
+	limit := queryInt(req, "limit", PAGELIMIT)
+	if limit <= 0 {
+		limit = PAGELIMIT
+	}
+	p := &page{}
+	items := make([]string, 0, limit)
+	for _, n := range names {
+		if cursor != "" && n <= cursor {
+			continue
+		}
+		if len(items) == limit {
+			p.Next = items[len(items)-1]
+			break
+		}
+		items = append(items, n)
+	}
+	p.Items = items
+
+	return p, nil
+}
+
+func (c *webapiv2) createJob(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Name == "" {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "name is not set")
+	}
+	log.Debugf("Handle creating Job [%s].\n", body.Name)
+
+	return &body, c.handler.Create(body.Name)
+}
+
+func (c *webapiv2) deleteJob(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return nil, c.handler.Delete(mux.Vars(req)["job"])
+}
+
+func (c *webapiv2) getScript(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	script, tag, err := c.handler.JobScriptTag(mux.Vars(req)["job"])
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("ETag", tag)
+	return map[string]string{"script": string(script)}, nil
+}
+
+func (c *webapiv2) putScript(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body struct {
+		Script *string `json:"script"`
+	}
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Script == nil {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "script is not set")
+	}
+
+	tag, err := c.handler.JobSetScriptIf(mux.Vars(req)["job"], []byte(*body.Script), req.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("ETag", tag)
+	return nil, nil
+}
+
+func (c *webapiv2) getRepo(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return c.handler.JobRepo(mux.Vars(req)["job"])
+}
+
+func (c *webapiv2) putRepo(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body json.RawMessage
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+	if string(body) == "null" {
+		body = nil
+	}
+
+	return nil, c.handler.JobSetRepo(mux.Vars(req)["job"], body)
+}
+
+func (c *webapiv2) plan(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body struct {
+		Script string `json:"script"`
+	}
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+
+	return c.handler.JobPlan(mux.Vars(req)["job"], base64.StdEncoding.EncodeToString([]byte(body.Script)))
+}
+
+// --- Runners ---
+
+func (c *webapiv2) listRunners(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var cursor uint64
+	if s := req.URL.Query().Get("cursor"); s != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(s, 16, 64); err != nil {
+			return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "cursor ["+s+"] is invalid")
+		}
+	}
+
+	items, next, err := c.handler.JobRunners(mux.Vars(req)["job"], cursor, queryInt(req, "limit", PAGELIMIT))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &page{Items: items}
+	if next != 0 {
+		p.Next = strconv.FormatUint(next, 16)
+	}
+
+	return p, nil
+}
+
+func (c *webapiv2) trigger(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body struct {
+		Ref    string            `json:"ref"`
+		Params map[string]string `json:"params"`
+	}
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+	log.Debugf("Handle scheduling Job [%s].\n", mux.Vars(req)["job"])
+
+	id, err := c.handler.JobTrigger(mux.Vars(req)["job"], body.Ref, body.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"id": id}, nil
+}
+
+func (c *webapiv2) getRunner(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, err := runnerOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.handler.JobRunner(mux.Vars(req)["job"], runner)
+}
+
+func (c *webapiv2) cancel(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, err := runnerOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, c.handler.JobCancel(mux.Vars(req)["job"], runner)
+}
+
+func (c *webapiv2) rerun(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, err := runnerOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		From int `json:"from"`
+	}
+	if err = decode(req, &body); err != nil {
+		return nil, err
+	}
+
+	id, err := c.handler.JobRerun(mux.Vars(req)["job"], runner, body.From)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"id": id}, nil
+}
+
+func (c *webapiv2) listCommands(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, err := runnerOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.handler.JobRunner(mux.Vars(req)["job"], runner)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Cmds json.RawMessage `json:"cmds"`
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	return r.Cmds, nil
+}
+
+func (c *webapiv2) getLog(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, index, err := commandOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := int64(queryInt(req, "offset", 0))
+	limit := int64(queryInt(req, "limit", 0))
+	data, err := c.handler.JobLogRange(mux.Vars(req)["job"], runner, index, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log is plain text in v2.
+	var l map[string]interface{}
+	if err = json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	if s, ok := l["log"].(string); ok {
+		text, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		l["log"] = string(text)
+	}
+
+	return l, nil
+}
+
+func (c *webapiv2) getRecords(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, index, err := commandOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.URL.Query()
+	return c.handler.JobRecords(mux.Vars(req)["job"], runner, index, query.Get("level"), query.Get("stream"), queryInt(req, "section", -1))
+}
+
+func (c *webapiv2) approve(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	runner, index, err := commandOf(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Approved *bool  `json:"approved"`
+		User     string `json:"user"`
+		Comment  string `json:"comment"`
+	}
+	if err = decode(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Approved == nil {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "approved is not set")
+	}
+	if user := UserOf(req); user != "" {
+		body.User = user
+	}
+
+	return nil, c.handler.JobApprove(mux.Vars(req)["job"], runner, index, body.User, *body.Approved, body.Comment)
+}
+
+// --- Triggers ---
+
+func (c *webapiv2) listTriggers(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return c.handler.JobListCrons(mux.Vars(req)["job"])
+}
+
+func (c *webapiv2) addTrigger(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var body struct {
+		Type *int `json:"type"`
+	}
+	if err := decode(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Type == nil {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "type is not set")
+	}
+
+	return c.handler.JobAddCron(mux.Vars(req)["job"], *body.Type)
+}
+
+func (c *webapiv2) removeTrigger(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	id, err := strconv.ParseUint(mux.Vars(req)["id"], 16, 64)
+	if err != nil {
+		return nil, NewAPIError(http.StatusBadRequest, "invalid_argument", "trigger id ["+mux.Vars(req)["id"]+"] is invalid")
+	}
+
+	return nil, c.handler.JobRemoveCron(mux.Vars(req)["job"], id)
+}
+
+// --- Others ---
+
+func (c *webapiv2) listWorkers(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return c.handler.Monitor()
+}
+
+func (c *webapiv2) openapi(w http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return openAPI(c.routes), nil
+}
+
+// --- Inner ---
+
+// decode reads the JSON body, an empty body is allowed.
+func decode(req *http.Request, v interface{}) error {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil && err != io.EOF {
+		return NewAPIError(http.StatusBadRequest, "invalid_body", err.Error())
+	}
+
+	return nil
+}
+
+func queryInt(req *http.Request, name string, def int) int {
+	if v, err := strconv.Atoi(req.URL.Query().Get(name)); err == nil {
+		return v
+	}
+
+	return def
+}
+
+func runnerOf(req *http.Request) (uint64, error) {
+	s := mux.Vars(req)["runner"]
+	runner, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, NewAPIError(http.StatusBadRequest, "invalid_argument", "runner id ["+s+"] is invalid")
+	}
+
+	return runner, nil
+}
+
+func commandOf(req *http.Request) (uint64, int, error) {
+	runner, err := runnerOf(req)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	s := mux.Vars(req)["index"]
+	index, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, 0, NewAPIError(http.StatusBadRequest, "invalid_argument", "command index ["+s+"] is invalid")
+	}
+
+	return runner, index, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package master
+
+import (
+	mweb "bubble/master/web"
+	"bubble/store"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type scripted struct {
+	IJob
+	name string
+}
+
+// formatted is a job that saves scripts in another format, so the ETag
+// of an update must be of the saved script rather than the request.
+type formatted struct {
+	IJob
+}
+
+func (j *formatted) Script() ([]byte, error) {
+	bytes, err := j.IJob.Script()
+	if err != nil {
+		return nil, err
+	}
+
+	return reformat(string(bytes)), nil
+}
+
+func reformat(script string) []byte {
+	var source interface{}
+	yaml.Unmarshal([]byte(script), &source)
+	bytes, _ := yaml.Marshal(source)
+	return bytes
+}
+
+func TestScriptETag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &Master{dir: dir, store: store.NewFileStore(path.Join(dir, "jobs")), jobs: make(map[string]IJob)}
+	j, err := NewJob(m, 1, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.jobs["build"] = &formatted{j}
+
+	w := &web{master: m, router: mux.NewRouter()}
+	mweb.NewWebApiV2().Init(w)
+
+	url := mweb.BASEURLV2 + "jobs/build/script"
+	serve := func(method string, url string, body string, match string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if match != "" {
+			req.Header.Set("If-Match", match)
+		}
+
+		rec := httptest.NewRecorder()
+		w.router.ServeHTTP(rec, req)
+		return rec
+	}
+	current := func() string {
+		bytes, _ := m.jobs["build"].Script()
+		return string(bytes)
+	}
+	formatted := func(s string) string {
+		return string(reformat(s))
+	}
+
+	rec := serve("GET", url, "", "")
+	origin := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || origin != scriptTag([]byte(current())) {
+		t.Fatalf("GET expect [200] [%s], but actual [%d] [%s]", scriptTag([]byte(current())), rec.Code, origin)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got["script"] != current() {
+		t.Errorf("GET expect script [%s], but actual [%s] [%v]", current(), rec.Body, err)
+	}
+
+	script := func(s string) string {
+		bytes, _ := json.Marshal(map[string]string{"script": s})
+		return string(bytes)
+	}
+	s1, s2 := "- {action: shell, script: [echo v1]}", "- {action: shell, script: [echo v2]}"
+	v1, v2 := scriptTag([]byte(formatted(s1))), scriptTag([]byte(formatted(s2)))
+	if v1 == scriptTag([]byte(s1)) {
+		t.Fatalf("Script [%s] expect formatted differently, but actual the same", s1)
+	}
+
+	cases := []struct {
+		name   string
+		url    string
+		body   string
+		match  string
+		status int
+		tag    string
+		script string
+	}{
+		{"match", url, script(s1), origin, http.StatusNoContent, v1, formatted(s1)},
+		{"stale", url, script(s2), origin, http.StatusPreconditionFailed, "", formatted(s1)},
+		{"quoted wrong", url, script(s2), `"0"`, http.StatusPreconditionFailed, "", formatted(s1)},
+		{"match returned", url, script(s2), v1, http.StatusNoContent, v2, formatted(s2)},
+		{"any", url, script(s1), "*", http.StatusNoContent, v1, formatted(s1)},
+		{"no header", url, script(s2), "", http.StatusNoContent, v2, formatted(s2)},
+		{"no script", url, `{}`, v2, http.StatusBadRequest, "", formatted(s2)},
+		{"no job", mweb.BASEURLV2 + "jobs/none/script", script(s1), "*", http.StatusNotFound, "", formatted(s2)},
+	}
+
+	for _, c := range cases {
+		rec := serve("PUT", c.url, c.body, c.match)
+		if rec.Code != c.status {
+			t.Errorf("Case [%s] expect [%d], but actual [%d] [%s]", c.name, c.status, rec.Code, rec.Body)
+		}
+		if tag := rec.Header().Get("ETag"); tag != c.tag {
+			t.Errorf("Case [%s] expect ETag [%s], but actual [%s]", c.name, c.tag, tag)
+		}
+		if current() != c.script {
+			t.Errorf("Case [%s] expect script [%s], but actual [%s]", c.name, c.script, current())
+		}
+		if c.status == http.StatusPreconditionFailed && !strings.Contains(rec.Body.String(), "etag_mismatch") {
+			t.Errorf("Case [%s] expect [etag_mismatch], but actual [%s]", c.name, rec.Body)
+		}
+		if tag := serve("GET", url, "", "").Header().Get("ETag"); c.tag != "" && tag != c.tag {
+			t.Errorf("Case [%s] expect GET ETag [%s], but actual [%s]", c.name, c.tag, tag)
+		}
+	}
+
+	// Only one of the concurrent updates with the same ETag succeeds.
+	match := scriptTag([]byte(current()))
+	var wg sync.WaitGroup
+	statuses := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses <- serve("PUT", url, script(fmt.Sprintf("- {action: shell, script: [echo c%d]}", i)), match).Code
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for s := range statuses {
+		if s == http.StatusNoContent {
+			succeeded++
+		} else if s != http.StatusPreconditionFailed {
+			t.Errorf("concurrent update expect [204] or [412], but actual [%d]", s)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("concurrent updates expect [1] success, but actual [%d]", succeeded)
+	}
+}
+
+// listing is an IMaster with Jobs of names.
+type listing struct {
+	IMaster
+	names []string
+}
+
+func (m *listing) List() []IJob {
+	jobs := make([]IJob, len(m.names))
+	for i, n := range m.names {
+		jobs[i] = &scripted{name: n}
+	}
+
+	return jobs
+}
+
+func (j *scripted) Name() string {
+	return j.name
+}
+
+func TestListJobs(t *testing.T) {
+	names := make([]string, mweb.PAGELIMIT+5)
+	for i := range names {
+		names[i] = fmt.Sprintf("job%02d", i)
+	}
+	w := &web{master: &listing{names: names}, router: mux.NewRouter()}
+	mweb.NewWebApiV2().Init(w)
+
+	cases := []struct {
+		query string
+		count int
+		next  string
+	}{
+		{"", mweb.PAGELIMIT, names[mweb.PAGELIMIT-1]},
+		{"?limit=0", mweb.PAGELIMIT, names[mweb.PAGELIMIT-1]},
+		{"?limit=-1", mweb.PAGELIMIT, names[mweb.PAGELIMIT-1]},
+		{"?limit=3", 3, names[2]},
+		{"?limit=3&cursor=" + names[mweb.PAGELIMIT+1], 3, ""},
+		{"?limit=100", len(names), ""},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", mweb.BASEURLV2+"jobs"+c.query, nil)
+		rec := httptest.NewRecorder()
+		w.router.ServeHTTP(rec, req)
+
+		var p struct {
+			Items []string `json:"items"`
+			Next  string   `json:"next"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || rec.Code != http.StatusOK {
+			t.Errorf("List [%s] expect [200], but actual [%d] [%s]", c.query, rec.Code, rec.Body)
+			continue
+		}
+		if len(p.Items) != c.count || p.Next != c.next {
+			t.Errorf("List [%s] expect [%d] [%s], but actual [%d] [%s]", c.query, c.count, c.next, len(p.Items), p.Next)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bubble/def"
 	"bubble/env"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 
 	log "github.com/cihub/seelog"
@@ -33,6 +34,9 @@ type worker struct {
 	proxy    iserver.IServiceProxy
 	actions  map[string]IAction
 	workload int
+	metrics  *def.Metrics
+	reported bool
+	session  string
 }
 
 // --- IWorker ---
@@ -55,6 +59,11 @@ func (w *worker) Bind(supports map[string][]byte) error {
 }
 
 func (w *worker) Satisfy(command ICommand) bool {
+	// Master-side action could be grouped with any Worker.
+	if local(command.Name()) {
+		return true
+	}
+
 	action, ok := w.actions[command.Name()]
 	if !ok {
 		return false
@@ -95,6 +104,10 @@ func (w *worker) Workload() int {
 	return w.workload
 }
 
+func (w *worker) Metrics() *def.Metrics {
+	return w.metrics
+}
+
 func (w *worker) Get(name string) IAction {
 	a, ok := w.actions[name]
 	if !ok {
@@ -104,30 +117,37 @@ func (w *worker) Get(name string) IAction {
 	return a
 }
 
-func (w *worker) Finish(action string, runner uint64, success bool, env env.IEnv) error {
+func (w *worker) Finish(action string, runner uint64, success bool, env env.IEnv, span string) error {
 	a, ok := w.actions[action]
 	if !ok {
 		log.Errorf("There is no target Action [%s]!", action)
 		return fmt.Errorf("there is no target Action [%s]", action)
 	}
 
-	return a.Finish(runner, success, env)
+	return a.Finish(runner, success, env, span)
 }
 
-func (w *worker) Progress(action string, runner uint64, payload []byte) error {
+func (w *worker) Progress(action string, runner uint64, payload []byte, span string) error {
 	a, ok := w.actions[action]
 	if !ok {
 		log.Errorf("There is no target Action [%s]!", action)
 		return fmt.Errorf("there is no target Action [%s]", action)
 	}
 
-	return a.Progress(runner, payload)
+	return a.Progress(runner, payload, span)
 }
 
 func (w *worker) Broadcast(t def.TYPE, payload []byte) {
 	switch t {
 	case def.WORKLOAD:
 		w.workload = int(binary.BigEndian.Uint32(payload))
+	case def.METRICS:
+		m := &def.Metrics{}
+		if err := json.Unmarshal(payload, m); err != nil {
+			log.Error(err)
+			return
+		}
+		w.metrics = m
 	}
 }
 
@@ -135,6 +155,56 @@ func (w *worker) Clean(runner uint64) error {
 	return w.proxy.AsyncCall("Clean", runner)
 }
 
+func (w *worker) Lead() error {
+	return w.proxy.AsyncCall("Lead", w.master)
+}
+
+func (w *worker) Running(procs map[string][]uint64) {
+	for name, runners := range procs {
+		if a, ok := w.actions[name]; ok {
+			a.(*action).run(runners)
+		}
+	}
+	w.reported = true
+}
+
+func (w *worker) Reported() bool {
+	return w.reported
+}
+
+func (w *worker) Session() string {
+	return w.session
+}
+
+func (w *worker) Resume(session string, lost IWorker, procs map[string][]uint64) IWorker {
+	l, ok := lost.(*worker)
+	if !ok || l.session != session {
+		if lost != nil {
+			log.Warnf("Worker [%d] is restarted, its running Actions are interrupted.", w.ID())
+			lost.Destroy()
+		}
+		w.session = session
+		return w
+	}
+
+	log.Infof("Worker [%d] is reconnected.", w.ID())
+	l.proxy = w.proxy
+	l.reported = l.reported || w.reported
+	for name, a := range l.actions {
+		a.(*action).keep(procs[name])
+	}
+
+	// Supports added by the new registration.
+	for name, a := range w.actions {
+		if _, ok := l.actions[name]; !ok {
+			a.(*action).worker = l
+			l.actions[name] = a
+		}
+	}
+
+	return l
+}
+
 func (w *worker) Destroy() {
 	for _, a := range w.actions {
 		a.Destroy()
@@ -144,13 +214,18 @@ func (w *worker) Destroy() {
 
 // --- Inner ---
 
-func (w *worker) Execute(action string, runner, lastWorker uint64, disk string, script, variables []byte, target string, env env.IEnv) error {
+func (w *worker) Execute(action string, runner, lastWorker uint64, disk string, script, variables []byte, target string, env env.IEnv, secrets map[string]string, span string) error {
 	envData, err := env.ToBytes()
 	if err != nil {
 		return err
 	}
 
-	return w.proxy.AsyncCall("Execute", action, w.master, lastWorker, runner, disk, script, variables, target, envData)
+	secretData, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	return w.proxy.AsyncCall("Execute", action, w.master, lastWorker, runner, disk, script, variables, target, envData, secretData, span)
 }
 
 func (w *worker) Cancel(action string, runner uint64) error {
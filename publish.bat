@@ -8,6 +8,7 @@ set GOOS=windows
 set GOARCH=amd64
 go build -o pub/windows/master/bubble-master.exe bubble-master/main.go
 go build -o pub/windows/worker/bubble-worker.exe bubble-worker/main.go
+go build -o pub/windows/bubble.exe bubble/main.go
 cp config/master.toml config/log.xml config/master.yml pub/windows/master/
 cp config/worker.toml config/log.xml config/worker.yml pub/windows/worker/
 
@@ -16,6 +17,7 @@ set GOOS=linux
 set GOARCH=amd64
 go build -o pub/linux/master/bubble-master bubble-master/main.go
 go build -o pub/linux/worker/bubble-worker bubble-worker/main.go
+go build -o pub/linux/bubble bubble/main.go
 cp config/master.toml config/log.xml config/master.yml pub/linux/master/
 cp config/worker.toml config/log.xml config/worker.yml pub/linux/worker/
 
@@ -24,6 +26,7 @@ set GOOS=darwin
 set GOARCH=amd64
 go build -o pub/mac/master/bubble-master bubble-master/main.go
 go build -o pub/mac/worker/bubble-worker bubble-worker/main.go
+go build -o pub/mac/bubble bubble/main.go
 cp config/master.toml config/log.xml config/master.yml pub/mac/master/
 cp config/worker.toml config/log.xml config/worker.yml pub/mac/worker/
 
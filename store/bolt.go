@@ -0,0 +1,118 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// NewBoltStore creates an IStore keeping all keys in the bolt database file.
+func NewBoltStore(file string) (IStore, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: OPENTIMEOUT})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(BUCKET)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+// OPENTIMEOUT defines the time to wait for the database file lock.
+const OPENTIMEOUT time.Duration = 5 * time.Second
+
+// BUCKET defines the bucket name of all keys.
+var BUCKET = []byte("bubble")
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+func (s *boltStore) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(BUCKET).Get([]byte(key))
+		if v == nil {
+			return os.ErrNotExist
+		}
+
+		// The value is only valid in the transaction.
+		value = append([]byte{}, v...)
+		return nil
+	})
+
+	return value, err
+}
+
+func (s *boltStore) Put(key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(BUCKET).Put([]byte(key), value)
+	})
+}
+
+func (s *boltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BUCKET)
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		prefix := []byte(key + "/")
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *boltStore) List(key string) ([]string, error) {
+	prefix := ""
+	if key != "" {
+		prefix = strings.TrimSuffix(key, "/") + "/"
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BUCKET).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			name := string(k[len(prefix):])
+			if i := strings.IndexByte(name, '/'); i >= 0 {
+				name = name[:i]
+			}
+
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		return nil
+	})
+	sort.Strings(names)
+
+	return names, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
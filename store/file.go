@@ -0,0 +1,88 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// NewFileStore creates an IStore keeping each key as a file under dir.
+func NewFileStore(dir string) IStore {
+	return &fileStore{dir: dir}
+}
+
+// TMPEXT defines the extension of the temp file while writing.
+const TMPEXT string = ".tmp"
+
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(key))
+}
+
+func (s *fileStore) Put(key string, value []byte) error {
+	file := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Write a temp file and replace the target by renaming, which is
+	// atomic, so a crash never leaves a partial file.
+	tmp := file + TMPEXT
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(value); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+func (s *fileStore) Delete(key string) error {
+	return os.RemoveAll(s.path(key))
+}
+
+func (s *fileStore) List(key string) ([]string, error) {
+	fs, err := ioutil.ReadDir(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(fs))
+	for _, f := range fs {
+		if filepath.Ext(f.Name()) != TMPEXT {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
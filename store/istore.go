@@ -0,0 +1,28 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package store
+
+// IStore is the interface of the persistent storage for Master states of
+// Jobs, Runners, Commands and Crons. Values are addressed by slash
+// separated keys, like "<job>@<id>/<runner>/.bubble.stat".
+type IStore interface {
+	// Get returns the value of the key, the error satisfies os.IsNotExist
+	// if the key is not exist.
+	Get(key string) ([]byte, error)
+
+	// Put writes the value of the key atomically, so the old value is kept
+	// if it's interrupted.
+	Put(key string, value []byte) error
+
+	// Delete the key and all keys under it.
+	Delete(key string) error
+
+	// List returns the sorted names of the direct children under the key,
+	// and the root if the key is empty.
+	List(key string) ([]string, error)
+
+	// Close the store.
+	Close() error
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Master states are kept in files by default, or in an embedded database
+// which could be set in master.yml:
+//
+// ```yaml
+// store:
+//  type: bolt
+//  path: .bubble.db
+// ```
+
+package store
+
+import (
+	"fmt"
+)
+
+const (
+	// FILE defines the store type of files in the Job folders.
+	FILE string = "file"
+	// BOLT defines the store type of the embedded bolt database.
+	BOLT string = "bolt"
+)
+
+// Open creates the IStore of the type with the folder or the database file.
+func Open(kind string, path string) (IStore, error) {
+	switch kind {
+	case "", FILE:
+		return NewFileStore(path), nil
+	case BOLT:
+		return NewBoltStore(path)
+	}
+
+	return nil, fmt.Errorf("store type [%s] is invalid", kind)
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bolt, err := Open(BOLT, filepath.Join(dir, "bubble.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.Close()
+
+	stores := map[string]IStore{
+		FILE: NewFileStore(filepath.Join(dir, "jobs")),
+		BOLT: bolt,
+	}
+
+	for kind, s := range stores {
+		keys := map[string]string{
+			"a@1/.bubble.yml":     "script a",
+			"a@1/1f/.bubble.stat": "stat",
+			"a@1/2e/.bubble.stat": "stat",
+			"a@b@2/.bubble.yml":   "script a@b",
+			"ab@3/.bubble.yml":    "script ab",
+		}
+		for k, v := range keys {
+			if err := s.Put(k, []byte(v)); err != nil {
+				t.Fatalf("%s Put [%s] expect success, but actual [%s]", kind, k, err)
+			}
+		}
+
+		for k, v := range keys {
+			if bytes, err := s.Get(k); err != nil || string(bytes) != v {
+				t.Errorf("%s Get [%s] expect [%s], but actual [%s] [%v]", kind, k, v, bytes, err)
+			}
+		}
+		if _, err := s.Get("a@1/none"); !os.IsNotExist(err) {
+			t.Errorf("%s Get [a@1/none] expect not exist, but actual [%v]", kind, err)
+		}
+
+		cases := []struct {
+			key   string
+			names []string
+		}{
+			{"", []string{"a@1", "a@b@2", "ab@3"}},
+			{"a@1", []string{".bubble.yml", "1f", "2e"}},
+			{"a@1/", []string{".bubble.yml", "1f", "2e"}},
+			{"a@1/1f", []string{".bubble.stat"}},
+			{"none@4", []string{}},
+		}
+		for _, c := range cases {
+			names, err := s.List(c.key)
+			if err != nil || !reflect.DeepEqual(names, c.names) {
+				t.Errorf("%s List [%s] expect %v, but actual %v [%v]", kind, c.key, c.names, names, err)
+			}
+		}
+
+		// Delete removes the key and all keys under it, but not the keys
+		// only sharing the prefix.
+		if err := s.Delete("a@1/1f"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+		if names, _ := s.List("a@1"); !reflect.DeepEqual(names, []string{".bubble.yml", "2e"}) {
+			t.Errorf("%s List after Delete expect [.bubble.yml 2e], but actual %v", kind, names)
+		}
+		if names, _ := s.List(""); !reflect.DeepEqual(names, []string{"a@1", "a@b@2", "ab@3"}) {
+			t.Errorf("%s List after Delete expect [a@1 a@b@2 ab@3], but actual %v", kind, names)
+		}
+
+		if err := s.Delete("a@1"); err != nil {
+			t.Fatal(err)
+		}
+		if names, _ := s.List(""); !reflect.DeepEqual(names, []string{"a@b@2", "ab@3"}) {
+			t.Errorf("%s List after Delete expect [a@b@2 ab@3], but actual %v", kind, names)
+		}
+		if _, err := s.Get("a@1/2e/.bubble.stat"); !os.IsNotExist(err) {
+			t.Errorf("%s Get deleted key expect not exist, but actual [%v]", kind, err)
+		}
+	}
+}
+
+func TestFileStorePut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewFileStore(dir)
+	key := "a@1/.bubble.yml"
+	if err := s.Put(key, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A temp file left by a crash is not listed, and is replaced.
+	file := filepath.Join(dir, "a@1", ".bubble.yml")
+	if err := ioutil.WriteFile(file+TMPEXT, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := s.List("a@1"); !reflect.DeepEqual(names, []string{".bubble.yml"}) {
+		t.Errorf("List expect [.bubble.yml], but actual %v", names)
+	}
+	if err := s.Put(key, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, _ := s.Get(key); string(bytes) != "new" {
+		t.Errorf("Get expect [new], but actual [%s]", bytes)
+	}
+	if _, err := os.Stat(file + TMPEXT); !os.IsNotExist(err) {
+		t.Errorf("temp file expect removed, but actual [%v]", err)
+	}
+
+	// The old value is kept if the write fails.
+	if err := os.Mkdir(file+TMPEXT, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(key, []byte("failed")); err == nil {
+		t.Errorf("Put expect failure, but actual success")
+	}
+	if bytes, _ := s.Get(key); string(bytes) != "new" {
+		t.Errorf("Get after failed Put expect [new], but actual [%s]", bytes)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NewOTLPExporter creates an exporter to post spans to the OTLP/HTTP
+// endpoint in JSON.
+func NewOTLPExporter(endpoint string) IExporter {
+	return &otlpExporter{endpoint: endpoint, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewFileExporter creates an exporter to append spans to the file, each
+// batch is an OTLP JSON line.
+func NewFileExporter(file string) IExporter {
+	return &fileExporter{file: file}
+}
+
+type otlpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (e *otlpExporter) Export(service string, spans []*Span) error {
+	body, err := json.Marshal(encode(service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP endpoint [%s] responds [%s]", e.endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+func (e *otlpExporter) Close() error {
+	return nil
+}
+
+type fileExporter struct {
+	file   string
+	locker sync.Mutex
+}
+
+func (e *fileExporter) Export(service string, spans []*Span) error {
+	line, err := json.Marshal(encode(service, spans))
+	if err != nil {
+		return err
+	}
+
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	f, err := os.OpenFile(e.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func (e *fileExporter) Close() error {
+	return nil
+}
+
+// --- OTLP JSON ---
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Links        []otlpLink `json:"links,omitempty"`
+	Status       otlpStatus `json:"status"`
+}
+
+type otlpScope struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []*otlpScope `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []*otlpResource `json:"resourceSpans"`
+}
+
+func encode(service string, spans []*Span) *otlpTraces {
+	scope := &otlpScope{Spans: make([]*otlpSpan, 0, len(spans))}
+	scope.Scope.Name = "bubble"
+
+	for _, s := range spans {
+		o := &otlpSpan{
+			TraceID:      s.TraceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentID,
+			Name:         s.Name,
+			Kind:         1,
+			Start:        strconv.FormatInt(s.Start.UnixNano(), 10),
+			End:          strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:       otlpStatus{Code: 1},
+		}
+		for k, v := range s.Attrs {
+			o.Attributes = append(o.Attributes, otlpAttr{Key: k, Value: otlpValue{StringValue: v}})
+		}
+		for _, l := range s.Links {
+			if traceID, spanID, ok := parse(l); ok {
+				o.Links = append(o.Links, otlpLink{TraceID: traceID, SpanID: spanID})
+			}
+		}
+		if s.Error != "" {
+			o.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+
+		scope.Spans = append(scope.Spans, o)
+	}
+
+	resource := &otlpResource{ScopeSpans: []*otlpScope{scope}}
+	resource.Resource.Attributes = []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: service}}}
+
+	return &otlpTraces{ResourceSpans: []*otlpResource{resource}}
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+// IExporter exports the ended spans.
+type IExporter interface {
+	// Export a batch of spans of the service.
+	Export(service string, spans []*Span) error
+
+	// Close the exporter.
+	Close() error
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Start starts a span as the child of parent, which is a W3C traceparent
+// like "00-<trace id>-<span id>-01". A new trace is started if parent is
+// empty or invalid. It returns nil if tracing is not set up, and all Span
+// methods could be called on nil.
+func Start(parent string, name string) *Span {
+	if !enabled() {
+		return nil
+	}
+
+	s := &Span{Name: name, SpanID: newID(8), Start: time.Now(), Attrs: make(map[string]string)}
+	if traceID, spanID, ok := parse(parent); ok {
+		s.TraceID = traceID
+		s.ParentID = spanID
+	} else {
+		s.TraceID = newID(16)
+	}
+
+	return s
+}
+
+// Span presents a timed operation in a trace.
+type Span struct {
+	TraceID  string            `json:"trace"`
+	SpanID   string            `json:"span"`
+	ParentID string            `json:"parent,omitempty"`
+	Name     string            `json:"name"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Links    []string          `json:"links,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	locker sync.Mutex
+	ended  bool
+}
+
+// Child starts a child span.
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return Start(s.Context(), name)
+}
+
+// Context returns the W3C traceparent of the span.
+func (s *Span) Context() string {
+	if s == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// Set an attribute.
+func (s *Span) Set(key string, value interface{}) *Span {
+	if s == nil {
+		return nil
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.Attrs[key] = fmt.Sprint(value)
+	return s
+}
+
+// Link the span to a remote span by its traceparent.
+func (s *Span) Link(context string) {
+	if s == nil {
+		return
+	}
+	if _, _, ok := parse(context); !ok {
+		return
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	for _, l := range s.Links {
+		if l == context {
+			return
+		}
+	}
+	s.Links = append(s.Links, context)
+}
+
+// Fail marks the span failed with err.
+func (s *Span) Fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.Error = err.Error()
+}
+
+// Finish ends the span and queues it to export. It's only done once.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.locker.Lock()
+	if s.ended {
+		s.locker.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.locker.Unlock()
+
+	queue(s)
+}
+
+// --- Inner ---
+
+func newID(size int) string {
+	bytes := make([]byte, size)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// parse returns the trace id and span id of the traceparent.
+func parse(context string) (string, string, bool) {
+	parts := strings.Split(context, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+
+	return parts[1], parts[2], true
+}
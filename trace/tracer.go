@@ -0,0 +1,162 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Tracing is set up by the `trace` section of master.yml or worker.yml,
+// and spans are exported in batch to an OTLP/HTTP collector, or appended
+// to a local file as OTLP JSON lines for offline analysis:
+//
+// ```yaml
+// trace:
+//  exporter: otlp    # otlp or file.
+//  endpoint: http://localhost:4318/v1/traces
+//  file: traces.json
+// ```
+
+package trace
+
+import (
+	"bubble/env"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// CONFIGKEY defines the configure section name of tracing.
+	CONFIGKEY string = "trace"
+	// ENDPOINT defines the default OTLP/HTTP endpoint.
+	ENDPOINT string = "http://localhost:4318/v1/traces"
+	// FILE defines the default file of the file exporter.
+	FILE string = "traces.json"
+	// BATCHSIZE defines the max spans of a batch.
+	BATCHSIZE int = 256
+	// BATCHINTERVAL defines the max interval to export a batch.
+	BATCHINTERVAL time.Duration = 5 * time.Second
+)
+
+var tracer struct {
+	locker   sync.RWMutex
+	service  string
+	exporter IExporter
+	spans    chan *Span
+	done     chan struct{}
+}
+
+// Setup starts tracing of service by configure. Tracing is disabled if
+// conf is nil.
+func Setup(service string, conf env.IAny) error {
+	if conf == nil || conf.IsNil() {
+		return nil
+	}
+	if !conf.IsMap() {
+		return fmt.Errorf("\"%s\" configure should be a map", CONFIGKEY)
+	}
+
+	m := conf.Map()
+	value := func(key string, def string) string {
+		if v, ok := m[key]; ok && v.ToString() != "" {
+			return v.ToString()
+		}
+		return def
+	}
+
+	var exporter IExporter
+	switch name := value("exporter", "otlp"); name {
+	case "otlp":
+		exporter = NewOTLPExporter(value("endpoint", ENDPOINT))
+	case "file":
+		exporter = NewFileExporter(value("file", FILE))
+	default:
+		return fmt.Errorf("trace exporter [%s] should be otlp or file", name)
+	}
+
+	Close()
+
+	tracer.locker.Lock()
+	defer tracer.locker.Unlock()
+
+	tracer.service = service
+	tracer.exporter = exporter
+	tracer.spans = make(chan *Span, BATCHSIZE*4)
+	tracer.done = make(chan struct{})
+	go loop(service, exporter, tracer.spans, tracer.done)
+
+	return nil
+}
+
+// Close exports the queued spans and stops tracing.
+func Close() {
+	tracer.locker.Lock()
+	spans, done := tracer.spans, tracer.done
+	tracer.exporter = nil
+	tracer.spans = nil
+	tracer.done = nil
+	tracer.locker.Unlock()
+
+	if spans != nil {
+		close(spans)
+		<-done
+	}
+}
+
+// --- Inner ---
+
+func enabled() bool {
+	tracer.locker.RLock()
+	defer tracer.locker.RUnlock()
+
+	return tracer.exporter != nil
+}
+
+// queue adds the ended span to the batch, and drops it if the queue is full.
+func queue(s *Span) {
+	tracer.locker.RLock()
+	defer tracer.locker.RUnlock()
+
+	if tracer.spans == nil {
+		return
+	}
+
+	select {
+	case tracer.spans <- s:
+	default:
+		log.Warnf("Trace queue is full, span [%s] is dropped.", s.Name)
+	}
+}
+
+func loop(service string, exporter IExporter, spans chan *Span, done chan struct{}) {
+	defer close(done)
+	defer exporter.Close()
+
+	ticker := time.NewTicker(BATCHINTERVAL)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, BATCHSIZE)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := exporter.Export(service, batch); err != nil {
+			log.Errorf("Export [%d] spans failed: %s", len(batch), err.Error())
+		}
+		batch = make([]*Span, 0, BATCHSIZE)
+	}
+
+	for {
+		select {
+		case s, ok := <-spans:
+			if !ok {
+				flush()
+				return
+			}
+			if batch = append(batch, s); len(batch) >= BATCHSIZE {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
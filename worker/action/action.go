@@ -6,10 +6,12 @@ package action
 
 import (
 	"bubble/env"
+	"bufio"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	log "github.com/cihub/seelog"
 )
@@ -21,11 +23,10 @@ type Action struct {
 }
 
 // Init is used for initializing the Action.
-func (a *Action) Init(uid uint64, env env.IEnv) {
+func (a *Action) Init(uid uint64, e env.IEnv) {
 	a.error = nil
 
-	ext, _ := os.Executable()
-	a.cwd = path.Join(filepath.Dir(ext), "jobs", strconv.FormatUint(uid, 16))
+	a.cwd = path.Join(Root(), strconv.FormatUint(uid, 16))
 	_, err := os.Stat(a.cwd)
 	if err != nil && os.IsNotExist(err) {
 		log.Debugf("Try to create dir: [%s].", a.cwd)
@@ -35,7 +36,13 @@ func (a *Action) Init(uid uint64, env env.IEnv) {
 		}
 	}
 
-	env.SetFunc("_SIZEOF", a.SizeOf)
+	env.SetFileFuncs(e, a.cwd)
+	env.SetOSFuncs(e)
+
+	// Inject the output file path, so script could publish values by
+	// writing "name=value" lines into it.
+	os.Remove(a.OutputPath())
+	e.Set(OUTPUTVAR, env.NewAny(a.OutputPath()))
 }
 
 // Cwd returns the current working directory.
@@ -43,6 +50,11 @@ func (a *Action) Cwd() string {
 	return a.cwd
 }
 
+// OutputPath returns the file path where the Action publishes output values.
+func (a *Action) OutputPath() string {
+	return path.Join(a.cwd, OUTPUTFILE)
+}
+
 // Cancel the Action execution.
 func (a *Action) Cancel() error {
 	return nil
@@ -56,44 +68,53 @@ func (a *Action) Error() string {
 	return a.error.Error()
 }
 
-// SizeOf calculate the target file size.
-func (a *Action) SizeOf(args ...env.IAny) (env.IAny, error) {
-	if len(args) == 0 {
-		return env.NewAny(0), nil
-	}
-
-	file := args[0].ToString()
-	log.Infof("Sizeof file [%s]\n", file)
-	return env.NewAny(a.calcSize(file)), nil
-}
-
-func (a *Action) calcSize(p string) int64 {
-	filePath := path.Join(a.Cwd(), p)
-	f, err := os.Open(filePath)
+// loadOutputs reads all "name=value" lines in the output file into env.
+func (a *Action) loadOutputs(e env.IEnv) error {
+	f, err := os.Open(a.OutputPath())
 	if err != nil {
-		return 0
-	}
-	defer f.Close()
+		if os.IsNotExist(err) {
+			return nil
+		}
 
-	stat, err := f.Stat()
-	if err != nil && os.IsNotExist(err) {
-		// File or directory isn't exist.
-		return 0
+		return err
 	}
+	defer f.Close()
 
-	if stat.IsDir() {
-		fs, err := f.Readdir(-1)
-		if err != nil {
-			return 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, '=')
+		if line == "" || strings.HasPrefix(line, "#") || i <= 0 {
+			continue
 		}
 
-		var total int64
-		for _, i := range fs {
-			total += a.calcSize(p + "/" + i.Name())
-		}
+		e.Set(strings.TrimSpace(line[:i]), env.NewAny(strings.TrimSpace(line[i+1:])))
+	}
+
+	return scanner.Err()
+}
 
-		return total
+// Root returns the folder holding working directories of all Actions,
+// it's the "jobs" folder beside the executable by default.
+func Root() string {
+	if root != "" {
+		return root
 	}
 
-	return stat.Size()
+	ext, _ := os.Executable()
+	return path.Join(filepath.Dir(ext), "jobs")
+}
+
+// SetRoot changes the folder holding working directories of all Actions.
+func SetRoot(dir string) {
+	root = dir
 }
+
+var root string
+
+const (
+	// OUTPUTVAR defines the variable name of output file path.
+	OUTPUTVAR string = "_OUTPUT"
+	// OUTPUTFILE defines the output file name in working directory.
+	OUTPUTFILE string = ".bubble.output"
+)
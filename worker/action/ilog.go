@@ -21,4 +21,9 @@ type ILog interface {
 	Critical(v ...interface{})
 	Criticalf(format string, params ...interface{})
 	Std() io.Writer
+	Err() io.Writer
+	// Begin starts a collapsible section with title.
+	Begin(title string)
+	// End ends the current section with the exit code.
+	End(exit int)
 }
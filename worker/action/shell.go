@@ -11,12 +11,28 @@
 //   - mkdir ...
 //   - echo ...
 // ```
+//
+// Values could be published by writing "name=value" lines into the file
+// of `$_OUTPUT` (also `BUBBLE_OUTPUT` in process env), and declared with
+// `outputs` to be visible as `$alias.name` in following commands.
+//
+// ```yaml
+// -
+//  action: shell
+//  alias: build
+//  outputs:
+//   - version
+//  script:
+//   - echo version=1.0.0 >> $_OUTPUT
+// ```
 
 package action
 
 import (
 	"bubble/env"
 	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 )
 
@@ -51,25 +67,44 @@ func (s *shell) Execute(script env.IAny, target string, env env.IEnv, log ILog)
 		arr := script.Array()
 		for _, code := range arr {
 			v := env.Format(code)
-			log.Debugf("-- Shell [%s]\n", v)
+			log.Begin(fmt.Sprintf("Shell [%s]", v))
 
 			s.cmd = exec.Command("sh", "-c", v)
 			s.cmd.Dir = s.Cwd()
+			s.cmd.Env = append(os.Environ(), "BUBBLE_OUTPUT="+s.OutputPath())
 			s.cmd.Stdout = log.Std()
-			s.cmd.Stderr = log.Std()
+			s.cmd.Stderr = log.Err()
 			err := s.cmd.Run()
+			log.End(exitCode(err))
 			if err != nil {
 				s.error = err
 				break
 			}
 		}
 
+		if err := s.loadOutputs(env); err != nil {
+			log.Errorf("Load outputs failed: %s\n", err.Error())
+		}
+
 		success <- (s.error == nil)
 	}
 
 	return success
 }
 
+// exitCode returns the process exit code of err, or -1 if it's not started.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if e, ok := err.(*exec.ExitError); ok {
+		return e.ExitCode()
+	}
+
+	return -1
+}
+
 func (s *shell) Cancel() error {
 	if s.cmd != nil {
 		return s.cmd.Process.Kill()
@@ -117,7 +117,7 @@ func (s *unity) Execute(script env.IAny, target string, env env.IEnv, log ILog)
 		s.cmd = exec.Command(u.String(), args...)
 		s.cmd.Dir = s.Cwd()
 		s.cmd.Stdout = log.Std()
-		s.cmd.Stderr = log.Std()
+		s.cmd.Stderr = log.Err()
 		err := s.cmd.Run()
 		if err != nil {
 			s.error = err
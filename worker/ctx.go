@@ -9,8 +9,8 @@ import (
 )
 
 // NewCtx method create a new ICtx by parameters.
-func NewCtx(master, uid uint64, script, variables env.IAny, target string, env env.IEnv) ICtx {
-	return &ctx{master: master, uid: uid, script: script, variables: variables, target: target, env: env}
+func NewCtx(master, uid uint64, script, variables env.IAny, target string, env env.IEnv, secrets map[string]string, span string) ICtx {
+	return &ctx{master: master, uid: uid, script: script, variables: variables, target: target, env: env, secrets: secrets, span: span}
 }
 
 type ctx struct {
@@ -20,6 +20,8 @@ type ctx struct {
 	variables env.IAny
 	target    string
 	env       env.IEnv
+	secrets   map[string]string
+	span      string
 }
 
 func (c *ctx) Master() uint64 {
@@ -45,3 +47,11 @@ func (c *ctx) Target() string {
 func (c *ctx) Env() env.IEnv {
 	return c.env
 }
+
+func (c *ctx) Secrets() map[string]string {
+	return c.secrets
+}
+
+func (c *ctx) Span() string {
+	return c.span
+}
@@ -6,13 +6,16 @@ package worker
 
 import (
 	zipper "archive/zip"
+	"bubble/trace"
 	"bubble/util"
+	"fmt"
 	log "github.com/cihub/seelog"
 	"github.com/giant-tech/go-service/framework/iserver"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"sync/atomic"
 )
 
 // NewExecutor create a new IExecutor with parameters.
@@ -29,15 +32,18 @@ type executor struct {
 	chunks   []int64
 	runner   IRunner
 	ctx      ICtx
+	span     *trace.Span
 }
 
 func (e *executor) Execute() {
-	e.worker.Progress(e.runner.Name(), e.ctx.Master(), e.ctx.UID(), []byte(""))
+	e.worker.Progress(e.runner.Name(), e.ctx.Master(), e.ctx.UID(), []byte(""), "")
 
 	if e.disk == "" {
 		e.runner.Execute(e.ctx)
 	} else {
-		e.proxy.AsyncCall("BeforeSend", e.worker.UID(), e.uid, e.disk)
+		e.span = trace.Start(e.ctx.Span(), "transfer")
+		e.span.Set("disk", e.disk)
+		e.proxy.AsyncCall("BeforeSend", e.worker.UID(), e.uid, e.disk, e.span.Context())
 	}
 }
 
@@ -79,6 +85,7 @@ func (e *executor) Receive(index int64, data []byte) {
 	}
 
 	e.chunks[index] = int64(size)
+	atomic.AddInt64(&transferred.received, int64(size))
 }
 
 func (e *executor) AfterReceive() {
@@ -101,6 +108,8 @@ func (e *executor) AfterReceive() {
 	checksum := util.CalcFileChecksum(e.workFilePath())
 	if checksum != e.checksum {
 		// TODO: handle error.
+		e.span.Fail(fmt.Errorf("checksum [%s] is not equal to [%s]", checksum, e.checksum))
+		e.span.Finish()
 		return
 	}
 
@@ -141,6 +150,7 @@ func (e *executor) AfterReceive() {
 
 	// Clean the temp folder.
 	e.Clean()
+	e.span.Set("bytes", e.length).Finish()
 
 	log.Debug("Start to execute command.\n")
 	e.runner.Execute(e.ctx)
@@ -27,4 +27,10 @@ type ICtx interface {
 
 	// Env return Job running env.
 	Env() env.IEnv
+
+	// Secrets return the secrets referenced by the Job command.
+	Secrets() map[string]string
+
+	// Span returns the traceparent of the command span on Master.
+	Span() string
 }
@@ -27,4 +27,7 @@ type IRunner interface {
 
 	// Workload returns the Runner workload.
 	Workload() int
+
+	// Procs returns the uid of running Actions.
+	Procs() []uint64
 }
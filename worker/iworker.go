@@ -15,10 +15,10 @@ type IWorker interface {
 	UID() uint64
 
 	// Finish action to Master.
-	Finish(action string, master, uid uint64, success bool, env env.IEnv)
+	Finish(action string, master, uid uint64, success bool, env env.IEnv, span string)
 
 	// Progress action info to Master.
-	Progress(action string, master, uid uint64, payload []byte)
+	Progress(action string, master, uid uint64, payload []byte, span string)
 
 	// Broadcast data to all connected Masters.
 	Broadcast(t def.TYPE, payload []byte)
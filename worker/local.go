@@ -0,0 +1,154 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"bubble/env"
+	"bubble/worker/action"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// ExecuteLocal executes the Action in-process without Master, in the
+// working directory of uid, and prints the logs to out and errOut.
+func ExecuteLocal(name string, uid uint64, script env.IAny, variables env.IAny, target string, e env.IEnv, out io.Writer, errOut io.Writer) (bool, error) {
+	factory := create(name)
+	if factory == nil {
+		return false, fmt.Errorf("there is no Action [%s]", name)
+	}
+
+	a := factory.Create()
+	a.Init(uid, e)
+
+	// Initialize variables for Action scope.
+	if variables != nil && !variables.IsNil() {
+		for k, v := range variables.Map() {
+			e.Set(k, env.NewAny(e.Format(v)))
+		}
+	}
+
+	success := <-a.Execute(script, target, e, &console{out: out, err: errOut})
+	if !success && a.Error() != "" {
+		return false, fmt.Errorf("action [%s] failed: %s", name, a.Error())
+	}
+
+	return success, nil
+}
+
+// TransferLocal copies the disk path from the working directory of uid
+// from to the one of uid to, like streaming disk between Workers.
+func TransferLocal(from uint64, to uint64, disk string) error {
+	src := path.Join(action.Root(), strconv.FormatUint(from, 16))
+	dst := path.Join(action.Root(), strconv.FormatUint(to, 16))
+
+	return filepath.Walk(path.Join(src, disk), func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		if err = os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+
+		in, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		o, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+
+		_, err = io.Copy(o, in)
+		return err
+	})
+}
+
+// console prints the Action logs to the terminal.
+type console struct {
+	out io.Writer
+	err io.Writer
+}
+
+func (c *console) Info(v ...interface{}) {
+	c.print(c.out, fmt.Sprint(v...))
+}
+
+func (c *console) Infof(format string, params ...interface{}) {
+	c.print(c.out, fmt.Sprintf(format, params...))
+}
+
+func (c *console) Debug(v ...interface{}) {
+	c.print(c.out, fmt.Sprint(v...))
+}
+
+func (c *console) Debugf(format string, params ...interface{}) {
+	c.print(c.out, fmt.Sprintf(format, params...))
+}
+
+func (c *console) Warn(v ...interface{}) {
+	c.print(c.err, fmt.Sprint(v...))
+}
+
+func (c *console) Warnf(format string, params ...interface{}) {
+	c.print(c.err, fmt.Sprintf(format, params...))
+}
+
+func (c *console) Error(v ...interface{}) {
+	c.print(c.err, fmt.Sprint(v...))
+}
+
+func (c *console) Errorf(format string, params ...interface{}) {
+	c.print(c.err, fmt.Sprintf(format, params...))
+}
+
+func (c *console) Critical(v ...interface{}) {
+	c.print(c.err, fmt.Sprint(v...))
+}
+
+func (c *console) Criticalf(format string, params ...interface{}) {
+	c.print(c.err, fmt.Sprintf(format, params...))
+}
+
+func (c *console) Std() io.Writer {
+	return c.out
+}
+
+func (c *console) Err() io.Writer {
+	return c.err
+}
+
+func (c *console) Begin(title string) {
+	fmt.Fprintf(c.out, "-- %s\n", title)
+}
+
+func (c *console) End(exit int) {
+	if exit != 0 {
+		fmt.Fprintf(c.err, "-- Exit with code [%d].\n", exit)
+	}
+}
+
+func (c *console) print(w io.Writer, msg string) {
+	if len(msg) == 0 || msg[len(msg)-1] != '\n' {
+		msg += "\n"
+	}
+	fmt.Fprint(w, msg)
+}
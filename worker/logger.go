@@ -5,79 +5,246 @@
 package worker
 
 import (
+	"bubble/def"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/cihub/seelog"
 )
 
+const (
+	// SECRETPREFIX defines the variable namespace of secrets.
+	SECRETPREFIX string = "secret."
+	// SECRETMASK defines the text to replace secret values in logs.
+	SECRETMASK string = "******"
+	// LINEBUFFER defines the max length of a partial line kept in stream.
+	LINEBUFFER int = 4 * 1024
+)
+
+func newLogger(runner *runner, ctx ICtx, span string) *logger {
+	l := &logger{runner: runner, ctx: ctx, span: span}
+	l.stdout = &stream{logger: l, name: def.STDOUT}
+	l.stderr = &stream{logger: l, name: def.STDERR}
+	values := make([]string, 0)
+	for _, v := range ctx.Secrets() {
+		values = append(values, v)
+	}
+	l.masks = def.Masks(values...)
+
+	return l
+}
+
 type logger struct {
-	runner *runner
-	ctx    ICtx
+	runner  *runner
+	ctx     ICtx
+	span    string
+	masks   []string
+	stdout  *stream
+	stderr  *stream
+	locker  sync.Mutex
+	section int
+	count   int
+	begin   time.Time
 }
 
 func (l *logger) Info(v ...interface{}) {
-	log.Info(v...)
-	l.Notify([]byte(fmt.Sprint(v...)))
+	msg := l.mask(fmt.Sprint(v...))
+	log.Info(msg)
+	l.Notify(l.record(def.INFO, "", msg))
 }
 
 func (l *logger) Infof(format string, params ...interface{}) {
-	log.Infof(format, params...)
-	l.Notify([]byte(fmt.Sprintf(format, params...)))
+	msg := l.mask(fmt.Sprintf(format, params...))
+	log.Info(msg)
+	l.Notify(l.record(def.INFO, "", msg))
 }
 
 func (l *logger) Debug(v ...interface{}) {
-	log.Debug(v...)
-	l.Notify([]byte(fmt.Sprint(v...)))
+	msg := l.mask(fmt.Sprint(v...))
+	log.Debug(msg)
+	l.Notify(l.record(def.DEBUG, "", msg))
 }
 
 func (l *logger) Debugf(format string, params ...interface{}) {
-	log.Debugf(format, params...)
-	l.Notify([]byte(fmt.Sprintf(format, params...)))
+	msg := l.mask(fmt.Sprintf(format, params...))
+	log.Debug(msg)
+	l.Notify(l.record(def.DEBUG, "", msg))
 }
 
 func (l *logger) Warn(v ...interface{}) {
-	log.Warn(v...)
-	l.Notify([]byte(fmt.Sprint(v...)))
+	msg := l.mask(fmt.Sprint(v...))
+	log.Warn(msg)
+	l.Notify(l.record(def.WARN, "", msg))
 }
 
 func (l *logger) Warnf(format string, params ...interface{}) {
-	log.Warnf(format, params...)
-	l.Notify([]byte(fmt.Sprintf(format, params...)))
+	msg := l.mask(fmt.Sprintf(format, params...))
+	log.Warn(msg)
+	l.Notify(l.record(def.WARN, "", msg))
 }
 
 func (l *logger) Error(v ...interface{}) {
-	log.Error(v...)
-	l.Notify([]byte(fmt.Sprint(v...)))
+	msg := l.mask(fmt.Sprint(v...))
+	log.Error(msg)
+	l.Notify(l.record(def.ERROR, "", msg))
 }
 
 func (l *logger) Errorf(format string, params ...interface{}) {
-	log.Errorf(format, params...)
-	l.Notify([]byte(fmt.Sprintf(format, params...)))
+	msg := l.mask(fmt.Sprintf(format, params...))
+	log.Error(msg)
+	l.Notify(l.record(def.ERROR, "", msg))
 }
 
 func (l *logger) Critical(v ...interface{}) {
-	log.Critical(v...)
-	l.Notify([]byte(fmt.Sprint(v...)))
+	msg := l.mask(fmt.Sprint(v...))
+	log.Critical(msg)
+	l.Notify(l.record(def.CRITICAL, "", msg))
 }
 
 func (l *logger) Criticalf(format string, params ...interface{}) {
-	log.Criticalf(format, params...)
-	l.Notify([]byte(fmt.Sprintf(format, params...)))
+	msg := l.mask(fmt.Sprintf(format, params...))
+	log.Critical(msg)
+	l.Notify(l.record(def.CRITICAL, "", msg))
 }
 
 func (l *logger) Std() io.Writer {
-	return l
+	return l.stdout
 }
 
-func (l *logger) Write(bytes []byte) (int, error) {
-	fmt.Print(string(bytes))
-	l.Notify(bytes)
-	return len(bytes), nil
+func (l *logger) Err() io.Writer {
+	return l.stderr
+}
+
+func (l *logger) Begin(title string) {
+	l.flush()
+
+	title = l.mask(title)
+	log.Infof("-- %s", title)
+
+	l.locker.Lock()
+	l.count++
+	l.section = l.count
+	l.begin = time.Now()
+	l.locker.Unlock()
+
+	r := l.record(def.INFO, "", fmt.Sprintf("-- %s\n", title))
+	r.Kind = def.BEGIN
+	r.Title = title
+	l.Notify(r)
+}
+
+func (l *logger) End(exit int) {
+	l.flush()
+
+	l.locker.Lock()
+	section := l.section
+	duration := time.Since(l.begin)
+	l.section = 0
+	l.locker.Unlock()
+
+	if section == 0 {
+		return
+	}
+
+	r := &def.Record{Kind: def.END, Time: stamp(time.Now()), Level: def.INFO, Section: section}
+	r.Exit = exit
+	r.Duration = int64(duration / time.Millisecond)
+	if exit != 0 {
+		r.Level = def.ERROR
+		r.Text = fmt.Sprintf("-- Exit with code [%d].\n", exit)
+	}
+	l.Notify(r)
 }
 
 // --- Inner ---
 
-func (l *logger) Notify(bytes []byte) {
-	l.runner.worker.Progress(l.runner.name, l.ctx.Master(), l.ctx.UID(), bytes)
+func (l *logger) Notify(records ...*def.Record) {
+	data, err := json.Marshal(records)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	l.runner.worker.Progress(l.runner.name, l.ctx.Master(), l.ctx.UID(), data, l.span)
+}
+
+// record creates a log record in the current section.
+func (l *logger) record(level def.LEVEL, stream string, text string) *def.Record {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	return &def.Record{Kind: def.LINE, Time: stamp(time.Now()), Level: level, Stream: stream, Section: l.section, Text: text}
+}
+
+// flush sends the partial lines kept in streams.
+func (l *logger) flush() {
+	l.stdout.flush()
+	l.stderr.flush()
+}
+
+// mask replaces all secret values in msg.
+func (l *logger) mask(msg string) string {
+	for _, m := range l.masks {
+		msg = strings.Replace(msg, m, SECRETMASK, -1)
+	}
+
+	return msg
+}
+
+func stamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// stream splits the process output into line records.
+type stream struct {
+	logger *logger
+	name   string
+	locker sync.Mutex
+	buf    []byte
+}
+
+func (s *stream) Write(data []byte) (int, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.buf = append(s.buf, data...)
+	end := bytes.LastIndexByte(s.buf, '\n') + 1
+	if end == 0 && len(s.buf) >= LINEBUFFER {
+		end = len(s.buf)
+	}
+	if end > 0 {
+		s.send(string(s.buf[:end]))
+		s.buf = s.buf[end:]
+	}
+
+	return len(data), nil
+}
+
+func (s *stream) flush() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if len(s.buf) > 0 {
+		s.send(string(s.buf))
+		s.buf = nil
+	}
+}
+
+func (s *stream) send(text string) {
+	text = s.logger.mask(text)
+	fmt.Print(text)
+
+	lines := strings.SplitAfter(text, "\n")
+	records := make([]*def.Record, 0, len(lines))
+	for _, line := range lines {
+		if line != "" {
+			records = append(records, s.logger.record(def.INFO, s.name, line))
+		}
+	}
+	s.logger.Notify(records...)
 }
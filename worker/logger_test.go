@@ -0,0 +1,67 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"bubble/def"
+	"bubble/env"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// progress collects the log records notified to Master.
+type progress struct {
+	records []*def.Record
+}
+
+func (p *progress) UID() uint64 { return 1 }
+
+func (p *progress) Finish(action string, master, uid uint64, success bool, env env.IEnv, span string) {
+}
+
+func (p *progress) Progress(action string, master, uid uint64, payload []byte, span string) {
+	records := make([]*def.Record, 0)
+	json.Unmarshal(payload, &records)
+	p.records = append(p.records, records...)
+}
+
+func (p *progress) Broadcast(t def.TYPE, payload []byte) {}
+
+func TestLoggerMask(t *testing.T) {
+	key := "-----BEGIN KEY-----\nMIIEvQIBADANBgkqhkiG9w0BAQEFAASC\n-----END KEY-----"
+	cases := []struct {
+		name   string
+		writes []string
+	}{
+		{"whole", []string{"key: " + key + "\n"}},
+		{"split writes", []string{"token: abc", "def123\n"}},
+		{"split lines", []string{"-----BEGIN KEY-----\n", "MIIEvQIBADANBgkqhkiG9w0BAQEFAASC\n", "-----END KEY-----\n"}},
+		{"split writes and lines", []string{"-----BEGIN KEY-----\nMIIEvQIBADA", "NBgkqhkiG9w0BAQEFAASC\n-----E", "ND KEY-----\n"}},
+	}
+
+	for _, c := range cases {
+		p := &progress{}
+		secrets := map[string]string{"KEY": key, "TOKEN": "abcdef123"}
+		l := newLogger(NewRunner("shell", p).(*runner), NewCtx(1, 1, nil, nil, "", env.NewEnv(), secrets, ""), "")
+		for _, w := range c.writes {
+			l.stdout.Write([]byte(w))
+		}
+		l.flush()
+
+		var text string
+		for _, r := range p.records {
+			text += r.Text
+		}
+		for _, leak := range []string{"abcdef123", "MIIEvQIBADANBgkqhkiG9w0BAQEFAASC", "BEGIN KEY"} {
+			if strings.Contains(text, leak) {
+				t.Errorf("Case [%s] leaks [%s] in %q", c.name, leak, text)
+			}
+		}
+		if !strings.Contains(text, SECRETMASK) {
+			t.Errorf("Case [%s] isn't masked: %q", c.name, text)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"bubble/def"
+	"bubble/worker/action"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// METRICSINTERVAL defines the interval to report metrics to Masters.
+	METRICSINTERVAL time.Duration = 30 * time.Second
+)
+
+// transferred counts the bytes of disk transfer.
+var transferred struct {
+	sent     int64
+	received int64
+}
+
+// report broadcasts the metrics to all Masters if the interval is passed.
+// Walking the jobs folder could be slow, so it's done in background.
+func (w *Worker) report() {
+	if time.Since(w.reported) < METRICSINTERVAL || !atomic.CompareAndSwapInt32(&w.reporting, 0, 1) {
+		return
+	}
+	w.reported = time.Now()
+
+	go func() {
+		defer atomic.StoreInt32(&w.reporting, 0)
+
+		m := &def.Metrics{
+			Actions:  make(map[string]int),
+			Disk:     dirSize(action.Root()),
+			Sent:     atomic.LoadInt64(&transferred.sent),
+			Received: atomic.LoadInt64(&transferred.received),
+		}
+		for k, r := range w.runners {
+			m.Actions[k] = r.Workload()
+		}
+
+		payload, err := json.Marshal(m)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		w.Broadcast(def.METRICS, payload)
+	}()
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// PENDINGLIMIT defines the max count of notifications buffered while
+	// Master is disconnected.
+	PENDINGLIMIT int = 10000
+)
+
+// call is a notification to Master, which is buffered while the Master is
+// disconnected and replayed after it reconnects.
+type call struct {
+	master uint64
+	method string
+	action string
+	uid    uint64
+	args   []interface{}
+}
+
+// notify sends the call to Master, or buffers it if the Master is not
+// connected. Buffered calls are sent first to keep the order.
+func (w *Worker) notify(c *call) {
+	w.pendingLocker.Lock()
+	defer w.pendingLocker.Unlock()
+
+	if len(w.pending) >= PENDINGLIMIT {
+		log.Warnf("Worker drops notification [%s] of Instance [%d] since too many are pending.", w.pending[0].method, w.pending[0].uid)
+		w.pending = w.pending[1:]
+	}
+	w.pending = append(w.pending, c)
+	w.flush()
+}
+
+// replay sends the buffered calls after a Master reconnects.
+func (w *Worker) replay() {
+	w.pendingLocker.Lock()
+	defer w.pendingLocker.Unlock()
+
+	w.flush()
+}
+
+// flush sends all buffered calls which Master is connected, the lock must
+// be held. Once a call of a Master fails, the later calls of the Master
+// are kept too, so they're replayed in order.
+func (w *Worker) flush() {
+	blocked := make(map[uint64]bool)
+	rest := w.pending[:0]
+	for _, c := range w.pending {
+		if !blocked[c.master] {
+			proxy, ok := w.master(c.master)
+			if ok && proxy.AsyncCall(c.method, c.args...) == nil {
+				continue
+			}
+			blocked[c.master] = true
+		}
+
+		rest = append(rest, c)
+	}
+
+	if len(rest) > 0 {
+		log.Debugf("Worker has [%d] notifications pending for Master.", len(rest))
+	}
+	w.pending = rest
+}
+
+// running returns the uid of running or finished but not notified Actions,
+// whose results are still owed to Master.
+func (w *Worker) running() map[string][]uint64 {
+	procs := make(map[string][]uint64)
+	for k, r := range w.runners {
+		if uids := r.Procs(); len(uids) > 0 {
+			procs[k] = uids
+		}
+	}
+
+	w.pendingLocker.Lock()
+	defer w.pendingLocker.Unlock()
+
+	for _, c := range w.pending {
+		if c.method == "OnFinish" {
+			procs[c.action] = append(procs[c.action], c.uid)
+		}
+	}
+
+	return procs
+}
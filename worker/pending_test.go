@@ -0,0 +1,114 @@
+// Copyright 2019 Bubble. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/giant-tech/go-service/framework/iserver"
+)
+
+// proxy records the calls to a Master, and fails the first few calls.
+type proxy struct {
+	iserver.IServiceProxy
+	id    uint64
+	fails int
+	calls *[]string
+}
+
+func (p *proxy) AsyncCall(name string, args ...interface{}) error {
+	if p.fails > 0 {
+		p.fails--
+		return errors.New("connection is broken")
+	}
+
+	*p.calls = append(*p.calls, fmt.Sprintf("%d:%s:%d", p.id, name, args[0]))
+	return nil
+}
+
+func TestPendingReplay(t *testing.T) {
+	calls := make([]string, 0)
+	w := &Worker{masters: make(map[uint64]iserver.IServiceProxy)}
+	send := func(master uint64, method string, uid uint64) {
+		w.notify(&call{master: master, method: method, action: "shell", uid: uid, args: []interface{}{uid}})
+	}
+	connect := func(id uint64, fails int) {
+		p := &proxy{id: id, fails: fails, calls: &calls}
+		w.mastersLocker.Lock()
+		w.masters[id] = p
+		w.mastersLocker.Unlock()
+	}
+	check := func(step string, expected []string, pending int) {
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Step [%s] expect calls %v, but actual %v", step, expected, calls)
+		}
+		if len(w.pending) != pending {
+			t.Errorf("Step [%s] expect [%d] pending, but actual [%d]", step, pending, len(w.pending))
+		}
+		calls = calls[:0]
+	}
+
+	// Calls are buffered while Masters are disconnected.
+	send(1, "OnProgress", 1)
+	send(2, "OnProgress", 2)
+	send(1, "OnFinish", 1)
+	check("disconnected", []string{}, 3)
+
+	// Only the calls of the reconnected Master are replayed in order.
+	connect(1, 0)
+	w.replay()
+	check("reconnected", []string{"1:OnProgress:1", "1:OnFinish:1"}, 1)
+
+	// New calls are sent directly.
+	send(1, "OnProgress", 3)
+	check("connected", []string{"1:OnProgress:3"}, 1)
+
+	// Calls after a failed one are kept in order.
+	connect(2, 1)
+	send(2, "OnFinish", 2)
+	check("broken", []string{}, 2)
+
+	w.replay()
+	check("recovered", []string{"2:OnProgress:2", "2:OnFinish:2"}, 0)
+
+	// All calls are sent to the leader.
+	delete(w.masters, 2)
+	w.leader = 1
+	send(2, "OnFinish", 4)
+	check("leader", []string{"1:OnFinish:4"}, 0)
+}
+
+func TestPendingLimit(t *testing.T) {
+	w := &Worker{masters: make(map[uint64]iserver.IServiceProxy)}
+	for i := 0; i < PENDINGLIMIT+2; i++ {
+		w.notify(&call{master: 1, method: "OnFinish", action: "shell", uid: uint64(i)})
+	}
+
+	// The oldest calls are dropped.
+	if len(w.pending) != PENDINGLIMIT || w.pending[0].uid != 2 {
+		t.Errorf("pending expect [%d] from [2], but actual [%d] from [%d]", PENDINGLIMIT, len(w.pending), w.pending[0].uid)
+	}
+}
+
+func TestPendingRunning(t *testing.T) {
+	w := &Worker{masters: make(map[uint64]iserver.IServiceProxy)}
+	w.notify(&call{master: 1, method: "OnProgress", action: "shell", uid: 1})
+	w.notify(&call{master: 1, method: "OnFinish", action: "shell", uid: 1})
+	w.notify(&call{master: 1, method: "OnFinish", action: "unity", uid: 2})
+	w.notify(&call{master: 1, method: "OnFinish", action: "shell", uid: 3})
+
+	procs := w.running()
+	for _, uids := range procs {
+		sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	}
+	expected := map[string][]uint64{"shell": {1, 3}, "unity": {2}}
+	if !reflect.DeepEqual(procs, expected) {
+		t.Errorf("running expect %v, but actual %v", expected, procs)
+	}
+}
@@ -6,6 +6,7 @@ package worker
 
 import (
 	zipper "archive/zip"
+	"bubble/trace"
 	"bubble/util"
 	log "github.com/cihub/seelog"
 	"github.com/giant-tech/go-service/framework/iserver"
@@ -13,15 +14,17 @@ import (
 	"math"
 	"os"
 	"path"
+	"sync/atomic"
 )
 
 // NewProvider method create a new ITransfer by uid and disk.
-func NewProvider(proxy iserver.IServiceProxy, uid uint64, disk string) IProvider {
-	return &provider{share: share{proxy: proxy, uid: uid, disk: disk}}
+func NewProvider(proxy iserver.IServiceProxy, uid uint64, disk string, span string) IProvider {
+	return &provider{share: share{proxy: proxy, uid: uid, disk: disk}, span: trace.Start(span, "provide")}
 }
 
 type provider struct {
 	share
+	span *trace.Span
 }
 
 func (p *provider) BeforeSend() {
@@ -42,12 +45,16 @@ func (p *provider) BeforeSend() {
 	err = p.compress(target)
 	if err != nil {
 		log.Errorf("Compress to [%s] failed.", p.workFilePath())
+		p.span.Fail(err)
+		p.span.Finish()
 		return
 	}
 
 	stat, err := os.Stat(target)
 	if err != nil && os.IsNotExist(err) {
 		log.Errorf("File [%s] isn't exist.", p.workFilePath())
+		p.span.Fail(err)
+		p.span.Finish()
 		return
 	}
 
@@ -65,6 +72,8 @@ func (p *provider) Send() {
 	f, err := os.Open(p.workFilePath())
 	if err != nil {
 		log.Errorf("File [%s] isn't exist.", p.workFilePath())
+		p.span.Fail(err)
+		p.span.Finish()
 		return
 	}
 
@@ -76,6 +85,7 @@ func (p *provider) Send() {
 		size, _ := f.ReadAt(data, CHUNKSIZE*int64(i))
 		log.Debugf("Trigger Receive: uid [%d], index [%d], and data length [%d].\n", p.uid, i, size)
 		p.proxy.AsyncCall("Receive", p.uid, int64(i), data[0:size])
+		atomic.AddInt64(&transferred.sent, int64(size))
 	}
 	f.Close()
 
@@ -84,6 +94,7 @@ func (p *provider) Send() {
 
 	// Clean the temp folder.
 	p.Clean()
+	p.span.Set("bytes", fileLength).Finish()
 }
 
 func (p *provider) compress(filePath string) error {
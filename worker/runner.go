@@ -6,8 +6,11 @@ package worker
 
 import (
 	"bubble/env"
+	"bubble/trace"
 	"bubble/worker/action"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 
 	log "github.com/cihub/seelog"
@@ -57,12 +60,17 @@ func (r *runner) Execute(ctx ICtx) {
 	a, err := r.queue(ctx)
 	if err != nil {
 		log.Error(err)
-		r.worker.Finish(r.name, ctx.Master(), ctx.UID(), false, ctx.Env())
+		r.worker.Finish(r.name, ctx.Master(), ctx.UID(), false, ctx.Env(), "")
 	} else {
 		log.Infof("Execute proc [%d] in target [%s].\n", ctx.UID(), ctx.Target())
 
-		// Initialize variables for Action scope.
+		// Secrets are only available in this Action scope.
 		e := ctx.Env()
+		for k, v := range ctx.Secrets() {
+			e.Set(SECRETPREFIX+k, env.NewAny(v))
+		}
+
+		// Initialize variables for Action scope.
 		vars := ctx.Variables()
 		if !vars.IsNil() {
 			m := vars.Map()
@@ -72,10 +80,29 @@ func (r *runner) Execute(ctx ICtx) {
 		}
 
 		// Execute the Action for the Context.
-		success := <-a.Execute(ctx.Script(), ctx.Target(), e, &logger{runner: r, ctx: ctx})
+		span := trace.Start(ctx.Span(), "action "+r.name)
+		span.Set("target", ctx.Target()).Set("uid", strconv.FormatUint(ctx.UID(), 16))
+
+		l := newLogger(r, ctx, span.Context())
+		success := <-a.Execute(ctx.Script(), ctx.Target(), e, l)
+		l.flush()
+
+		if !success {
+			span.Fail(errors.New("action is failed"))
+		}
+		span.Finish()
+
+		// Never return secrets to Master, including the variables and
+		// outputs made of them.
+		values := make([]string, 0)
+		for k, v := range ctx.Secrets() {
+			e.Delete(SECRETPREFIX + k)
+			values = append(values, v)
+		}
+		e.Strip(values...)
 
 		// Finish Action execution to Master.
-		r.worker.Finish(r.name, ctx.Master(), ctx.UID(), success, e)
+		r.worker.Finish(r.name, ctx.Master(), ctx.UID(), success, e, span.Context())
 
 		r.procsLocker.Lock()
 		defer r.procsLocker.Unlock()
@@ -101,6 +128,18 @@ func (r *runner) Workload() int {
 	return len(r.procs)
 }
 
+func (r *runner) Procs() []uint64 {
+	r.procsLocker.Lock()
+	defer r.procsLocker.Unlock()
+
+	procs := make([]uint64, 0, len(r.procs))
+	for uid := range r.procs {
+		procs = append(procs, uid)
+	}
+
+	return procs
+}
+
 // --- Inner ---
 
 func (r *runner) queue(ctx ICtx) (action.IAction, error) {
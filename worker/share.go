@@ -5,11 +5,11 @@
 package worker
 
 import (
+	"bubble/worker/action"
 	log "github.com/cihub/seelog"
 	"github.com/giant-tech/go-service/framework/iserver"
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 )
 
@@ -40,8 +40,7 @@ func (s *share) Clean() {
 }
 
 func (s *share) cwd() string {
-	ext, _ := os.Executable()
-	return path.Join(filepath.Dir(ext), "jobs", strconv.FormatUint(s.uid, 16))
+	return path.Join(action.Root(), strconv.FormatUint(s.uid, 16))
 }
 
 func (s *share) workPath() string {
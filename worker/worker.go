@@ -8,6 +8,9 @@ import (
 	"bubble/cron"
 	"bubble/def"
 	"bubble/env"
+	"bubble/store"
+	"bubble/trace"
+	"bubble/worker/action"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -16,6 +19,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/cihub/seelog"
 	"github.com/giant-tech/go-service/framework/idata"
@@ -28,17 +32,53 @@ const (
 	WorkerConfigFile string = "./worker.yml"
 	// CRONFILE defines the bubble cron job file name.
 	CRONFILE string = ".bubble.crons"
+	// ENROLLKEY defines the enrollment configure key in worker.yml.
+	ENROLLKEY string = "enroll"
+	// TOKENENV defines the OS env name of the enrollment token.
+	TOKENENV string = "BUBBLE_WORKER_TOKEN"
+	// DATAKEY defines the data folder configure key in worker.yml.
+	DATAKEY string = "data"
+	// WORKSPACEKEY defines the workspace folder configure key in worker.yml.
+	WORKSPACEKEY string = "workspace"
+	// CONFIGENV defines the OS env of the configure file path.
+	CONFIGENV string = "BUBBLE_WORKER_CONFIG"
+	// DATAENV defines the OS env of the data folder.
+	DATAENV string = "BUBBLE_WORKER_DATA"
+	// WORKSPACEENV defines the OS env of the workspace folder.
+	WORKSPACEENV string = "BUBBLE_WORKER_WORKSPACE"
 )
 
 // Worker type.
 type Worker struct {
 	service.BaseService
+
+	// ConfigFile is the configure file path, which overrides CONFIGENV and
+	// WorkerConfigFile.
+	ConfigFile string
+	// DataDir is the folder of Worker data, which overrides DATAENV and
+	// `data` in configure file. It's the executable folder by default, and
+	// should be different for each Worker on the same host.
+	DataDir string
+	// Workspace is the folder of Action working directories, which
+	// overrides WORKSPACEENV and `workspace` in configure file. It's the
+	// "jobs" folder in the data folder by default.
+	Workspace string
+
+	folder        string
 	mastersLocker sync.Mutex
 	masters       map[uint64]iserver.IServiceProxy
+	leader        uint64
+	session       string
+	pendingLocker sync.Mutex
+	pending       []*call
 	runners       map[string]IRunner
 	providers     map[uint64]IProvider
 	executors     map[uint64]IExecutor
 	cron          cron.ICron
+	reported      time.Time
+	reporting     int32
+	name          string
+	token         string
 }
 
 // OnInit method initialize the Worker.
@@ -48,7 +88,16 @@ func (w *Worker) OnInit() error {
 	w.providers = make(map[uint64]IProvider)
 	w.executors = make(map[uint64]IExecutor)
 
-	all, err := env.Load(WorkerConfigFile)
+	// Session id identifies this process, so Master could tell a reconnection
+	// from a restart.
+	uid, err := def.NextUid()
+	if err != nil {
+		return err
+	}
+	w.session = strconv.FormatUint(uid, 16)
+
+	file := def.FirstOf(w.ConfigFile, os.Getenv(CONFIGENV), WorkerConfigFile)
+	all, err := env.Load(file)
 	if err != nil {
 		return err
 	}
@@ -58,7 +107,44 @@ func (w *Worker) OnInit() error {
 	}
 
 	data := all.Map()
+
+	// Relative paths in configure file are based on its folder.
+	base, _ := filepath.Abs(filepath.Dir(file))
+	folder, workspace := "", ""
+	if d, ok := data[DATAKEY]; ok {
+		folder = def.Abs(base, d.ToString())
+	}
+	if d, ok := data[WORKSPACEKEY]; ok {
+		workspace = def.Abs(base, d.ToString())
+	}
+	w.folder = def.FirstOf(w.DataDir, os.Getenv(DATAENV), folder, def.ExeDir())
+	action.SetRoot(def.FirstOf(w.Workspace, os.Getenv(WORKSPACEENV), workspace, path.Join(w.folder, "jobs")))
+	if err = os.MkdirAll(action.Root(), os.ModePerm); err != nil {
+		return err
+	}
+	log.Infof("Worker data folder is [%s], and workspace is [%s].", w.folder, action.Root())
+	if err = trace.Setup("bubble-worker", data[trace.CONFIGKEY]); err != nil {
+		return err
+	}
+
+	// Enrollment name and token, the name is host name by default.
+	w.name, _ = os.Hostname()
+	w.token = os.Getenv(TOKENENV)
+	if e, ok := data[ENROLLKEY]; ok && e.IsMap() {
+		if n, ok := e.Map()["name"]; ok {
+			w.name = n.ToString()
+		}
+		if t, ok := e.Map()["token"]; ok {
+			w.token = t.ToString()
+		}
+	}
+
 	for k, cf := range data {
+		switch k {
+		case trace.CONFIGKEY, ENROLLKEY, DATAKEY, WORKSPACEKEY:
+			continue
+		}
+
 		runner := NewRunner(k, w)
 		err = runner.Validate(cf)
 		if err != nil {
@@ -68,7 +154,7 @@ func (w *Worker) OnInit() error {
 		w.runners[k] = runner
 	}
 
-	w.cron = cron.NewCron(func() cron.ICronJob { return &clean{w: w} }, path.Join(w.dir(), CRONFILE))
+	w.cron = cron.NewCron(func() cron.ICronJob { return &clean{w: w} }, store.NewFileStore(w.dir()), CRONFILE)
 	w.cron.StartAll()
 
 	return nil
@@ -76,6 +162,7 @@ func (w *Worker) OnInit() error {
 
 // OnDestroy method.
 func (w *Worker) OnDestroy() {
+	trace.Close()
 }
 
 // OnConnected method.
@@ -87,7 +174,8 @@ func (w *Worker) OnConnected(info []*idata.ServiceInfo) {
 			for k, r := range w.runners {
 				supports[k], _ = r.Conf().ToBytes()
 			}
-			proxy.AsyncCall("Register", w.GetSID(), supports)
+			proxy.AsyncCall("Register", w.GetSID(), supports, w.name, w.token)
+			proxy.AsyncCall("Session", w.GetSID(), w.session, w.running())
 
 			w.mastersLocker.Lock()
 			{
@@ -95,6 +183,9 @@ func (w *Worker) OnConnected(info []*idata.ServiceInfo) {
 			}
 			w.mastersLocker.Unlock()
 			log.Debugf("Worker [%d] register to Master.", w.GetSID())
+
+			// Notifications while disconnected.
+			w.replay()
 		}
 	}
 }
@@ -106,6 +197,9 @@ func (w *Worker) OnDisconnected(info []*idata.ServiceInfo) {
 			w.mastersLocker.Lock()
 			{
 				delete(w.masters, i.ServiceID)
+				if w.leader == i.ServiceID {
+					w.leader = 0
+				}
 			}
 			w.mastersLocker.Unlock()
 		}
@@ -126,12 +220,13 @@ func (w *Worker) OnTick() {
 	binary.BigEndian.PutUint32(payload, uint32(workload))
 
 	w.Broadcast(def.WORKLOAD, payload)
+	w.report()
 }
 
 // --- RPC ---
 
-// RPCExecute will trigger target action with master id, last provider, uid, script, variables, target and env parameters.
-func (w *Worker) RPCExecute(action string, master, provider, uid uint64, disk string, script, variables []byte, target string, envData []byte) {
+// RPCExecute will trigger target action with master id, last provider, uid, script, variables, target, env, secrets and the traceparent of the command span.
+func (w *Worker) RPCExecute(action string, master, provider, uid uint64, disk string, script, variables []byte, target string, envData []byte, secretData []byte, span string) {
 	log.Debugf("Trigger Action [%s] execution in target [%s] of Instance [%d].\n", action, target, uid)
 
 	e := env.NewEnv()
@@ -143,10 +238,17 @@ func (w *Worker) RPCExecute(action string, master, provider, uid uint64, disk st
 	vars := env.NewAny(nil)
 	vars.FromBytes(variables)
 
+	secrets := make(map[string]string)
+	if len(secretData) > 0 {
+		if err := json.Unmarshal(secretData, &secrets); err != nil {
+			log.Error(err)
+		}
+	}
+
 	r, ok := w.runners[action]
 	if !ok {
 		log.Errorf("There is no action [%] in this Worker!\n", action)
-		w.Finish(action, master, uid, false, e)
+		w.Finish(action, master, uid, false, e, "")
 		return
 	}
 
@@ -156,11 +258,31 @@ func (w *Worker) RPCExecute(action string, master, provider, uid uint64, disk st
 	}
 
 	proxy := iserver.GetServiceProxyMgr().GetServiceByID(provider)
-	executor := NewExecutor(proxy, w, uid, disk, r, NewCtx(master, uid, s, vars, target, e))
+	executor := NewExecutor(proxy, w, uid, disk, r, NewCtx(master, uid, s, vars, target, e, secrets, span))
 	w.executors[uid] = executor
 	go executor.Execute()
 }
 
+// RPCLead is called by the leader Master, the Worker reports its running
+// Actions, and notifies the leader instead of the Master which executed
+// them.
+func (w *Worker) RPCLead(master uint64) {
+	w.mastersLocker.Lock()
+	proxy, ok := w.masters[master]
+	changed := ok && w.leader != master
+	if changed {
+		w.leader = master
+	}
+	w.mastersLocker.Unlock()
+	if !changed {
+		return
+	}
+
+	log.Infof("Worker [%d] follows leader Master [%d].", w.GetSID(), master)
+	proxy.AsyncCall("Running", w.GetSID(), w.running())
+	w.replay()
+}
+
 // RPCCancel will cancel target action for Instance.
 func (w *Worker) RPCCancel(action string, uid uint64) {
 	log.Debugf("Cancel Action [%s] for Instance [%d].\n", action, uid)
@@ -193,7 +315,7 @@ func (w *Worker) RPCClean(uid uint64) {
 }
 
 // RPCBeforeSend handle the pre transfer disk request.
-func (w *Worker) RPCBeforeSend(worker, uid uint64, disk string) {
+func (w *Worker) RPCBeforeSend(worker, uid uint64, disk string, span string) {
 	log.Debugf("RPCBeforeSend to worker [%d], uid [%d] and disk [%s].\n", worker, uid, disk)
 
 	_, ok := w.providers[uid]
@@ -202,7 +324,7 @@ func (w *Worker) RPCBeforeSend(worker, uid uint64, disk string) {
 	}
 
 	proxy := iserver.GetServiceProxyMgr().GetServiceByID(worker)
-	provider := NewProvider(proxy, uid, disk)
+	provider := NewProvider(proxy, uid, disk, span)
 	w.providers[uid] = provider
 	go provider.BeforeSend()
 }
@@ -257,14 +379,9 @@ func (w *Worker) UID() uint64 {
 	return w.GetSID()
 }
 
-// Finish method notify the Master to finish the target action with payload data.
-func (w *Worker) Finish(action string, master, uid uint64, success bool, env env.IEnv) {
-	proxy, ok := w.masters[master]
-	if !ok {
-		log.Errorf("There is no Master [%d] to finish!", master)
-		return
-	}
-
+// Finish method notify the Master to finish the target action with payload
+// data, it's buffered until the Master reconnects if it's disconnected.
+func (w *Worker) Finish(action string, master, uid uint64, success bool, env env.IEnv, span string) {
 	log.Debugf("Finish Instance [%d] with result [%t] to Master [%d].\n", uid, success, master)
 	ebytes, err := env.ToBytes()
 	if err != nil {
@@ -272,19 +389,16 @@ func (w *Worker) Finish(action string, master, uid uint64, success bool, env env
 		return
 	}
 
-	proxy.AsyncCall("OnFinish", w.GetSID(), action, uid, success, ebytes)
+	w.notify(&call{master: master, method: "OnFinish", action: action, uid: uid,
+		args: []interface{}{w.GetSID(), action, uid, success, ebytes, span}})
 }
 
-// Progress method notify the Master the target action progress.
-func (w *Worker) Progress(action string, master, uid uint64, payload []byte) {
-	proxy, ok := w.masters[master]
-	if !ok {
-		log.Errorf("There is no Master [%d] to notify!", master)
-		return
-	}
-
+// Progress method notify the Master the target action progress, it's
+// buffered until the Master reconnects if it's disconnected.
+func (w *Worker) Progress(action string, master, uid uint64, payload []byte, span string) {
 	log.Debugf("Progress Instance [%d] to Master [%d].\n", uid, master)
-	proxy.AsyncCall("OnProgress", w.GetSID(), action, uid, payload)
+	w.notify(&call{master: master, method: "OnProgress", action: action, uid: uid,
+		args: []interface{}{w.GetSID(), action, uid, payload, span}})
 }
 
 // Broadcast method broadcast data to all Masters.
@@ -299,9 +413,22 @@ func (w *Worker) Broadcast(t def.TYPE, payload []byte) {
 
 // --- Inner ---
 
+// master returns the leader Master if there is one, since the Master which
+// executed the Action may be standby now.
+func (w *Worker) master(id uint64) (iserver.IServiceProxy, bool) {
+	w.mastersLocker.Lock()
+	defer w.mastersLocker.Unlock()
+
+	if proxy, ok := w.masters[w.leader]; ok {
+		return proxy, true
+	}
+
+	proxy, ok := w.masters[id]
+	return proxy, ok
+}
+
 func (w *Worker) dir() string {
-	ext, _ := os.Executable()
-	return filepath.Dir(ext)
+	return w.folder
 }
 
 // --- ICronJob ---
@@ -316,7 +443,7 @@ func (c *clean) Repeat() bool {
 }
 
 func (c *clean) Execute() {
-	dir := path.Join(c.w.dir(), "jobs", strconv.FormatUint(c.target, 16))
+	dir := path.Join(action.Root(), strconv.FormatUint(c.target, 16))
 	_, err := os.Stat(dir)
 	if err == nil {
 		log.Debugf("Try to clean dir: [%s].", dir)